@@ -0,0 +1,332 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Acciones que quedan en la auditoría.
+const (
+	accionUsuarioCrear          = "usuario.crear"
+	accionUsuarioActualizar     = "usuario.actualizar"
+	accionUsuarioEliminar       = "usuario.eliminar"
+	accionUsuarioSuprimir       = "usuario.suprimir"
+	accionUltimaSesion          = "usuario.ultima_sesion"
+	accionRolesAsignar          = "usuario.roles"
+	accionContrasenaRestablecer = "usuario.contrasena_restablecer"
+	accionCorreoConfirmar       = "usuario.correo_confirmar"
+	accionGoogleVincular        = "usuario.google_vincular"
+	accionTOTPIniciar           = "usuario.totp_iniciar"
+	accionTOTPActivar           = "usuario.totp_activar"
+	accionTOTPDesactivar        = "usuario.totp_desactivar"
+	accionPasskeyRegistrar      = "usuario.passkey_registrar"
+	accionPasskeyEliminar       = "usuario.passkey_eliminar"
+	accionSesionRevocar         = "usuario.sesion_revocar"
+	accionVentaCrear            = "venta.crear"
+	accionIngresoRegistrar      = "venta.ingreso"
+	accionOrganizadorCrear      = "organizador.crear"
+	accionOrganizadorActualizar = "organizador.actualizar"
+	accionEventoCrear           = "evento.crear"
+	accionEventoActualizar      = "evento.actualizar"
+)
+
+// Tipos de objetivo de la auditoría.
+const (
+	objetivoUsuario     = "usuario"
+	objetivoVenta       = "venta"
+	objetivoOrganizador = "organizador"
+	objetivoEvento      = "evento"
+)
+
+// maxAuditoriaListada limita cuántos registros devuelve una consulta.
+const maxAuditoriaListada = 500
+
+const valorRedactado = "[REDACTADO]"
+
+// registroAuditoria es una entrada de la colección auditoria. La aplicación
+// solo inserta en ella; en producción el usuario de la base con el que corre
+// debería tener sobre esa colección únicamente insert y find.
+type registroAuditoria struct {
+	ID    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Fecha time.Time          `json:"fecha" bson:"fecha"`
+	// Actor va vacío en las rutas públicas, como el registro o los enlaces
+	// de los correos; ahí quien actúa es el dueño del objetivo.
+	Actor    *actorAuditoria   `json:"actor,omitempty" bson:"actor,omitempty"`
+	Accion   string            `json:"accion" bson:"accion"`
+	Objetivo objetivoAuditoria `json:"objetivo" bson:"objetivo"`
+	// Antes y Despues solo llevan los campos que cambiaron, con los datos
+	// personales enmascarados y los secretos redactados.
+	Antes     bson.M `json:"antes,omitempty" bson:"antes,omitempty"`
+	Despues   bson.M `json:"despues,omitempty" bson:"despues,omitempty"`
+	IP        string `json:"ip" bson:"ip"`
+	RequestID string `json:"request_id" bson:"request_id"`
+	Metodo    string `json:"metodo" bson:"metodo"`
+	Ruta      string `json:"ruta" bson:"ruta"`
+}
+
+// actorAuditoria es el usuario autenticado que hizo el cambio. La cédula se
+// guarda enmascarada; para filtrar se usa su índice ciego.
+type actorAuditoria struct {
+	UsuarioID  primitive.ObjectID `json:"usuario" bson:"usuario_id"`
+	Cedula     string             `json:"cedula" bson:"cedula"`
+	CedulaHash string             `json:"-" bson:"cedula_hash"`
+	Roles      []string           `json:"roles" bson:"roles"`
+}
+
+// objetivoAuditoria es el registro que cambió. Los cambios de usuarios y
+// ventas llevan además la cédula del dueño, enmascarada como la del actor.
+type objetivoAuditoria struct {
+	Tipo       string             `json:"tipo" bson:"tipo"`
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"id,omitempty"`
+	Cedula     string             `json:"cedula,omitempty" bson:"cedula,omitempty"`
+	CedulaHash string             `json:"-" bson:"cedula_hash,omitempty"`
+}
+
+// objetivo arma el objetivo de un registro de auditoría. La cédula puede ir
+// vacía.
+func objetivo(tipo string, id primitive.ObjectID, cedula string) objetivoAuditoria {
+	o := objetivoAuditoria{Tipo: tipo, ID: id}
+	if cedula != "" {
+		o.Cedula = enmascararFinal(cedula, 3)
+		o.CedulaHash = llavero.IndiceCiego("cedula", cedula)
+	}
+	return o
+}
+
+// auditar registra un cambio ya escrito. antes y despues son el registro, o
+// la parte que cambió, con la forma que tiene en la base; nil en las
+// creaciones y las eliminaciones. Si no se puede guardar, el cambio ya está
+// hecho, así que solo se deja el error en el log.
+func auditar(c *gin.Context, accion string, obj objetivoAuditoria, antes, despues any) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	registro := registroAuditoria{
+		Fecha:     time.Now(),
+		Accion:    accion,
+		Objetivo:  obj,
+		IP:        c.ClientIP(),
+		RequestID: idSolicitud(ctx),
+		Metodo:    c.Request.Method,
+		Ruta:      c.FullPath(),
+	}
+	if v, ok := c.Get(claveUsuarioAutenticado); ok {
+		if actor, ok := v.(Usuario); ok {
+			registro.Actor = &actorAuditoria{
+				UsuarioID:  actor.ID,
+				Cedula:     enmascararFinal(actor.Cedula, 3),
+				CedulaHash: llavero.IndiceCiego("cedula", actor.Cedula),
+				Roles:      actor.rolesEfectivos(),
+			}
+		}
+	}
+
+	var err error
+	registro.Antes, registro.Despues, err = diferencias(antes, despues)
+	if err == nil {
+		_, err = auditoriaCollection.InsertOne(ctx, registro)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "No se pudo registrar la auditoría", "accion", accion, "objetivo", obj.ID.Hex(), "error", err)
+	}
+}
+
+// diferencias compara dos versiones de un registro campo a campo y devuelve
+// solo los que cambiaron, enmascarados. Los campos que no están en una de
+// las versiones faltan también en su lado del resultado.
+func diferencias(antes, despues any) (bson.M, bson.M, error) {
+	a, err := aDocumento(antes)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := aDocumento(despues)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cambiosAntes, cambiosDespues := bson.M{}, bson.M{}
+	for campo, v := range a {
+		if w, ok := d[campo]; !ok || !reflect.DeepEqual(v, w) {
+			cambiosAntes[campo] = enmascararAuditoria(campo, v)
+		}
+	}
+	for campo, w := range d {
+		if v, ok := a[campo]; !ok || !reflect.DeepEqual(v, w) {
+			cambiosDespues[campo] = enmascararAuditoria(campo, w)
+		}
+	}
+	if len(cambiosAntes) == 0 {
+		cambiosAntes = nil
+	}
+	if len(cambiosDespues) == 0 {
+		cambiosDespues = nil
+	}
+	return cambiosAntes, cambiosDespues, nil
+}
+
+// aDocumento pasa v por BSON para compararlo con los nombres de campo de la
+// base. Se descartan el _id, que ya va en el objetivo, y los índices ciegos.
+func aDocumento(v any) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "_id")
+	for campo := range doc {
+		if strings.HasSuffix(campo, "_hash") {
+			delete(doc, campo)
+		}
+	}
+	return doc, nil
+}
+
+// enmascararAuditoria aplica a un valor las mismas reglas que los logs según
+// el nombre de su campo, también dentro de subdocumentos y arreglos. Los
+// secretos y las credenciales se redactan enteros.
+func enmascararAuditoria(campo string, v any) any {
+	if s, ok := v.(string); ok && s == "" {
+		return s
+	}
+	switch campo {
+	case "contrasena", "direccion", "clave_datos", "totp", "passkeys", "google_sub",
+		"secreto", "pendiente", "codigos_recuperacion":
+		return valorRedactado
+	case "foto":
+		return imagenOmitida
+	}
+	switch x := v.(type) {
+	case string:
+		switch campo {
+		case "cedula", "documento_titular":
+			return enmascararFinal(x, 3)
+		case "numero_cuenta":
+			return enmascararFinal(x, 4)
+		case "telefono":
+			return enmascararFinal(x, 2)
+		case "correo":
+			return enmascararCorreo(x)
+		}
+	case bson.M:
+		enmascarado := make(bson.M, len(x))
+		for k, w := range x {
+			enmascarado[k] = enmascararAuditoria(k, w)
+		}
+		return enmascarado
+	case bson.A:
+		enmascarado := make(bson.A, len(x))
+		for i, w := range x {
+			enmascarado[i] = enmascararAuditoria(campo, w)
+		}
+		return enmascarado
+	}
+	return v
+}
+
+// filtroAuditoria son los filtros de GET /auditoria. Las cédulas se buscan
+// por su índice ciego y las fechas van en RFC 3339.
+type filtroAuditoria struct {
+	// Actor es la cédula de quien hizo el cambio.
+	Actor string `form:"actor"`
+	// Cedula es la cédula del usuario o del comprador afectado.
+	Cedula string `form:"cedula"`
+	Accion string `form:"accion"`
+	Tipo   string `form:"tipo"`
+	// Objetivo es el ID del registro afectado.
+	Objetivo string `form:"objetivo"`
+	Desde    string `form:"desde"`
+	Hasta    string `form:"hasta"`
+	Limite   int    `form:"limite"`
+}
+
+// consultarAuditoria devuelve los registros de auditoría que cumplen los
+// filtros, del más reciente al más antiguo.
+func consultarAuditoria(c *gin.Context) {
+	var consulta filtroAuditoria
+	if err := c.ShouldBindQuery(&consulta); err != nil {
+		slog.WarnContext(c.Request.Context(), "Filtros de auditoría inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+
+	filtro := bson.M{}
+	errores := make(map[string]string)
+	if consulta.Actor != "" {
+		filtro["actor.cedula_hash"] = llavero.IndiceCiego("cedula", consulta.Actor)
+	}
+	if consulta.Cedula != "" {
+		filtro["objetivo.cedula_hash"] = llavero.IndiceCiego("cedula", consulta.Cedula)
+	}
+	if consulta.Accion != "" {
+		filtro["accion"] = consulta.Accion
+	}
+	if consulta.Tipo != "" {
+		filtro["objetivo.tipo"] = consulta.Tipo
+	}
+	if consulta.Objetivo != "" {
+		id, err := primitive.ObjectIDFromHex(consulta.Objetivo)
+		if err != nil {
+			errores["objetivo"] = "auditoria.objetivo"
+		}
+		filtro["objetivo.id"] = id
+	}
+	fechas := bson.M{}
+	for _, f := range []struct{ campo, operador, valor string }{
+		{"desde", "$gte", consulta.Desde},
+		{"hasta", "$lte", consulta.Hasta},
+	} {
+		if f.valor == "" {
+			continue
+		}
+		fecha, err := time.Parse(time.RFC3339, f.valor)
+		if err != nil {
+			errores[f.campo] = "auditoria.fecha"
+		}
+		fechas[f.operador] = fecha
+	}
+	if len(fechas) > 0 {
+		filtro["fecha"] = fechas
+	}
+	if consulta.Limite == 0 {
+		consulta.Limite = maxAuditoriaListada
+	}
+	if consulta.Limite < 1 || consulta.Limite > maxAuditoriaListada {
+		errores["limite"] = "auditoria.limite"
+	}
+	if len(errores) > 0 {
+		responderValidacion(c, errores)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	opciones := options.Find().
+		SetSort(bson.D{{Key: "fecha", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(consulta.Limite))
+	registros := []registroAuditoria{}
+	cursor, err := auditoriaCollection.Find(ctx, filtro, opciones)
+	if err == nil {
+		err = cursor.All(ctx, &registros)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo consultar la auditoría", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	responderOK(c, http.StatusOK, "", registros)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDiferenciasEnmascaradas(t *testing.T) {
+	id := primitive.NewObjectID()
+	antes := bson.M{
+		"_id": id, "nombre": "Ana", "cedula": "1000000001", "cedula_hash": "a",
+		"correo": "ana@example.com", "contrasena": "vieja", "telefono": "3001234567",
+	}
+	despues := bson.M{
+		"_id": id, "nombre": "Ana", "cedula": "1000000002", "cedula_hash": "b",
+		"correo": "ana@example.com", "contrasena": "nueva", "telefono": "3001234567",
+		"totp":    bson.M{"secreto": "JBSWY3DP"},
+		"titular": bson.M{"documento_titular": "1000000001", "correo": "luis@example.com"},
+	}
+
+	a, d, err := diferencias(antes, despues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperadoAntes := bson.M{"cedula": "*******001", "contrasena": valorRedactado}
+	esperadoDespues := bson.M{
+		"cedula": "*******002", "contrasena": valorRedactado, "totp": valorRedactado,
+		"titular": bson.M{"documento_titular": "*******001", "correo": "l***@example.com"},
+	}
+	if !reflect.DeepEqual(a, esperadoAntes) {
+		t.Errorf("antes: %v, se esperaba %v", a, esperadoAntes)
+	}
+	if !reflect.DeepEqual(d, esperadoDespues) {
+		t.Errorf("después: %v, se esperaba %v", d, esperadoDespues)
+	}
+
+	// Sin cambios no queda nada que auditar
+	if a, d, err := diferencias(antes, antes); err != nil || a != nil || d != nil {
+		t.Errorf("sin cambios: %v %v %v", a, d, err)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Roles de los usuarios. Un usuario sin roles guardados es cliente.
+const (
+	rolAdmin       = "admin"
+	rolOrganizador = "organizador"
+	rolPorteria    = "porteria"
+	rolCliente     = "cliente"
+)
+
+// Permisos que exigen las rutas. Cada rol trae los suyos y a un usuario se le
+// pueden conceder otros sueltos.
+const (
+	// permisoDatosPropios permite consultar, modificar y eliminar la propia cuenta.
+	permisoDatosPropios = "usuarios:propios"
+	// permisoGestionarUsuarios extiende lo anterior a cualquier cuenta y a sus roles.
+	permisoGestionarUsuarios = "usuarios:gestionar"
+	permisoComprar           = "ventas:comprar"
+	// permisoConsultarVentas lista las ventas al alcance del usuario: las
+	// propias, las de sus eventos o, con permisoTodasLasVentas, todas.
+	permisoConsultarVentas   = "ventas:consultar"
+	permisoTodasLasVentas    = "ventas:todas"
+	permisoRegistrarIngresos = "ingresos:registrar"
+	// permisoGestionarEventos administra el organizador propio: sus datos,
+	// escenarios, datos de pago, eventos y precios.
+	permisoGestionarEventos  = "eventos:gestionar"
+	permisoConsultarReportes = "reportes:consultar"
+	// permisoGestionarOrganizadores da de alta organizadores y extiende los
+	// dos anteriores a todos.
+	permisoGestionarOrganizadores = "organizadores:gestionar"
+	// permisoConsultarAuditoria lee el registro de cambios de todas las cuentas.
+	permisoConsultarAuditoria = "auditoria:consultar"
+)
+
+var todosLosPermisos = []string{
+	permisoDatosPropios, permisoGestionarUsuarios, permisoComprar,
+	permisoConsultarVentas, permisoTodasLasVentas, permisoRegistrarIngresos,
+	permisoGestionarEventos, permisoConsultarReportes, permisoGestionarOrganizadores,
+	permisoConsultarAuditoria,
+}
+
+// permisosPorRol define qué puede hacer cada rol. La portería solo registra
+// ingresos; ni siquiera gestiona su propia cuenta desde la API.
+var permisosPorRol = map[string][]string{
+	rolAdmin:       todosLosPermisos,
+	rolOrganizador: {permisoDatosPropios, permisoConsultarVentas, permisoGestionarEventos, permisoConsultarReportes},
+	rolPorteria:    {permisoRegistrarIngresos},
+	rolCliente:     {permisoDatosPropios, permisoComprar, permisoConsultarVentas},
+}
+
+// rolesEfectivos devuelve los roles del usuario, o cliente si no tiene.
+func (u Usuario) rolesEfectivos() []string {
+	if len(u.Roles) == 0 {
+		return []string{rolCliente}
+	}
+	return u.Roles
+}
+
+func (u Usuario) tieneRol(rol string) bool {
+	return slices.Contains(u.rolesEfectivos(), rol)
+}
+
+// permisosEfectivos une los permisos de los roles con los concedidos al usuario.
+func (u Usuario) permisosEfectivos() []string {
+	var permisos []string
+	for _, rol := range u.rolesEfectivos() {
+		permisos = append(permisos, permisosPorRol[rol]...)
+	}
+	permisos = append(permisos, u.Permisos...)
+	slices.Sort(permisos)
+	return slices.Compact(permisos)
+}
+
+func (u Usuario) tienePermiso(permiso string) bool {
+	return slices.Contains(u.permisosEfectivos(), permiso)
+}
+
+// claveUsuarioAutenticado guarda en el contexto de Gin al usuario que llama.
+const claveUsuarioAutenticado = "usuario_autenticado"
+
+// autenticarUsuario identifica a quien llama por el token de su sesión y lo
+// deja en el contexto. Las sesiones solo se abren tras pasar el segundo
+// factor, el bloqueo por intentos fallidos y el límite por IP, así que no se
+// acepta la contraseña sola. Si no puede, responde 401 y devuelve false.
+func autenticarUsuario(c *gin.Context, ctx context.Context) (Usuario, bool) {
+	token, ok := tokenSesion(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Bearer realm="qrtixpro"`)
+		responderError(c, http.StatusUnauthorized, codigoAutenticacionRequerida)
+		return Usuario{}, false
+	}
+	return autenticarSesion(c, ctx, token)
+}
+
+// exigirPermiso autentica a quien llama y solo deja pasar si tiene el
+// permiso. En las rutas con :cedula además tiene que ser esa su cédula, salvo
+// que pueda gestionar usuarios, y en las rutas con :organizador tiene que
+// trabajar para ese organizador, salvo que pueda gestionarlos a todos. El
+// usuario queda en el contexto para el handler.
+func exigirPermiso(permiso string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+		defer cancel()
+
+		usuario, ok := autenticarUsuario(c, ctx)
+		if !ok {
+			return
+		}
+
+		if !usuario.tienePermiso(permiso) {
+			slog.WarnContext(c.Request.Context(), "Permiso denegado", "cedula", usuario.Cedula, "permiso", permiso, "ruta", c.FullPath())
+			responderError(c, http.StatusForbidden, codigoPermisoDenegado)
+			return
+		}
+		if cedula := c.Param("cedula"); cedula != "" && !autorizarCedula(c, cedula) {
+			return
+		}
+		if organizador := c.Param("organizador"); organizador != "" && !autorizarOrganizador(c, organizador) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// usuarioAutenticado devuelve el usuario que dejó autenticarUsuario.
+func usuarioAutenticado(c *gin.Context) Usuario {
+	usuario, _ := c.MustGet(claveUsuarioAutenticado).(Usuario)
+	return usuario
+}
+
+// autorizarCedula comprueba que quien llama puede actuar sobre los datos de
+// la cédula: es la suya o gestiona usuarios. Las rutas antiguas, que reciben
+// la cédula en el cuerpo, lo llaman después de decodificarlo. Si no puede,
+// responde 403 y devuelve false.
+func autorizarCedula(c *gin.Context, cedula string) bool {
+	usuario := usuarioAutenticado(c)
+	if (cedula != "" && usuario.Cedula == cedula) || usuario.tienePermiso(permisoGestionarUsuarios) {
+		return true
+	}
+	slog.WarnContext(c.Request.Context(), "Acceso a datos de otro usuario denegado", "cedula", usuario.Cedula, "cedula_solicitada", cedula)
+	responderError(c, http.StatusForbidden, codigoPermisoDenegado)
+	return false
+}
+
+// autorizarTitular comprueba que quien llama es el titular de la cédula, en
+// las rutas de su segundo factor, sus sesiones y sus datos personales, que
+// ni quien gestiona usuarios puede usar por otro. Si no lo es, responde 403
+// y devuelve false.
+func autorizarTitular(c *gin.Context, cedula string) (Usuario, bool) {
+	usuario := usuarioAutenticado(c)
+	if usuario.Cedula == "" || usuario.Cedula != cedula {
+		slog.WarnContext(c.Request.Context(), "Acceso a datos de otro titular denegado", "cedula", usuario.Cedula, "cedula_solicitada", cedula)
+		responderError(c, http.StatusForbidden, codigoPermisoDenegado)
+		return Usuario{}, false
+	}
+	return usuario, true
+}
+
+// autorizarOrganizador comprueba que quien llama trabaja para el organizador
+// o puede gestionarlos a todos. Un ID que no es suyo responde 404, igual que
+// uno inexistente, para no revelar qué organizadores hay.
+func autorizarOrganizador(c *gin.Context, organizador string) bool {
+	usuario := usuarioAutenticado(c)
+	if usuario.tienePermiso(permisoGestionarOrganizadores) ||
+		(!usuario.OrganizadorID.IsZero() && usuario.OrganizadorID.Hex() == organizador) {
+		return true
+	}
+	slog.WarnContext(c.Request.Context(), "Acceso a otro organizador denegado", "cedula", usuario.Cedula, "organizador", organizador)
+	responderError(c, http.StatusNotFound, codigoOrganizadorNoEncontrado)
+	return false
+}
+
+// solicitudRoles es el cuerpo de PUT /usuarios/:cedula/roles. Reemplaza los
+// roles, los permisos sueltos y el organizador del usuario.
+type solicitudRoles struct {
+	Roles    []string `json:"roles"`
+	Permisos []string `json:"permisos"`
+	// Organizador es el ID del organizador para el que trabaja. Es
+	// obligatorio con los roles organizador y porteria.
+	Organizador string `json:"organizador,omitempty"`
+}
+
+// datosRoles es la respuesta con los roles de un usuario y los permisos que
+// resultan de ellos.
+type datosRoles struct {
+	Roles       []string `json:"roles"`
+	Permisos    []string `json:"permisos"`
+	Efectivos   []string `json:"efectivos"`
+	Organizador string   `json:"organizador,omitempty"`
+}
+
+// asignarRoles cambia los roles y permisos de un usuario. Un administrador no
+// puede quitarse a sí mismo el rol, para que no quede la API sin nadie que lo
+// devuelva.
+func asignarRoles(c *gin.Context) {
+	var datos solicitudRoles
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	cedula := c.Param("cedula")
+
+	errores := validarRoles(datos)
+	if cedula == usuarioAutenticado(c).Cedula && !slices.Contains(datos.Roles, rolAdmin) {
+		errores["roles"] = "roles.admin_propio"
+	}
+	var organizadorID primitive.ObjectID
+	if datos.Organizador != "" {
+		id, err := primitive.ObjectIDFromHex(datos.Organizador)
+		existe := false
+		if err == nil {
+			if existe, err = existeOrganizador(c, id); err != nil {
+				slog.ErrorContext(c.Request.Context(), "Error al buscar el organizador", "error", err)
+				responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+				return
+			}
+		}
+		if !existe {
+			errores["organizador"] = "organizador.desconocido"
+		}
+		organizadorID = id
+	} else if necesitaOrganizador(datos.Roles) {
+		errores["organizador"] = "organizador.obligatorio"
+	}
+	if len(errores) > 0 {
+		responderValidacion(c, errores)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	var usuario Usuario
+	err := collection.FindOne(ctx, filtroCedula(cedula)).Decode(&usuario)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			responderError(c, http.StatusNotFound, codigoUsuarioNoEncontrado)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al buscar usuario", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+
+	usuario.Cedula = cedula
+	antes := bson.M{"roles": usuario.Roles, "permisos": usuario.Permisos, "organizador_id": usuario.OrganizadorID}
+	usuario.Roles = slices.Compact(slices.Sorted(slices.Values(datos.Roles)))
+	usuario.Permisos = slices.Compact(slices.Sorted(slices.Values(datos.Permisos)))
+	usuario.OrganizadorID = organizadorID
+	cambios := bson.M{"$set": bson.M{"roles": usuario.Roles, "permisos": usuario.Permisos}}
+	if organizadorID.IsZero() {
+		cambios["$unset"] = bson.M{"organizador_id": ""}
+	} else {
+		cambios["$set"].(bson.M)["organizador_id"] = organizadorID
+	}
+	if !actualizarUsuarioReplicado(c, ctx, usuario, cambios) {
+		return
+	}
+
+	auditar(c, accionRolesAsignar, objetivo(objetivoUsuario, usuario.ID, cedula), antes,
+		bson.M{"roles": usuario.Roles, "permisos": usuario.Permisos, "organizador_id": usuario.OrganizadorID})
+
+	slog.InfoContext(c.Request.Context(), "Roles actualizados", "cedula", cedula, "roles", usuario.Roles, "permisos", usuario.Permisos, "organizador", datos.Organizador, "por", usuarioAutenticado(c).Cedula)
+	responderOK(c, http.StatusOK, exitoRolesActualizados, datosRoles{
+		Roles:       usuario.rolesEfectivos(),
+		Permisos:    usuario.Permisos,
+		Efectivos:   usuario.permisosEfectivos(),
+		Organizador: datos.Organizador,
+	})
+}
+
+// validarRoles devuelve, por campo, la clave del error de los roles o
+// permisos desconocidos.
+func validarRoles(datos solicitudRoles) map[string]string {
+	errores := make(map[string]string)
+	for _, rol := range datos.Roles {
+		if _, ok := permisosPorRol[rol]; !ok {
+			errores["roles"] = "roles.desconocido"
+		}
+	}
+	for _, permiso := range datos.Permisos {
+		if !slices.Contains(todosLosPermisos, permiso) {
+			errores["permisos"] = "permisos.desconocido"
+		}
+	}
+	return errores
+}
+
+// ejecutarAsignacionRoles atiende el subcomando "roles", que fija los roles
+// de un usuario directamente en las bases. Sirve para nombrar al primer
+// administrador, que luego asigna los demás desde la API.
+func ejecutarAsignacionRoles(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Uso: qrtixpro-backend roles <cedula> <rol>...")
+		os.Exit(2)
+	}
+	cedula, roles := args[0], args[1:]
+	if errores := validarRoles(solicitudRoles{Roles: roles}); len(errores) > 0 {
+		fmt.Fprintf(os.Stderr, "Roles válidos: %s, %s, %s, %s\n", rolAdmin, rolOrganizador, rolPorteria, rolCliente)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	fallo := false
+	for _, b := range basesConectadas() {
+		resultado, err := b.db.Collection("usuarios").UpdateOne(ctx, filtroCedula(cedula), bson.M{"$set": bson.M{"roles": roles}})
+		switch {
+		case err != nil:
+			log.Printf("❌ ERROR: %s: %v", b.nombre, err)
+			fallo = true
+		case resultado.MatchedCount == 0:
+			log.Printf("❌ ERROR: %s: no existe un usuario con esa cédula", b.nombre)
+			fallo = true
+		default:
+			log.Printf("✅ %s: roles %v asignados", b.nombre, roles)
+		}
+	}
+
+	// Sin solicitud HTTP no hay actor, IP ni request ID; la ruta identifica
+	// al subcomando
+	_, err := auditoriaCollection.InsertOne(ctx, registroAuditoria{
+		Fecha:    time.Now(),
+		Accion:   accionRolesAsignar,
+		Objetivo: objetivo(objetivoUsuario, primitive.NilObjectID, cedula),
+		Despues:  bson.M{"roles": roles},
+		Ruta:     "cli:roles",
+	})
+	if err != nil {
+		log.Printf("⚠️ Advertencia: no se pudo registrar la auditoría: %v", err)
+	}
+
+	if fallo {
+		os.Exit(1)
+	}
+}
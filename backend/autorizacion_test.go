@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/tunombre/qrtixpro-backend/config"
+)
+
+// sesionesPrueba guarda en memoria, por token, las sesiones abiertas en una
+// prueba. Reemplaza a buscarSesion para no necesitar MongoDB. Borrar un
+// token equivale a revocar su sesión.
+type sesionesPrueba map[string]Usuario
+
+func prepararSesiones(t *testing.T) sesionesPrueba {
+	t.Helper()
+	cfgAntes, llaveroAntes, buscarAntes := cfg, llavero, buscarSesion
+	t.Cleanup(func() { cfg, llavero, buscarSesion = cfgAntes, llaveroAntes, buscarAntes })
+
+	c := config.PorDefecto()
+	cfg, llavero = &c, llaveroPrueba(t)
+	sesiones := sesionesPrueba{}
+	buscarSesion = func(_ context.Context, hash string) (sesion, Usuario, error) {
+		for token, usuario := range sesiones {
+			if hashSecreto(token) == hash {
+				return sesion{ID: primitive.NewObjectID(), Hash: hash, UsuarioID: usuario.ID}, usuario, nil
+			}
+		}
+		return sesion{}, Usuario{}, mongo.ErrNoDocuments
+	}
+	return sesiones
+}
+
+// abrir deja una sesión vigente para el usuario y devuelve su token.
+func (s sesionesPrueba) abrir(usuario Usuario) string {
+	if usuario.ID.IsZero() {
+		usuario.ID = primitive.NewObjectID()
+	}
+	token := primitive.NewObjectID().Hex()
+	s[token] = usuario
+	return token
+}
+
+// solicitar atiende la solicitud en r, con el token como Bearer si no es
+// vacío y el cuerpo en JSON si no es nil, y devuelve el estado y el código
+// de error de la respuesta.
+func solicitar(r http.Handler, metodo, ruta, token string, cuerpo any) (int, string) {
+	var lector io.Reader
+	if cuerpo != nil {
+		crudo, _ := json.Marshal(cuerpo)
+		lector = bytes.NewReader(crudo)
+	}
+	req := httptest.NewRequest(metodo, ruta, lector)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp respuesta
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp.Codigo
+}
+
+func TestRutasLegadoDeDatosPersonalesExigenSesion(t *testing.T) {
+	sesiones := prepararSesiones(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(gin.CustomRecovery(recuperarPanico))
+	registrarRutasLegado(r)
+
+	titular := sesiones.abrir(Usuario{Cedula: "1000000001"})
+	otro := sesiones.abrir(Usuario{Cedula: "1000000002"})
+	porteria := sesiones.abrir(Usuario{Cedula: "1000000001", Roles: []string{rolPorteria}})
+
+	rutas := []struct{ metodo, ruta string }{
+		{http.MethodGet, "/usuarios/1000000001/foto"},
+		{http.MethodGet, "/usuarios/1000000001/datos"},
+		{http.MethodDelete, "/usuarios/1000000001/datos"},
+	}
+	for _, ruta := range rutas {
+		casos := []struct {
+			nombre string
+			token  string
+			estado int
+			codigo string
+		}{
+			{"sin sesión", "", http.StatusUnauthorized, codigoAutenticacionRequerida},
+			{"sesión revocada", "revocada", http.StatusUnauthorized, codigoSesionInvalida},
+			{"sesión de otro titular", otro, http.StatusForbidden, codigoPermisoDenegado},
+			{"sesión de portería", porteria, http.StatusForbidden, codigoPermisoDenegado},
+		}
+		for _, caso := range casos {
+			estado, codigo := solicitar(r, ruta.metodo, ruta.ruta, caso.token, nil)
+			if estado != caso.estado || codigo != caso.codigo {
+				t.Errorf("%s %s, %s: %d %s, se esperaba %d %s", ruta.metodo, ruta.ruta, caso.nombre, estado, codigo, caso.estado, caso.codigo)
+			}
+		}
+	}
+
+	// Con la sesión del titular llega al handler, que no encuentra la foto
+	estado, codigo := solicitar(r, http.MethodGet, "/usuarios/1000000001/foto", titular, nil)
+	if estado != http.StatusNotFound || codigo != codigoFotoNoDisponible {
+		t.Errorf("GET foto del titular: %d %s, se esperaba 404 %s", estado, codigo, codigoFotoNoDisponible)
+	}
+}
+
+func TestPermisosPorRol(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		usuario  Usuario
+		permisos []string
+		negados  []string
+	}{
+		{"cliente sin roles", Usuario{},
+			[]string{permisoDatosPropios, permisoComprar, permisoConsultarVentas},
+			[]string{permisoTodasLasVentas, permisoRegistrarIngresos, permisoGestionarUsuarios}},
+		{"portería", Usuario{Roles: []string{rolPorteria}},
+			[]string{permisoRegistrarIngresos},
+			[]string{permisoDatosPropios, permisoComprar, permisoConsultarVentas}},
+		{"organizador", Usuario{Roles: []string{rolOrganizador}},
+			[]string{permisoGestionarEventos, permisoConsultarReportes, permisoConsultarVentas},
+			[]string{permisoGestionarOrganizadores, permisoTodasLasVentas, permisoConsultarAuditoria, permisoComprar}},
+		{"portería con permiso suelto", Usuario{Roles: []string{rolPorteria}, Permisos: []string{permisoDatosPropios}},
+			[]string{permisoRegistrarIngresos, permisoDatosPropios},
+			[]string{permisoComprar}},
+		{"administrador", Usuario{Roles: []string{rolAdmin}}, todosLosPermisos, nil},
+	}
+	for _, caso := range casos {
+		for _, permiso := range caso.permisos {
+			if !caso.usuario.tienePermiso(permiso) {
+				t.Errorf("%s: no tiene %s", caso.nombre, permiso)
+			}
+		}
+		for _, permiso := range caso.negados {
+			if caso.usuario.tienePermiso(permiso) {
+				t.Errorf("%s: tiene %s", caso.nombre, permiso)
+			}
+		}
+	}
+}
+
+func TestExigirPermiso(t *testing.T) {
+	sesiones := prepararSesiones(t)
+	r := gin.New()
+	r.Use(gin.CustomRecovery(recuperarPanico))
+	atendida := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/propios/:cedula", exigirPermiso(permisoDatosPropios), atendida)
+	r.GET("/organizadores/:organizador/reporte", exigirPermiso(permisoConsultarReportes), atendida)
+	r.POST("/ingresos", exigirPermiso(permisoRegistrarIngresos), atendida)
+
+	orgX, orgY := primitive.NewObjectID(), primitive.NewObjectID()
+	cliente := sesiones.abrir(Usuario{Cedula: "1000000001"})
+	porteria := sesiones.abrir(Usuario{Cedula: "1000000002", Roles: []string{rolPorteria}, OrganizadorID: orgX})
+	organizadorX := sesiones.abrir(Usuario{Cedula: "1000000003", Roles: []string{rolOrganizador}, OrganizadorID: orgX})
+	sinOrganizador := sesiones.abrir(Usuario{Cedula: "1000000004", Roles: []string{rolOrganizador}})
+	admin := sesiones.abrir(Usuario{Cedula: "1000000005", Roles: []string{rolAdmin}})
+
+	casos := []struct {
+		nombre, metodo, ruta, token string
+		estado                      int
+		codigo                      string
+	}{
+		{"sin sesión", http.MethodGet, "/propios/1000000001", "", http.StatusUnauthorized, codigoAutenticacionRequerida},
+		{"token desconocido", http.MethodGet, "/propios/1000000001", "desconocido", http.StatusUnauthorized, codigoSesionInvalida},
+		{"cliente con su cédula", http.MethodGet, "/propios/1000000001", cliente, http.StatusNoContent, ""},
+		{"cliente con otra cédula", http.MethodGet, "/propios/1000000003", cliente, http.StatusForbidden, codigoPermisoDenegado},
+		{"portería con su cédula", http.MethodGet, "/propios/1000000002", porteria, http.StatusForbidden, codigoPermisoDenegado},
+		{"administrador con otra cédula", http.MethodGet, "/propios/1000000001", admin, http.StatusNoContent, ""},
+		{"organizador con el suyo", http.MethodGet, "/organizadores/" + orgX.Hex() + "/reporte", organizadorX, http.StatusNoContent, ""},
+		{"organizador con otro", http.MethodGet, "/organizadores/" + orgY.Hex() + "/reporte", organizadorX, http.StatusNotFound, codigoOrganizadorNoEncontrado},
+		{"organizador sin organizador", http.MethodGet, "/organizadores/" + orgX.Hex() + "/reporte", sinOrganizador, http.StatusNotFound, codigoOrganizadorNoEncontrado},
+		{"portería con reporte de su organizador", http.MethodGet, "/organizadores/" + orgX.Hex() + "/reporte", porteria, http.StatusForbidden, codigoPermisoDenegado},
+		{"cliente con reporte", http.MethodGet, "/organizadores/" + orgX.Hex() + "/reporte", cliente, http.StatusForbidden, codigoPermisoDenegado},
+		{"administrador con cualquier organizador", http.MethodGet, "/organizadores/" + orgY.Hex() + "/reporte", admin, http.StatusNoContent, ""},
+		{"portería registra ingresos", http.MethodPost, "/ingresos", porteria, http.StatusNoContent, ""},
+		{"cliente registra ingresos", http.MethodPost, "/ingresos", cliente, http.StatusForbidden, codigoPermisoDenegado},
+		{"organizador registra ingresos", http.MethodPost, "/ingresos", organizadorX, http.StatusForbidden, codigoPermisoDenegado},
+	}
+	for _, caso := range casos {
+		estado, codigo := solicitar(r, caso.metodo, caso.ruta, caso.token, nil)
+		if estado != caso.estado || codigo != caso.codigo {
+			t.Errorf("%s: %d %s, se esperaba %d %s", caso.nombre, estado, codigo, caso.estado, caso.codigo)
+		}
+	}
+
+	// Al revocar la sesión, el mismo token deja de servir
+	delete(sesiones, cliente)
+	estado, codigo := solicitar(r, http.MethodGet, "/propios/1000000001", cliente, nil)
+	if estado != http.StatusUnauthorized || codigo != codigoSesionInvalida {
+		t.Errorf("sesión revocada: %d %s, se esperaba 401 %s", estado, codigo, codigoSesionInvalida)
+	}
+}
+
+func TestRutasV1RechazanAccesosAjenos(t *testing.T) {
+	sesiones := prepararSesiones(t)
+	r := gin.New()
+	r.Use(gin.CustomRecovery(recuperarPanico))
+	registrarRutasV1(r)
+
+	orgX, orgY := primitive.NewObjectID(), primitive.NewObjectID()
+	organizadorX := sesiones.abrir(Usuario{Cedula: "1000000003", Roles: []string{rolOrganizador}, OrganizadorID: orgX})
+	porteria := sesiones.abrir(Usuario{Cedula: "1000000002", Roles: []string{rolPorteria}, OrganizadorID: orgX})
+	admin := sesiones.abrir(Usuario{Cedula: "1000000005", Roles: []string{rolAdmin}})
+
+	casos := []struct {
+		nombre, metodo, ruta, token string
+		estado                      int
+		codigo                      string
+	}{
+		{"reporte de otro organizador", http.MethodGet, "/organizadores/" + orgY.Hex() + "/reporte", organizadorX, http.StatusNotFound, codigoOrganizadorNoEncontrado},
+		{"auditoría sin permiso", http.MethodGet, "/auditoria", organizadorX, http.StatusForbidden, codigoPermisoDenegado},
+		{"portería lista sus sesiones", http.MethodGet, "/usuarios/1000000002/sesiones", porteria, http.StatusForbidden, codigoPermisoDenegado},
+		{"administrador lista sesiones ajenas", http.MethodGet, "/usuarios/1000000003/sesiones", admin, http.StatusForbidden, codigoPermisoDenegado},
+		{"administrador revoca sesión ajena", http.MethodDelete, "/usuarios/1000000003/sesiones/" + primitive.NewObjectID().Hex(), admin, http.StatusForbidden, codigoPermisoDenegado},
+	}
+	for _, caso := range casos {
+		estado, codigo := solicitar(r, caso.metodo, prefijoV1+caso.ruta, caso.token, nil)
+		if estado != caso.estado || codigo != caso.codigo {
+			t.Errorf("%s: %d %s, se esperaba %d %s", caso.nombre, estado, codigo, caso.estado, caso.codigo)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/tunombre/qrtixpro-backend/cifrado"
+	"github.com/tunombre/qrtixpro-backend/fotos"
+)
+
+var llavero *cifrado.Llavero
+
+// cargarLlavero arma el llavero con las claves de la configuración:
+//
+//	CIFRADO_KEKS          lista "id:base64,id:base64" de claves maestras de 32 bytes
+//	CIFRADO_KEK_ACTIVA    id de la clave maestra con la que se cifran los registros nuevos
+//	CIFRADO_CLAVE_INDICE  clave en base64 de los índices ciegos; no debe cambiar nunca
+func cargarLlavero() {
+	keks, err := cifrado.ParsearKEKs(cfg.Cifrado.KEKs)
+	if err != nil {
+		log.Fatal("❌ ERROR: CIFRADO_KEKS inválida: ", err)
+	}
+
+	claveIndice, err := base64.StdEncoding.DecodeString(cfg.Cifrado.ClaveIndice)
+	if err != nil {
+		log.Fatal("❌ ERROR: CIFRADO_CLAVE_INDICE inválida: ", err)
+	}
+
+	llavero, err = cifrado.NuevoLlavero(keks, cfg.Cifrado.KEKActiva, claveIndice)
+	if err != nil {
+		log.Fatal("❌ ERROR: Configuración de cifrado inválida: ", err)
+	}
+}
+
+// filtroCedula busca por el índice ciego de la cédula, ya que el valor se guarda cifrado.
+func filtroCedula(cedula string) bson.M {
+	return bson.M{"cedula_hash": llavero.IndiceCiego("cedula", cedula)}
+}
+
+// filtroCorreo busca por el índice ciego del correo, ya que el valor se guarda cifrado.
+func filtroCorreo(correo string) bson.M {
+	return bson.M{"correo_hash": llavero.IndiceCiego("correo", correo)}
+}
+
+// cifrarCampos cifra los campos con la clave de datos del registro, o con una
+// nueva si clave es nil, y agrega los índices ciegos de cédula y correo. El
+// resultado se puede usar directamente en un $set o en una inserción.
+func cifrarCampos(campos map[string]string, clave *cifrado.ClaveCifrada) (bson.M, error) {
+	var dek []byte
+	var err error
+	if clave == nil {
+		var nueva cifrado.ClaveCifrada
+		dek, nueva, err = llavero.NuevaClave()
+		clave = &nueva
+	} else {
+		dek, err = llavero.Abrir(*clave)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.M{"clave_datos": *clave}
+	for campo, valor := range campos {
+		if campo == "cedula" || campo == "correo" {
+			doc[campo+"_hash"] = llavero.IndiceCiego(campo, valor)
+		}
+		if doc[campo], err = cifrado.Cifrar(dek, valor); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// descifrarCampos descifra en su lugar los campos de un registro cifrado con
+// la clave indicada. Los registros sin clave aún están en texto plano.
+func descifrarCampos(clave *cifrado.ClaveCifrada, campos ...*string) error {
+	if clave == nil {
+		return nil
+	}
+	dek, err := llavero.Abrir(*clave)
+	if err != nil {
+		return err
+	}
+	for _, campo := range campos {
+		if *campo, err = cifrado.Descifrar(dek, *campo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// descifrarUsuario descifra en su lugar los datos personales del usuario.
+func descifrarUsuario(usuario *Usuario) error {
+	return descifrarCampos(usuario.ClaveDatos, &usuario.Cedula, &usuario.Correo, &usuario.Telefono)
+}
+
+// descifrarVenta descifra en su lugar los datos personales del comprador.
+func descifrarVenta(venta *Venta) error {
+	return descifrarCampos(venta.ClaveDatos, &venta.Cedula, &venta.Correo, &venta.Telefono, &venta.Direccion)
+}
+
+// ejecutarRotacionClaves atiende el subcomando "claves rotar": envuelve con la
+// KEK activa todas las claves de datos que usan una KEK anterior. Cuando
+// termina en todas las bases, la KEK anterior se puede retirar de CIFRADO_KEKS.
+func ejecutarRotacionClaves(args []string) {
+	if len(args) != 1 || args[0] != "rotar" {
+		fmt.Fprintln(os.Stderr, "Uso: qrtixpro-backend claves rotar")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	fallo := false
+	for _, b := range basesConectadas() {
+		for _, nombre := range []string{"usuarios", "ventas", "organizadores"} {
+			n, err := reenvolverColeccion(ctx, b.db.Collection(nombre))
+			if err != nil {
+				log.Printf("❌ ERROR: %s: %s: %v", b.nombre, nombre, err)
+				fallo = true
+				continue
+			}
+			log.Printf("✅ %s: %d registros de %s rotados a la KEK %s", b.nombre, n, nombre, llavero.Activa())
+		}
+
+		n, err := fotos.NuevoAlmacen(b.db, llavero).Reenvolver(ctx)
+		if err != nil {
+			log.Printf("❌ ERROR: %s: fotos: %v", b.nombre, err)
+			fallo = true
+			continue
+		}
+		log.Printf("✅ %s: %d fotos rotadas a la KEK %s", b.nombre, n, llavero.Activa())
+	}
+
+	if fallo {
+		os.Exit(1)
+	}
+}
+
+func reenvolverColeccion(ctx context.Context, coleccion *mongo.Collection) (int, error) {
+	cursor, err := coleccion.Find(ctx, bson.M{
+		"clave_datos":     bson.M{"$exists": true},
+		"clave_datos.kek": bson.M{"$ne": llavero.Activa()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	rotados := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID         primitive.ObjectID   `bson:"_id"`
+			ClaveDatos cifrado.ClaveCifrada `bson:"clave_datos"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return rotados, err
+		}
+
+		clave, cambio, err := llavero.Reenvolver(doc.ClaveDatos)
+		if err != nil {
+			return rotados, err
+		}
+		if !cambio {
+			continue
+		}
+		if _, err := coleccion.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"clave_datos": clave}}); err != nil {
+			return rotados, err
+		}
+		rotados++
+	}
+	return rotados, cursor.Err()
+}
@@ -0,0 +1,225 @@
+// Package cifrado implementa el cifrado por campo de los datos personales.
+//
+// Cada registro tiene su propia clave de datos (DEK) aleatoria, con la que se
+// cifran sus campos usando AES-256-GCM. La DEK se guarda junto al registro
+// envuelta con una clave maestra (KEK) tomada de la configuración. Rotar la KEK
+// solo obliga a reenvolver las DEK, no a volver a cifrar los datos.
+//
+// Para poder buscar por cédula y correo sin descifrar, el paquete calcula
+// además índices ciegos: un HMAC-SHA256 determinista del valor normalizado.
+package cifrado
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefijo marca los valores cifrados. Los valores sin prefijo son texto plano
+// de registros que aún no pasaron por la migración de cifrado.
+const prefijo = "enc:v1:"
+
+var (
+	// ErrKEKDesconocida indica que una DEK fue envuelta con una KEK que ya no está configurada.
+	ErrKEKDesconocida = errors.New("la clave maestra del registro no está configurada")
+	// ErrValorCorrupto indica que un valor cifrado no se pudo descifrar.
+	ErrValorCorrupto = errors.New("el valor cifrado está corrupto o fue alterado")
+)
+
+// ClaveCifrada es una DEK envuelta con la KEK identificada por KEK.
+type ClaveCifrada struct {
+	KEK   string `bson:"kek"`
+	Clave []byte `bson:"clave"`
+}
+
+// Llavero contiene las KEK configuradas y la clave de los índices ciegos.
+// Las DEK nuevas siempre se envuelven con la KEK activa; las anteriores se
+// conservan para poder abrir los registros que aún no se rotaron.
+type Llavero struct {
+	keks        map[string][]byte
+	activa      string
+	claveIndice []byte
+}
+
+// NuevoLlavero crea un llavero. keks asocia un identificador de versión con
+// una clave de 32 bytes; activa es la versión con la que se envuelven las DEK
+// nuevas. claveIndice debe tener al menos 32 bytes y no cambiar nunca, porque
+// los índices ciegos ya guardados dependen de ella.
+func NuevoLlavero(keks map[string][]byte, activa string, claveIndice []byte) (*Llavero, error) {
+	if _, ok := keks[activa]; !ok {
+		return nil, fmt.Errorf("la KEK activa %q no está entre las configuradas", activa)
+	}
+	for id, kek := range keks {
+		if len(kek) != 32 {
+			return nil, fmt.Errorf("la KEK %q debe tener 32 bytes, tiene %d", id, len(kek))
+		}
+	}
+	if len(claveIndice) < 32 {
+		return nil, errors.New("la clave de índices ciegos debe tener al menos 32 bytes")
+	}
+	return &Llavero{keks: keks, activa: activa, claveIndice: claveIndice}, nil
+}
+
+// ParsearKEKs interpreta una lista "id:base64,id:base64" de claves maestras.
+func ParsearKEKs(lista string) (map[string][]byte, error) {
+	keks := make(map[string][]byte)
+	for _, parte := range strings.Split(lista, ",") {
+		parte = strings.TrimSpace(parte)
+		if parte == "" {
+			continue
+		}
+		id, valor, ok := strings.Cut(parte, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("KEK mal formada: se esperaba id:base64")
+		}
+		kek, err := base64.StdEncoding.DecodeString(valor)
+		if err != nil {
+			return nil, fmt.Errorf("KEK %q: %w", id, err)
+		}
+		keks[id] = kek
+	}
+	return keks, nil
+}
+
+// Activa devuelve el identificador de la KEK activa.
+func (l *Llavero) Activa() string {
+	return l.activa
+}
+
+// NuevaClave genera una DEK y la devuelve junto con su versión envuelta.
+func (l *Llavero) NuevaClave() ([]byte, ClaveCifrada, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, ClaveCifrada{}, err
+	}
+	envuelta, err := sellar(l.keks[l.activa], dek)
+	if err != nil {
+		return nil, ClaveCifrada{}, err
+	}
+	return dek, ClaveCifrada{KEK: l.activa, Clave: envuelta}, nil
+}
+
+// Abrir desenvuelve una DEK.
+func (l *Llavero) Abrir(c ClaveCifrada) ([]byte, error) {
+	kek, ok := l.keks[c.KEK]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKEKDesconocida, c.KEK)
+	}
+	return abrir(kek, c.Clave)
+}
+
+// Reenvolver envuelve de nuevo la DEK con la KEK activa. El segundo valor
+// indica si hubo cambio; es false si la DEK ya usaba la KEK activa.
+func (l *Llavero) Reenvolver(c ClaveCifrada) (ClaveCifrada, bool, error) {
+	if c.KEK == l.activa {
+		return c, false, nil
+	}
+	dek, err := l.Abrir(c)
+	if err != nil {
+		return c, false, err
+	}
+	envuelta, err := sellar(l.keks[l.activa], dek)
+	if err != nil {
+		return c, false, err
+	}
+	return ClaveCifrada{KEK: l.activa, Clave: envuelta}, true, nil
+}
+
+// IndiceCiego calcula el índice determinista de un valor para el campo dado.
+// El campo forma parte del HMAC para que la misma cadena dé índices distintos
+// en campos distintos.
+func (l *Llavero) IndiceCiego(campo, valor string) string {
+	mac := hmac.New(sha256.New, l.claveIndice)
+	mac.Write([]byte(campo))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(valor))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Cifrar cifra un texto con la DEK. El texto vacío se conserva vacío.
+func Cifrar(dek []byte, texto string) (string, error) {
+	if texto == "" {
+		return "", nil
+	}
+	sellado, err := sellar(dek, []byte(texto))
+	if err != nil {
+		return "", err
+	}
+	return prefijo + base64.StdEncoding.EncodeToString(sellado), nil
+}
+
+// Descifrar descifra un valor producido por Cifrar. Los valores sin cifrar se
+// devuelven tal cual.
+func Descifrar(dek []byte, valor string) (string, error) {
+	if !EstaCifrado(valor) {
+		return valor, nil
+	}
+	sellado, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(valor, prefijo))
+	if err != nil {
+		return "", ErrValorCorrupto
+	}
+	texto, err := abrir(dek, sellado)
+	if err != nil {
+		return "", err
+	}
+	return string(texto), nil
+}
+
+// EstaCifrado indica si el valor fue producido por Cifrar.
+func EstaCifrado(valor string) bool {
+	return strings.HasPrefix(valor, prefijo)
+}
+
+// CifrarBytes cifra un contenido binario con la DEK.
+func CifrarBytes(dek, datos []byte) ([]byte, error) {
+	return sellar(dek, datos)
+}
+
+// DescifrarBytes descifra un contenido producido por CifrarBytes.
+func DescifrarBytes(dek, sellado []byte) ([]byte, error) {
+	return abrir(dek, sellado)
+}
+
+// sellar cifra con AES-GCM y antepone el nonce al resultado.
+func sellar(clave, datos []byte) ([]byte, error) {
+	gcm, err := nuevoGCM(clave)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, datos, nil), nil
+}
+
+func abrir(clave, sellado []byte) ([]byte, error) {
+	gcm, err := nuevoGCM(clave)
+	if err != nil {
+		return nil, err
+	}
+	if len(sellado) < gcm.NonceSize() {
+		return nil, ErrValorCorrupto
+	}
+	nonce, datos := sellado[:gcm.NonceSize()], sellado[gcm.NonceSize():]
+	texto, err := gcm.Open(nil, nonce, datos, nil)
+	if err != nil {
+		return nil, ErrValorCorrupto
+	}
+	return texto, nil
+}
+
+func nuevoGCM(clave []byte) (cipher.AEAD, error) {
+	bloque, err := aes.NewCipher(clave)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(bloque)
+}
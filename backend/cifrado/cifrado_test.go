@@ -0,0 +1,260 @@
+package cifrado
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func clavePrueba(t *testing.T, n int) []byte {
+	t.Helper()
+	clave := make([]byte, n)
+	if _, err := rand.Read(clave); err != nil {
+		t.Fatal(err)
+	}
+	return clave
+}
+
+func llaveroPrueba(t *testing.T, keks map[string][]byte, activa string, claveIndice []byte) *Llavero {
+	t.Helper()
+	l, err := NuevoLlavero(keks, activa, claveIndice)
+	if err != nil {
+		t.Fatalf("NuevoLlavero: %v", err)
+	}
+	return l
+}
+
+func TestCifrarYDescifrar(t *testing.T) {
+	l := llaveroPrueba(t, map[string][]byte{"v1": clavePrueba(t, 32)}, "v1", clavePrueba(t, 32))
+	dek, envuelta, err := l.NuevaClave()
+	if err != nil {
+		t.Fatalf("NuevaClave: %v", err)
+	}
+	if envuelta.KEK != "v1" {
+		t.Errorf("KEK = %q, se esperaba v1", envuelta.KEK)
+	}
+
+	abierta, err := l.Abrir(envuelta)
+	if err != nil {
+		t.Fatalf("Abrir: %v", err)
+	}
+	if !bytes.Equal(abierta, dek) {
+		t.Fatal("la DEK abierta no es la generada")
+	}
+
+	for _, texto := range []string{"1020304050", "ana.perez@example.com", "Calle 10 # 5-21, Bogotá"} {
+		cifrado, err := Cifrar(abierta, texto)
+		if err != nil {
+			t.Fatalf("Cifrar(%q): %v", texto, err)
+		}
+		if !EstaCifrado(cifrado) || strings.Contains(cifrado, texto) {
+			t.Errorf("Cifrar(%q) = %q, no parece cifrado", texto, cifrado)
+		}
+		descifrado, err := Descifrar(dek, cifrado)
+		if err != nil {
+			t.Fatalf("Descifrar(%q): %v", cifrado, err)
+		}
+		if descifrado != texto {
+			t.Errorf("Descifrar = %q, se esperaba %q", descifrado, texto)
+		}
+	}
+}
+
+func TestCifrarMismoTextoDistintoResultado(t *testing.T) {
+	dek := clavePrueba(t, 32)
+	a, _ := Cifrar(dek, "1020304050")
+	b, _ := Cifrar(dek, "1020304050")
+	if a == b {
+		t.Error("dos cifrados del mismo texto coinciden; el nonce no cambia")
+	}
+}
+
+func TestTextoVacioYTextoPlano(t *testing.T) {
+	dek := clavePrueba(t, 32)
+	if cifrado, err := Cifrar(dek, ""); err != nil || cifrado != "" {
+		t.Errorf(`Cifrar("") = %q, %v; se esperaba ""`, cifrado, err)
+	}
+	// Los registros que aún no pasaron por la migración se leen tal cual
+	if texto, err := Descifrar(dek, "1020304050"); err != nil || texto != "1020304050" {
+		t.Errorf("Descifrar(texto plano) = %q, %v", texto, err)
+	}
+}
+
+func TestCifrarYDescifrarBytes(t *testing.T) {
+	dek := clavePrueba(t, 32)
+	datos := clavePrueba(t, 1024)
+	sellado, err := CifrarBytes(dek, datos)
+	if err != nil {
+		t.Fatalf("CifrarBytes: %v", err)
+	}
+	abierto, err := DescifrarBytes(dek, sellado)
+	if err != nil {
+		t.Fatalf("DescifrarBytes: %v", err)
+	}
+	if !bytes.Equal(abierto, datos) {
+		t.Error("los bytes descifrados no son los originales")
+	}
+}
+
+func TestDescifrarConClaveIncorrecta(t *testing.T) {
+	dek := clavePrueba(t, 32)
+	cifrado, err := Cifrar(dek, "1020304050")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Descifrar(clavePrueba(t, 32), cifrado); !errors.Is(err, ErrValorCorrupto) {
+		t.Errorf("err = %v, se esperaba ErrValorCorrupto", err)
+	}
+
+	sellado, _ := CifrarBytes(dek, []byte("foto"))
+	if _, err := DescifrarBytes(clavePrueba(t, 32), sellado); !errors.Is(err, ErrValorCorrupto) {
+		t.Errorf("bytes: err = %v, se esperaba ErrValorCorrupto", err)
+	}
+}
+
+func TestDescifrarValorAlterado(t *testing.T) {
+	dek := clavePrueba(t, 32)
+	cifrado, _ := Cifrar(dek, "1020304050")
+	sellado, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(cifrado, prefijo))
+	sellado[len(sellado)-1] ^= 1
+
+	casos := map[string]string{
+		"un bit cambiado":        prefijo + base64.StdEncoding.EncodeToString(sellado),
+		"base64 inválido":        prefijo + "no es base64!",
+		"más corto que el nonce": prefijo + base64.StdEncoding.EncodeToString([]byte("corto")),
+	}
+	for nombre, valor := range casos {
+		t.Run(nombre, func(t *testing.T) {
+			if _, err := Descifrar(dek, valor); !errors.Is(err, ErrValorCorrupto) {
+				t.Errorf("err = %v, se esperaba ErrValorCorrupto", err)
+			}
+		})
+	}
+}
+
+func TestAbrirConKEKIncorrecta(t *testing.T) {
+	claveIndice := clavePrueba(t, 32)
+	original := llaveroPrueba(t, map[string][]byte{"v1": clavePrueba(t, 32)}, "v1", claveIndice)
+	_, envuelta, err := original.NuevaClave()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Otra clave configurada con el mismo identificador
+	impostor := llaveroPrueba(t, map[string][]byte{"v1": clavePrueba(t, 32)}, "v1", claveIndice)
+	if _, err := impostor.Abrir(envuelta); !errors.Is(err, ErrValorCorrupto) {
+		t.Errorf("err = %v, se esperaba ErrValorCorrupto", err)
+	}
+
+	// Una KEK que ya no está configurada
+	sinV1 := llaveroPrueba(t, map[string][]byte{"v2": clavePrueba(t, 32)}, "v2", claveIndice)
+	if _, err := sinV1.Abrir(envuelta); !errors.Is(err, ErrKEKDesconocida) {
+		t.Errorf("err = %v, se esperaba ErrKEKDesconocida", err)
+	}
+}
+
+func TestReenvolverTrasRotacion(t *testing.T) {
+	v1, v2 := clavePrueba(t, 32), clavePrueba(t, 32)
+	claveIndice := clavePrueba(t, 32)
+	antes := llaveroPrueba(t, map[string][]byte{"v1": v1}, "v1", claveIndice)
+	dek, envuelta, err := antes.NuevaClave()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cifrado, _ := Cifrar(dek, "ana.perez@example.com")
+
+	rotado := llaveroPrueba(t, map[string][]byte{"v1": v1, "v2": v2}, "v2", claveIndice)
+	nueva, cambio, err := rotado.Reenvolver(envuelta)
+	if err != nil {
+		t.Fatalf("Reenvolver: %v", err)
+	}
+	if !cambio || nueva.KEK != "v2" {
+		t.Fatalf("Reenvolver = %+v, %v; se esperaba la KEK v2", nueva, cambio)
+	}
+
+	// Ya sin v1, la DEK reenvuelta sigue abriendo los datos cifrados antes
+	soloV2 := llaveroPrueba(t, map[string][]byte{"v2": v2}, "v2", claveIndice)
+	abierta, err := soloV2.Abrir(nueva)
+	if err != nil {
+		t.Fatalf("Abrir: %v", err)
+	}
+	if texto, err := Descifrar(abierta, cifrado); err != nil || texto != "ana.perez@example.com" {
+		t.Errorf("Descifrar = %q, %v", texto, err)
+	}
+	if _, err := soloV2.Abrir(envuelta); !errors.Is(err, ErrKEKDesconocida) {
+		t.Errorf("la DEK sin reenvolver: err = %v, se esperaba ErrKEKDesconocida", err)
+	}
+
+	// Reenvolver una DEK que ya usa la KEK activa no la cambia
+	igual, cambio, err := rotado.Reenvolver(nueva)
+	if err != nil || cambio || !bytes.Equal(igual.Clave, nueva.Clave) {
+		t.Errorf("Reenvolver con la KEK activa = %+v, %v, %v", igual, cambio, err)
+	}
+}
+
+func TestIndiceCiego(t *testing.T) {
+	claveIndice := clavePrueba(t, 32)
+	l := llaveroPrueba(t, map[string][]byte{"v1": clavePrueba(t, 32)}, "v1", claveIndice)
+
+	a := l.IndiceCiego("correo", "Ana.Perez@Example.com ")
+	if b := l.IndiceCiego("correo", "ana.perez@example.com"); a != b {
+		t.Error("el índice no normaliza mayúsculas y espacios")
+	}
+	if b := l.IndiceCiego("cedula", "ana.perez@example.com"); a == b {
+		t.Error("el mismo valor da el mismo índice en campos distintos")
+	}
+	if len(a) != 64 {
+		t.Errorf("len(índice) = %d, se esperaba 64", len(a))
+	}
+
+	// No depende de las KEK, solo de la clave de índices
+	rotado := llaveroPrueba(t, map[string][]byte{"v2": clavePrueba(t, 32)}, "v2", claveIndice)
+	if b := rotado.IndiceCiego("correo", "ana.perez@example.com"); a != b {
+		t.Error("el índice cambió al rotar la KEK")
+	}
+	otro := llaveroPrueba(t, map[string][]byte{"v1": clavePrueba(t, 32)}, "v1", clavePrueba(t, 32))
+	if b := otro.IndiceCiego("correo", "ana.perez@example.com"); a == b {
+		t.Error("el índice no depende de la clave de índices")
+	}
+}
+
+func TestNuevoLlaveroValidaClaves(t *testing.T) {
+	casos := []struct {
+		nombre      string
+		keks        map[string][]byte
+		activa      string
+		claveIndice []byte
+	}{
+		{"activa sin configurar", map[string][]byte{"v1": clavePrueba(t, 32)}, "v2", clavePrueba(t, 32)},
+		{"KEK corta", map[string][]byte{"v1": clavePrueba(t, 16)}, "v1", clavePrueba(t, 32)},
+		{"clave de índices corta", map[string][]byte{"v1": clavePrueba(t, 32)}, "v1", clavePrueba(t, 16)},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			if _, err := NuevoLlavero(caso.keks, caso.activa, caso.claveIndice); err == nil {
+				t.Error("se esperaba un error")
+			}
+		})
+	}
+}
+
+func TestParsearKEKs(t *testing.T) {
+	v1, v2 := clavePrueba(t, 32), clavePrueba(t, 32)
+	lista := "v1:" + base64.StdEncoding.EncodeToString(v1) + ", v2:" + base64.StdEncoding.EncodeToString(v2) + ","
+	keks, err := ParsearKEKs(lista)
+	if err != nil {
+		t.Fatalf("ParsearKEKs: %v", err)
+	}
+	if len(keks) != 2 || !bytes.Equal(keks["v1"], v1) || !bytes.Equal(keks["v2"], v2) {
+		t.Errorf("ParsearKEKs = %v", keks)
+	}
+
+	for _, mala := range []string{"sin-separador", ":" + base64.StdEncoding.EncodeToString(v1), "v1:no es base64!"} {
+		if _, err := ParsearKEKs(mala); err == nil {
+			t.Errorf("ParsearKEKs(%q): se esperaba un error", mala)
+		}
+	}
+}
@@ -0,0 +1,611 @@
+// Package config carga la configuración del backend desde, en orden de
+// prioridad creciente: los valores por defecto, un archivo YAML opcional, el
+// archivo .env y las variables de entorno.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// ArchivoPorDefecto es el YAML que se lee si existe y CONFIG_ARCHIVO no indica otro.
+const ArchivoPorDefecto = "config.yaml"
+
+// Entornos de ejecución reconocidos.
+const (
+	EntornoDesarrollo = "desarrollo"
+	EntornoProduccion = "produccion"
+)
+
+// Config reúne toda la configuración del backend.
+type Config struct {
+	// Entorno es "desarrollo" o "produccion". Algunas opciones inseguras solo
+	// se permiten en desarrollo.
+	Entorno   string    `yaml:"entorno"`
+	Servidor  Servidor  `yaml:"servidor"`
+	Mongo     Mongo     `yaml:"mongo"`
+	FacePP    FacePP    `yaml:"facepp"`
+	Cifrado   Cifrado   `yaml:"cifrado"`
+	Retencion Retencion `yaml:"retencion"`
+	Logs      Logs      `yaml:"logs"`
+	Trazas    Trazas    `yaml:"trazas"`
+	Limites   Limites   `yaml:"limites"`
+	Correo    Correo    `yaml:"correo"`
+	WebAuthn  WebAuthn  `yaml:"webauthn"`
+	Google    Google    `yaml:"google"`
+}
+
+// Servidor configura el servidor HTTP.
+type Servidor struct {
+	Direccion    string   `yaml:"direccion"`
+	OrigenesCORS []string `yaml:"origenes_cors"`
+	// TimeoutApagado es cuánto se espera a las solicitudes en curso al recibir SIGTERM.
+	TimeoutApagado Duracion `yaml:"timeout_apagado"`
+}
+
+// Mongo configura las conexiones a MongoDB Atlas y a la réplica local.
+type Mongo struct {
+	URI                  string   `yaml:"uri"`
+	URILocal             string   `yaml:"uri_local"`
+	BaseDatos            string   `yaml:"base_datos"`
+	TimeoutConexion      Duracion `yaml:"timeout_conexion"`
+	TimeoutConexionLocal Duracion `yaml:"timeout_conexion_local"`
+	TimeoutConsulta      Duracion `yaml:"timeout_consulta"`
+	TLS                  TLS      `yaml:"tls"`
+}
+
+// TLS configura la verificación del certificado de MongoDB Atlas y la
+// autenticación con certificado de cliente (X.509).
+type TLS struct {
+	// ArchivoCA es un bundle PEM de CA que se suma a las del sistema.
+	ArchivoCA string `yaml:"archivo_ca"`
+	// CertificadoCliente es el certificado PEM de cliente. Si no se indica
+	// ClaveCliente, el mismo archivo debe incluir la clave privada.
+	CertificadoCliente string `yaml:"certificado_cliente"`
+	ClaveCliente       string `yaml:"clave_cliente"`
+	// Inseguro desactiva la verificación del certificado del servidor. Solo
+	// se acepta en el entorno de desarrollo.
+	Inseguro bool `yaml:"inseguro"`
+}
+
+// FacePP configura el proveedor de verificación facial.
+type FacePP struct {
+	URL             string   `yaml:"url"`
+	APIKey          string   `yaml:"api_key"`
+	APISecret       string   `yaml:"api_secret"`
+	UmbralConfianza float64  `yaml:"umbral_confianza"`
+	Timeout         Duracion `yaml:"timeout"`
+}
+
+// Cifrado contiene las claves del cifrado por campo (ver el paquete cifrado).
+type Cifrado struct {
+	KEKs        string `yaml:"keks"`
+	KEKActiva   string `yaml:"kek_activa"`
+	ClaveIndice string `yaml:"clave_indice"`
+}
+
+// Logs configura el registro estructurado.
+type Logs struct {
+	// Nivel es debug, info, warn o error.
+	Nivel string `yaml:"nivel"`
+}
+
+// Trazas configura la exportación de trazas de OpenTelemetry.
+type Trazas struct {
+	// Exportador es "ninguno", "otlp" o "stdout".
+	Exportador string `yaml:"exportador"`
+	// Endpoint es la URL del colector OTLP/HTTP. Si está vacío se usan las
+	// variables OTEL_EXPORTER_OTLP_* estándar.
+	Endpoint string `yaml:"endpoint"`
+	// Muestreo es la fracción de trazas nuevas que se guardan, entre 0 y 1.
+	Muestreo float64 `yaml:"muestreo"`
+}
+
+// Limites configura los límites de frecuencia y el bloqueo por intentos
+// fallidos de las rutas de autenticación.
+type Limites struct {
+	// Almacen es "memoria" (por instancia) o "mongo" (compartido).
+	Almacen string `yaml:"almacen"`
+	// PorIP limita las solicitudes de autenticación de cada dirección IP.
+	PorIP Cubeta `yaml:"por_ip"`
+	// PorIdentificador limita los intentos sobre una misma cédula o correo,
+	// vengan de donde vengan.
+	PorIdentificador Cubeta `yaml:"por_identificador"`
+	// IntentosFallidos es el número de contraseñas o rostros rechazados en
+	// VentanaFallos que bloquean la cuenta durante Bloqueo.
+	IntentosFallidos int      `yaml:"intentos_fallidos"`
+	VentanaFallos    Duracion `yaml:"ventana_fallos"`
+	Bloqueo          Duracion `yaml:"bloqueo"`
+	// ReenvioConfirmacion limita los reenvíos del enlace de confirmación de
+	// un mismo correo.
+	ReenvioConfirmacion Cubeta `yaml:"reenvio_confirmacion"`
+}
+
+// Cubeta permite Capacidad solicitudes seguidas y recupera la capacidad
+// completa en Periodo.
+type Cubeta struct {
+	Capacidad int      `yaml:"capacidad"`
+	Periodo   Duracion `yaml:"periodo"`
+}
+
+// Correo configura el envío de correos transaccionales.
+type Correo struct {
+	// Servidor es el host:puerto SMTP. Vacío, en desarrollo, los correos se
+	// escriben en los logs en lugar de enviarse.
+	Servidor   string `yaml:"servidor"`
+	Usuario    string `yaml:"usuario"`
+	Contrasena string `yaml:"contrasena"`
+	Remitente  string `yaml:"remitente"`
+	// URLRestablecer es la pantalla del frontend que recibe el token para
+	// restablecer la contraseña como parámetro "token".
+	URLRestablecer string `yaml:"url_restablecer"`
+	// VigenciaRestablecer es cuánto vale un enlace para restablecer la contraseña.
+	VigenciaRestablecer Duracion `yaml:"vigencia_restablecer"`
+	// URLConfirmar es la pantalla del frontend que recibe el token de
+	// confirmación de correo como parámetro "token".
+	URLConfirmar         string   `yaml:"url_confirmar"`
+	VigenciaConfirmacion Duracion `yaml:"vigencia_confirmacion"`
+}
+
+// WebAuthn configura el inicio de sesión con llaves de acceso (passkeys).
+type WebAuthn struct {
+	// RPID es el dominio al que quedan ligadas las llaves, sin esquema ni
+	// puerto. Cambiarlo invalida las llaves ya registradas.
+	RPID   string `yaml:"rp_id"`
+	Nombre string `yaml:"nombre"`
+	// Origenes son los orígenes del frontend desde los que se aceptan las
+	// ceremonias.
+	Origenes []string `yaml:"origenes"`
+	// VigenciaCeremonia es cuánto tiene el navegador para responder un desafío.
+	VigenciaCeremonia Duracion `yaml:"vigencia_ceremonia"`
+}
+
+// Google configura el inicio de sesión con Google.
+type Google struct {
+	// ClienteID es el ID de cliente OAuth del frontend, la audiencia de los
+	// ID tokens. Vacío, /auth/google responde que el servicio no está disponible.
+	ClienteID string `yaml:"cliente_id"`
+	// URLClaves es el JWKS de Google. Solo se cambia en pruebas.
+	URLClaves string `yaml:"url_claves"`
+}
+
+// Retencion sobrescribe la duración de las políticas de retención por nombre.
+type Retencion struct {
+	Politicas map[string]Duracion `yaml:"politicas"`
+	Intervalo Duracion            `yaml:"intervalo"`
+}
+
+// Duracion es un time.Duration que en YAML y en variables de entorno acepta
+// además días con el sufijo "d", por ejemplo "365d".
+type Duracion time.Duration
+
+// Duration devuelve el valor como time.Duration.
+func (d Duracion) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duracion) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalYAML escribe la duración en el mismo formato que se lee.
+func (d Duracion) MarshalYAML() (any, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML lee la duración con ParsearDuracion.
+func (d *Duracion) UnmarshalYAML(nodo *yaml.Node) error {
+	v, err := ParsearDuracion(nodo.Value)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// ParsearDuracion acepta las duraciones de Go y además días con el sufijo "d".
+func ParsearDuracion(valor string) (Duracion, error) {
+	valor = strings.TrimSpace(valor)
+	if dias, ok := strings.CutSuffix(valor, "d"); ok {
+		n, err := strconv.Atoi(dias)
+		if err != nil {
+			return 0, fmt.Errorf("duración inválida %q", valor)
+		}
+		return Duracion(time.Duration(n) * 24 * time.Hour), nil
+	}
+	d, err := time.ParseDuration(valor)
+	if err != nil {
+		return 0, fmt.Errorf("duración inválida %q", valor)
+	}
+	return Duracion(d), nil
+}
+
+// PorDefecto devuelve la configuración con los valores por defecto.
+func PorDefecto() Config {
+	return Config{
+		Entorno: EntornoProduccion,
+		Servidor: Servidor{
+			Direccion:      ":8080",
+			OrigenesCORS:   []string{"http://localhost:3000"},
+			TimeoutApagado: Duracion(20 * time.Second),
+		},
+		Mongo: Mongo{
+			BaseDatos:            "qrtixpro",
+			TimeoutConexion:      Duracion(10 * time.Second),
+			TimeoutConexionLocal: Duracion(5 * time.Second),
+			TimeoutConsulta:      Duracion(5 * time.Second),
+		},
+		FacePP: FacePP{
+			URL:             "https://api-us.faceplusplus.com/facepp/v3/compare",
+			UmbralConfianza: 70,
+			Timeout:         Duracion(15 * time.Second),
+		},
+		Retencion: Retencion{
+			Politicas: map[string]Duracion{},
+			Intervalo: Duracion(time.Hour),
+		},
+		Logs:   Logs{Nivel: "info"},
+		Trazas: Trazas{Exportador: "ninguno", Muestreo: 1},
+		Limites: Limites{
+			Almacen:             "memoria",
+			PorIP:               Cubeta{Capacidad: 20, Periodo: Duracion(time.Minute)},
+			PorIdentificador:    Cubeta{Capacidad: 5, Periodo: Duracion(time.Minute)},
+			IntentosFallidos:    5,
+			VentanaFallos:       Duracion(15 * time.Minute),
+			Bloqueo:             Duracion(15 * time.Minute),
+			ReenvioConfirmacion: Cubeta{Capacidad: 3, Periodo: Duracion(time.Hour)},
+		},
+		Correo: Correo{
+			Remitente:            "QR-TixPro <no-responder@qrtixpro.com>",
+			URLRestablecer:       "http://localhost:3000/restablecer-contrasena",
+			VigenciaRestablecer:  Duracion(30 * time.Minute),
+			URLConfirmar:         "http://localhost:3000/confirmar-correo",
+			VigenciaConfirmacion: Duracion(48 * time.Hour),
+		},
+		WebAuthn: WebAuthn{
+			RPID:              "localhost",
+			Nombre:            "QR-TixPro",
+			Origenes:          []string{"http://localhost:3000"},
+			VigenciaCeremonia: Duracion(5 * time.Minute),
+		},
+		Google: Google{URLClaves: "https://www.googleapis.com/oauth2/v3/certs"},
+	}
+}
+
+// Cargar lee la configuración y la valida.
+func Cargar() (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("leyendo .env: %w", err)
+	}
+
+	c := PorDefecto()
+
+	archivo, explicito := os.LookupEnv("CONFIG_ARCHIVO")
+	if !explicito {
+		archivo = ArchivoPorDefecto
+	}
+	contenido, err := os.ReadFile(archivo)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(contenido, &c); err != nil {
+			return nil, fmt.Errorf("leyendo %s: %w", archivo, err)
+		}
+	case explicito || !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("leyendo %s: %w", archivo, err)
+	}
+
+	if err := c.aplicarEntorno(); err != nil {
+		return nil, err
+	}
+	if err := c.Validar(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// aplicarEntorno sobrescribe la configuración con las variables de entorno definidas.
+func (c *Config) aplicarEntorno() error {
+	var errs []error
+	texto := func(destino *string, variable string) {
+		if v, ok := os.LookupEnv(variable); ok {
+			*destino = v
+		}
+	}
+	duracion := func(destino *Duracion, variable string) {
+		if v, ok := os.LookupEnv(variable); ok {
+			d, err := ParsearDuracion(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", variable, err))
+				return
+			}
+			*destino = d
+		}
+	}
+	lista := func(destino *[]string, variable string) {
+		if v, ok := os.LookupEnv(variable); ok {
+			*destino = nil
+			for _, elemento := range strings.Split(v, ",") {
+				if elemento = strings.TrimSpace(elemento); elemento != "" {
+					*destino = append(*destino, elemento)
+				}
+			}
+		}
+	}
+
+	texto(&c.Entorno, "ENTORNO")
+	texto(&c.Servidor.Direccion, "DIRECCION_HTTP")
+	duracion(&c.Servidor.TimeoutApagado, "TIMEOUT_APAGADO")
+	lista(&c.Servidor.OrigenesCORS, "CORS_ORIGENES")
+
+	texto(&c.Mongo.URI, "MONGO_URI")
+	texto(&c.Mongo.URILocal, "MONGO_URI_LOCAL")
+	texto(&c.Mongo.BaseDatos, "MONGO_BASE_DATOS")
+	duracion(&c.Mongo.TimeoutConexion, "MONGO_TIMEOUT_CONEXION")
+	duracion(&c.Mongo.TimeoutConexionLocal, "MONGO_TIMEOUT_CONEXION_LOCAL")
+	duracion(&c.Mongo.TimeoutConsulta, "MONGO_TIMEOUT_CONSULTA")
+	texto(&c.Mongo.TLS.ArchivoCA, "MONGO_TLS_CA")
+	texto(&c.Mongo.TLS.CertificadoCliente, "MONGO_TLS_CERTIFICADO")
+	texto(&c.Mongo.TLS.ClaveCliente, "MONGO_TLS_CLAVE")
+	if v, ok := os.LookupEnv("MONGO_TLS_INSEGURO"); ok {
+		inseguro, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("MONGO_TLS_INSEGURO: %w", err))
+		}
+		c.Mongo.TLS.Inseguro = inseguro
+	}
+
+	texto(&c.FacePP.URL, "FACEPP_URL")
+	texto(&c.FacePP.APIKey, "FACEPP_API_KEY")
+	texto(&c.FacePP.APISecret, "FACEPP_API_SECRET")
+	duracion(&c.FacePP.Timeout, "FACEPP_TIMEOUT")
+	if v, ok := os.LookupEnv("FACEPP_UMBRAL"); ok {
+		umbral, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("FACEPP_UMBRAL: %w", err))
+		}
+		c.FacePP.UmbralConfianza = umbral
+	}
+
+	texto(&c.Cifrado.KEKs, "CIFRADO_KEKS")
+	texto(&c.Cifrado.KEKActiva, "CIFRADO_KEK_ACTIVA")
+	texto(&c.Cifrado.ClaveIndice, "CIFRADO_CLAVE_INDICE")
+
+	if v, ok := os.LookupEnv("RETENCION"); ok {
+		for _, parte := range strings.Split(v, ",") {
+			if parte = strings.TrimSpace(parte); parte == "" {
+				continue
+			}
+			nombre, valor, ok := strings.Cut(parte, "=")
+			if !ok {
+				errs = append(errs, fmt.Errorf("RETENCION: se esperaba nombre=duración en %q", parte))
+				continue
+			}
+			d, err := ParsearDuracion(valor)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("RETENCION: %w", err))
+				continue
+			}
+			if c.Retencion.Politicas == nil {
+				c.Retencion.Politicas = map[string]Duracion{}
+			}
+			c.Retencion.Politicas[strings.TrimSpace(nombre)] = d
+		}
+	}
+	duracion(&c.Retencion.Intervalo, "RETENCION_INTERVALO")
+
+	texto(&c.Logs.Nivel, "LOG_NIVEL")
+
+	texto(&c.Trazas.Exportador, "TRAZAS_EXPORTADOR")
+	texto(&c.Trazas.Endpoint, "TRAZAS_ENDPOINT")
+	if v, ok := os.LookupEnv("TRAZAS_MUESTREO"); ok {
+		muestreo, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TRAZAS_MUESTREO: %w", err))
+		}
+		c.Trazas.Muestreo = muestreo
+	}
+
+	entero := func(destino *int, variable string) {
+		if v, ok := os.LookupEnv(variable); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", variable, err))
+				return
+			}
+			*destino = n
+		}
+	}
+	texto(&c.Limites.Almacen, "LIMITES_ALMACEN")
+	entero(&c.Limites.PorIP.Capacidad, "LIMITES_IP_CAPACIDAD")
+	duracion(&c.Limites.PorIP.Periodo, "LIMITES_IP_PERIODO")
+	entero(&c.Limites.PorIdentificador.Capacidad, "LIMITES_IDENTIFICADOR_CAPACIDAD")
+	duracion(&c.Limites.PorIdentificador.Periodo, "LIMITES_IDENTIFICADOR_PERIODO")
+	entero(&c.Limites.IntentosFallidos, "LIMITES_INTENTOS_FALLIDOS")
+	duracion(&c.Limites.VentanaFallos, "LIMITES_VENTANA_FALLOS")
+	duracion(&c.Limites.Bloqueo, "LIMITES_BLOQUEO")
+	entero(&c.Limites.ReenvioConfirmacion.Capacidad, "LIMITES_REENVIO_CAPACIDAD")
+	duracion(&c.Limites.ReenvioConfirmacion.Periodo, "LIMITES_REENVIO_PERIODO")
+
+	texto(&c.Correo.Servidor, "CORREO_SERVIDOR")
+	texto(&c.Correo.Usuario, "CORREO_USUARIO")
+	texto(&c.Correo.Contrasena, "CORREO_CONTRASENA")
+	texto(&c.Correo.Remitente, "CORREO_REMITENTE")
+	texto(&c.Correo.URLRestablecer, "CORREO_URL_RESTABLECER")
+	duracion(&c.Correo.VigenciaRestablecer, "CORREO_VIGENCIA_RESTABLECER")
+	texto(&c.Correo.URLConfirmar, "CORREO_URL_CONFIRMAR")
+	duracion(&c.Correo.VigenciaConfirmacion, "CORREO_VIGENCIA_CONFIRMACION")
+
+	texto(&c.WebAuthn.RPID, "WEBAUTHN_RP_ID")
+	texto(&c.WebAuthn.Nombre, "WEBAUTHN_NOMBRE")
+	lista(&c.WebAuthn.Origenes, "WEBAUTHN_ORIGENES")
+	duracion(&c.WebAuthn.VigenciaCeremonia, "WEBAUTHN_VIGENCIA_CEREMONIA")
+
+	texto(&c.Google.ClienteID, "GOOGLE_CLIENTE_ID")
+	texto(&c.Google.URLClaves, "GOOGLE_URL_CLAVES")
+
+	return errors.Join(errs...)
+}
+
+// Validar comprueba que la configuración esté completa y sea coherente.
+// Devuelve todos los problemas encontrados juntos.
+func (c *Config) Validar() error {
+	var errs []error
+	falta := func(valor, nombre string) {
+		if strings.TrimSpace(valor) == "" {
+			errs = append(errs, fmt.Errorf("%s es obligatorio", nombre))
+		}
+	}
+	positiva := func(d Duracion, nombre string) {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s debe ser positivo", nombre))
+		}
+	}
+
+	if c.Entorno != EntornoDesarrollo && c.Entorno != EntornoProduccion {
+		errs = append(errs, fmt.Errorf("entorno (ENTORNO) debe ser %q o %q", EntornoDesarrollo, EntornoProduccion))
+	}
+	falta(c.Servidor.Direccion, "servidor.direccion (DIRECCION_HTTP)")
+	if len(c.Servidor.OrigenesCORS) == 0 {
+		errs = append(errs, errors.New("servidor.origenes_cors (CORS_ORIGENES) necesita al menos un origen"))
+	}
+	positiva(c.Servidor.TimeoutApagado, "servidor.timeout_apagado")
+
+	falta(c.Mongo.URI, "mongo.uri (MONGO_URI)")
+	falta(c.Mongo.BaseDatos, "mongo.base_datos (MONGO_BASE_DATOS)")
+	positiva(c.Mongo.TimeoutConexion, "mongo.timeout_conexion")
+	positiva(c.Mongo.TimeoutConexionLocal, "mongo.timeout_conexion_local")
+	positiva(c.Mongo.TimeoutConsulta, "mongo.timeout_consulta")
+	if c.Mongo.TLS.ClaveCliente != "" && c.Mongo.TLS.CertificadoCliente == "" {
+		errs = append(errs, errors.New("mongo.tls.clave_cliente (MONGO_TLS_CLAVE) requiere mongo.tls.certificado_cliente"))
+	}
+	if c.Mongo.TLS.Inseguro && c.Entorno != EntornoDesarrollo {
+		errs = append(errs, errors.New("mongo.tls.inseguro (MONGO_TLS_INSEGURO) solo se permite con entorno desarrollo"))
+	}
+
+	falta(c.FacePP.URL, "facepp.url (FACEPP_URL)")
+	falta(c.FacePP.APIKey, "facepp.api_key (FACEPP_API_KEY)")
+	falta(c.FacePP.APISecret, "facepp.api_secret (FACEPP_API_SECRET)")
+	positiva(c.FacePP.Timeout, "facepp.timeout")
+	if c.FacePP.UmbralConfianza <= 0 || c.FacePP.UmbralConfianza > 100 {
+		errs = append(errs, errors.New("facepp.umbral_confianza debe estar entre 0 y 100"))
+	}
+
+	falta(c.Cifrado.KEKs, "cifrado.keks (CIFRADO_KEKS)")
+	falta(c.Cifrado.KEKActiva, "cifrado.kek_activa (CIFRADO_KEK_ACTIVA)")
+	falta(c.Cifrado.ClaveIndice, "cifrado.clave_indice (CIFRADO_CLAVE_INDICE)")
+
+	for nombre, d := range c.Retencion.Politicas {
+		positiva(d, "retencion.politicas."+nombre)
+	}
+	positiva(c.Retencion.Intervalo, "retencion.intervalo")
+
+	switch strings.ToLower(c.Logs.Nivel) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, errors.New("logs.nivel (LOG_NIVEL) debe ser debug, info, warn o error"))
+	}
+
+	switch c.Trazas.Exportador {
+	case "ninguno", "otlp", "stdout":
+	default:
+		errs = append(errs, errors.New("trazas.exportador (TRAZAS_EXPORTADOR) debe ser ninguno, otlp o stdout"))
+	}
+	if c.Trazas.Muestreo < 0 || c.Trazas.Muestreo > 1 {
+		errs = append(errs, errors.New("trazas.muestreo (TRAZAS_MUESTREO) debe estar entre 0 y 1"))
+	}
+
+	if c.Limites.Almacen != "memoria" && c.Limites.Almacen != "mongo" {
+		errs = append(errs, errors.New("limites.almacen (LIMITES_ALMACEN) debe ser memoria o mongo"))
+	}
+	capacidad := func(cb Cubeta, nombre string) {
+		if cb.Capacidad <= 0 {
+			errs = append(errs, fmt.Errorf("%s.capacidad debe ser positivo", nombre))
+		}
+		positiva(cb.Periodo, nombre+".periodo")
+	}
+	capacidad(c.Limites.PorIP, "limites.por_ip")
+	capacidad(c.Limites.PorIdentificador, "limites.por_identificador")
+	capacidad(c.Limites.ReenvioConfirmacion, "limites.reenvio_confirmacion")
+	if c.Limites.IntentosFallidos <= 0 {
+		errs = append(errs, errors.New("limites.intentos_fallidos (LIMITES_INTENTOS_FALLIDOS) debe ser positivo"))
+	}
+	positiva(c.Limites.VentanaFallos, "limites.ventana_fallos")
+	positiva(c.Limites.Bloqueo, "limites.bloqueo")
+
+	if c.Correo.Servidor == "" && c.Entorno != EntornoDesarrollo {
+		errs = append(errs, errors.New("correo.servidor (CORREO_SERVIDOR) es obligatorio fuera de desarrollo"))
+	}
+	falta(c.Correo.Remitente, "correo.remitente (CORREO_REMITENTE)")
+	absoluta := func(valor, nombre string) {
+		if u, err := url.Parse(valor); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s debe ser una URL absoluta", nombre))
+		}
+	}
+	absoluta(c.Correo.URLRestablecer, "correo.url_restablecer (CORREO_URL_RESTABLECER)")
+	positiva(c.Correo.VigenciaRestablecer, "correo.vigencia_restablecer")
+	absoluta(c.Correo.URLConfirmar, "correo.url_confirmar (CORREO_URL_CONFIRMAR)")
+	positiva(c.Correo.VigenciaConfirmacion, "correo.vigencia_confirmacion")
+
+	falta(c.WebAuthn.RPID, "webauthn.rp_id (WEBAUTHN_RP_ID)")
+	falta(c.WebAuthn.Nombre, "webauthn.nombre (WEBAUTHN_NOMBRE)")
+	if len(c.WebAuthn.Origenes) == 0 {
+		errs = append(errs, errors.New("webauthn.origenes (WEBAUTHN_ORIGENES) necesita al menos un origen"))
+	}
+	for _, origen := range c.WebAuthn.Origenes {
+		absoluta(origen, "webauthn.origenes (WEBAUTHN_ORIGENES)")
+	}
+	positiva(c.WebAuthn.VigenciaCeremonia, "webauthn.vigencia_ceremonia")
+
+	absoluta(c.Google.URLClaves, "google.url_claves (GOOGLE_URL_CLAVES)")
+
+	return errors.Join(errs...)
+}
+
+const redactado = "[REDACTADO]"
+
+// Redactada devuelve la configuración en YAML con los secretos ocultos, para
+// mostrarla al arrancar.
+func (c *Config) Redactada() string {
+	copia := *c
+	copia.Mongo.URI = redactarURI(c.Mongo.URI)
+	copia.Mongo.URILocal = redactarURI(c.Mongo.URILocal)
+	copia.Trazas.Endpoint = redactarURI(c.Trazas.Endpoint)
+	for _, secreto := range []*string{
+		&copia.FacePP.APIKey, &copia.FacePP.APISecret,
+		&copia.Cifrado.KEKs, &copia.Cifrado.ClaveIndice,
+		&copia.Correo.Contrasena,
+	} {
+		if *secreto != "" {
+			*secreto = redactado
+		}
+	}
+
+	salida, err := yaml.Marshal(copia)
+	if err != nil {
+		return fmt.Sprintf("(no se pudo mostrar la configuración: %v)", err)
+	}
+	return string(salida)
+}
+
+// redactarURI oculta la contraseña de una URI de conexión.
+func redactarURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		if uri == "" {
+			return ""
+		}
+		return redactado
+	}
+	if _, tiene := u.User.Password(); tiene {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/tunombre/qrtixpro-backend/correo"
+	"github.com/tunombre/qrtixpro-backend/mensajes"
+)
+
+// Estados de la cuenta. Los usuarios registrados antes de la confirmación de
+// correo no tienen estado y cuentan como activos.
+const (
+	estadoPendienteVerificacion = "pendiente_verificacion"
+	estadoActivo                = "activo"
+)
+
+// correoVerificado indica si el usuario ya confirmó su correo.
+func (u Usuario) correoVerificado() bool {
+	return u.Estado != estadoPendienteVerificacion
+}
+
+// solicitudConfirmarCorreo es el cuerpo de POST /api/v1/confirmaciones-correo.
+type solicitudConfirmarCorreo struct {
+	Token string `json:"token"`
+}
+
+// solicitudReenviarConfirmacion es el cuerpo de POST /api/v1/confirmaciones-correo/reenvio.
+type solicitudReenviarConfirmacion struct {
+	Correo string `json:"correo"`
+}
+
+// enviarConfirmacion emite un enlace de confirmación para el usuario, anula
+// los anteriores y lo envía a su correo en segundo plano.
+func enviarConfirmacion(ctx context.Context, c *gin.Context, usuarioID primitive.ObjectID, para string) error {
+	vigencia := cfg.Correo.VigenciaConfirmacion.Duration()
+	token, _, err := emitirToken(ctx, confirmacionesCollection, usuarioID, vigencia, true)
+	if err != nil {
+		return err
+	}
+	enviarCorreo(c.Request.Context(), correoConfirmacion(idioma(c), para, token))
+	return nil
+}
+
+// correoConfirmacion arma el correo con el enlace de confirmación al frontend.
+func correoConfirmacion(idioma, para, token string) correo.Mensaje {
+	horas := int(cfg.Correo.VigenciaConfirmacion.Duration().Hours())
+	return correo.Mensaje{
+		Para:   para,
+		Asunto: mensajes.Texto(idioma, "correo.confirmar.asunto"),
+		Texto:  fmt.Sprintf(mensajes.Texto(idioma, "correo.confirmar.texto"), enlaceConToken(cfg.Correo.URLConfirmar, token), horas),
+	}
+}
+
+// confirmarCorreo canjea el enlace del correo y activa la cuenta.
+func confirmarCorreo(c *gin.Context) {
+	var datos solicitudConfirmarCorreo
+
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	if datos.Token == "" {
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuarioID, err := canjearToken(ctx, confirmacionesCollection, datos.Token)
+	if err != nil {
+		if errors.Is(err, errTokenInvalido) {
+			slog.WarnContext(c.Request.Context(), "Token de confirmación de correo inválido")
+			responderError(c, http.StatusBadRequest, codigoTokenInvalido)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al canjear el token de confirmación", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+
+	activar := bson.M{"$set": bson.M{"estado": estadoActivo}}
+	var usuario Usuario
+	err = collection.FindOneAndUpdate(ctx, bson.M{"_id": usuarioID}, activar).Decode(&usuario)
+	if err == nil {
+		err = descifrarUsuario(&usuario)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			responderError(c, http.StatusBadRequest, codigoTokenInvalido)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "No se pudo activar el usuario en MongoDB Atlas", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+	escritoEnAtlas := time.Now()
+
+	// La réplica local tiene otro _id, así que se busca por cédula
+	if collectionLocal != nil && clientLocal != nil {
+		ctxLocal, cancelLocal := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+		defer cancelLocal()
+
+		_, err = collectionLocal.UpdateOne(ctxLocal, filtroCedula(usuario.Cedula), activar)
+		observarReplica("usuarios", escritoEnAtlas, err)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "No se pudo activar el usuario en MongoDB Local", "error", err)
+		}
+	}
+
+	auditar(c, accionCorreoConfirmar, objetivo(objetivoUsuario, usuarioID, usuario.Cedula),
+		bson.M{"estado": usuario.Estado}, bson.M{"estado": estadoActivo})
+
+	slog.InfoContext(c.Request.Context(), "Correo confirmado", "cedula", usuario.Cedula)
+	responderOK(c, http.StatusOK, exitoCorreoConfirmado, nil)
+}
+
+// reenviarConfirmacion envía otro enlace de confirmación. Tiene su propio
+// límite por correo, más estricto que el de las rutas de autenticación, y
+// responde lo mismo si el correo no existe o ya está confirmado.
+func reenviarConfirmacion(c *gin.Context) {
+	var datos solicitudReenviarConfirmacion
+
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	if datos.Correo == "" {
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	clave := "reenvio:" + llavero.IndiceCiego("correo", datos.Correo)
+	permitido, espera, err := almacenLimites.Tomar(ctx, clave, cubeta(cfg.Limites.ReenvioConfirmacion))
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo consultar el límite de reenvíos", "error", err)
+	} else if !permitido {
+		slog.WarnContext(c.Request.Context(), "Límite de reenvíos de confirmación excedido", "correo", datos.Correo)
+		metricaLimitadas.WithLabelValues("identificador").Inc()
+		responderLimitado(c, http.StatusTooManyRequests, codigoLimiteExcedido, espera)
+		return
+	}
+
+	var usuario Usuario
+	err = collection.FindOne(ctx, filtroCorreo(datos.Correo)).Decode(&usuario)
+	if err == nil {
+		err = descifrarUsuario(&usuario)
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		slog.ErrorContext(c.Request.Context(), "Error al buscar usuario en la base de datos", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	if err == nil && !usuario.correoVerificado() {
+		err = enviarConfirmacion(ctx, c, usuario.ID, usuario.Correo)
+	} else {
+		// Mismo trabajo que con un correo pendiente, con un token que no sirve
+		_, _, err = emitirToken(ctx, confirmacionesCollection, primitive.NilObjectID, cfg.Correo.VigenciaConfirmacion.Duration(), true)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo emitir el enlace de confirmación", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Reenvío de confirmación solicitado", "correo", datos.Correo)
+	responderOK(c, http.StatusOK, exitoConfirmacionReenviada, nil)
+}
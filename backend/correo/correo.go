@@ -0,0 +1,124 @@
+// Package correo envía los correos transaccionales del backend, como los
+// enlaces para restablecer la contraseña.
+package correo
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mensaje es un correo de texto plano.
+type Mensaje struct {
+	Para   string
+	Asunto string
+	Texto  string
+}
+
+// Remitente envía mensajes.
+type Remitente interface {
+	Enviar(ctx context.Context, m Mensaje) error
+}
+
+// SMTP envía por un servidor SMTP. Si el servidor ofrece STARTTLS se usa y,
+// con Usuario definido, se autentica con PLAIN, que net/smtp solo permite
+// sobre TLS o contra localhost.
+type SMTP struct {
+	// Servidor es host:puerto, por ejemplo smtp.ejemplo.com:587.
+	Servidor   string
+	Usuario    string
+	Contrasena string
+	// De es la dirección del remitente, con o sin nombre: "QR-TixPro <no-responder@ejemplo.com>".
+	De string
+}
+
+func (s SMTP) Enviar(ctx context.Context, m Mensaje) error {
+	host, _, err := net.SplitHostPort(s.Servidor)
+	if err != nil {
+		return fmt.Errorf("servidor SMTP inválido: %w", err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Servidor)
+	if err != nil {
+		return err
+	}
+	if limite, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(limite)
+	}
+	cliente, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer cliente.Close()
+
+	if ok, _ := cliente.Extension("STARTTLS"); ok {
+		if err := cliente.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if s.Usuario != "" {
+		if err := cliente.Auth(smtp.PlainAuth("", s.Usuario, s.Contrasena, host)); err != nil {
+			return err
+		}
+	}
+
+	de := direccion(s.De)
+	if err := cliente.Mail(de); err != nil {
+		return err
+	}
+	if err := cliente.Rcpt(m.Para); err != nil {
+		return err
+	}
+	w, err := cliente.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(componer(s.De, m)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return cliente.Quit()
+}
+
+// direccion extrae la dirección de "Nombre <dirección>".
+func direccion(de string) string {
+	if i := strings.LastIndex(de, "<"); i >= 0 {
+		return strings.TrimSuffix(de[i+1:], ">")
+	}
+	return de
+}
+
+// componer arma el mensaje con sus encabezados, codificando el asunto para
+// que las tildes lleguen bien.
+func componer(de string, m Mensaje) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", de)
+	fmt.Fprintf(&b, "To: %s\r\n", m.Para)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Asunto))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Texto, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// Registro no envía nada: escribe el mensaje en los logs. Sirve en desarrollo
+// sin servidor SMTP; nunca debe usarse en producción porque los enlaces que
+// contiene quedan en los logs.
+type Registro struct{}
+
+func (Registro) Enviar(ctx context.Context, m Mensaje) error {
+	slog.InfoContext(ctx, "Correo no enviado (sin servidor SMTP)", "para", m.Para, "asunto", m.Asunto, "texto", m.Texto)
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/tunombre/qrtixpro-backend/fotos"
+)
+
+// Tratamiento de datos personales según la Ley 1581 de 2012: el titular puede
+// descargar todos sus datos y pedir su supresión. Las ventas no se borran
+// porque son soporte contable; solo se les quitan los datos de contacto.
+
+// accionSupresion describe lo que se hizo en una colección de una base.
+type accionSupresion struct {
+	Base      string `bson:"base" json:"base"`
+	Coleccion string `bson:"coleccion" json:"coleccion"`
+	Accion    string `bson:"accion" json:"accion"`
+	Cantidad  int64  `bson:"cantidad" json:"cantidad"`
+	Error     string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// registroSupresion queda en la colección supresiones como constancia de cada
+// solicitud atendida. Solo guarda el índice ciego de la cédula.
+type registroSupresion struct {
+	CedulaHash string            `bson:"cedula_hash" json:"-"`
+	Fecha      time.Time         `bson:"fecha" json:"fecha"`
+	Acciones   []accionSupresion `bson:"acciones" json:"acciones"`
+	Completa   bool              `bson:"completa" json:"completa"`
+}
+
+// exportarDatosPersonales devuelve en JSON todos los datos personales que
+// guardamos del titular: perfil, foto, compras e inicios de sesión.
+func exportarDatosPersonales(c *gin.Context) {
+	cedula := c.Param("cedula")
+
+	ctx, cancel := contextoSolicitud(c, 15*time.Second)
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, cedula)
+	if !ok {
+		return
+	}
+
+	var foto string
+	if usuario.FotoID.IsZero() {
+		foto = usuario.Foto
+	} else if datos, err := fotosAtlas.Leer(ctx, usuario.FotoID); err != nil {
+		slog.WarnContext(ctx, "No se pudo leer la foto para la exportación", "error", err)
+	} else {
+		foto = "data:" + http.DetectContentType(datos) + ";base64," + base64.StdEncoding.EncodeToString(datos)
+	}
+
+	ventas := []Venta{}
+	cursor, err := ventasCollection.Find(ctx, filtroCedula(cedula))
+	if err == nil {
+		err = cursor.All(ctx, &ventas)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "No se pudieron leer las ventas para la exportación", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	for i := range ventas {
+		if err := descifrarVenta(&ventas[i]); err != nil {
+			slog.ErrorContext(ctx, "No se pudo descifrar una venta para la exportación", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+			return
+		}
+	}
+
+	logs := []inicioSesion{}
+	cursor, err = logsCollection.Find(ctx, filtroIniciosSesion(usuario))
+	if err == nil {
+		err = cursor.All(ctx, &logs)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "No se pudieron leer los inicios de sesión para la exportación", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	slog.InfoContext(ctx, "Datos personales exportados", "cedula", cedula)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="datos-%s.json"`, cedula))
+	responderOK(c, http.StatusOK, "", gin.H{
+		"generado_en": time.Now(),
+		"usuario": gin.H{
+			"nombres":      usuario.Nombres,
+			"apellidos":    usuario.Apellidos,
+			"cedula":       usuario.Cedula,
+			"correo":       usuario.Correo,
+			"telefono":     usuario.Telefono,
+			"ultimaSesion": usuario.UltimaSesion,
+		},
+		"foto":           foto,
+		"ventas":         ventas,
+		"inicios_sesion": logs,
+	})
+}
+
+// solicitarSupresion atiende la solicitud de supresión del propio titular.
+func solicitarSupresion(c *gin.Context) {
+	cedula := c.Param("cedula")
+
+	ctx, cancel := contextoSolicitud(c, 15*time.Second)
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, cedula)
+	if !ok {
+		return
+	}
+
+	registro, err := suprimirDatosPersonales(ctx, usuario, cedula)
+	if err != nil {
+		slog.ErrorContext(ctx, "No se pudo completar la supresión en MongoDB Atlas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	auditar(c, accionUsuarioSuprimir, objetivo(objetivoUsuario, usuario.ID, cedula), nil, nil)
+	slog.InfoContext(ctx, "Datos personales suprimidos", "cedula", cedula)
+	responderOK(c, http.StatusOK, exitoDatosSuprimidos, registro)
+}
+
+// suprimirDatosPersonales borra el usuario, su foto, sus sesiones y sus
+// inicios de sesión, y anonimiza sus ventas, en MongoDB Atlas y en MongoDB Local. Un error en Atlas
+// detiene el proceso; los de la base local quedan anotados en la constancia
+// para volver a intentar. La constancia se guarda en la colección supresiones.
+func suprimirDatosPersonales(ctx context.Context, usuario Usuario, cedula string) (registroSupresion, error) {
+	registro := registroSupresion{
+		CedulaHash: llavero.IndiceCiego("cedula", cedula),
+		Fecha:      time.Now(),
+		Completa:   true,
+	}
+
+	for i, b := range basesConectadas() {
+		acciones, err := suprimirEnBase(ctx, b, usuario, cedula)
+		registro.Acciones = append(registro.Acciones, acciones...)
+		if err != nil {
+			if i == 0 {
+				return registro, err
+			}
+			slog.WarnContext(ctx, "No se pudo completar la supresión", "base", b.nombre, "error", err)
+			registro.Completa = false
+		}
+	}
+
+	if _, err := client.Database(cfg.Mongo.BaseDatos).Collection("supresiones").InsertOne(ctx, registro); err != nil {
+		slog.WarnContext(ctx, "No se pudo guardar la constancia de supresión", "error", err)
+	}
+	return registro, nil
+}
+
+func suprimirEnBase(ctx context.Context, b baseConectada, usuario Usuario, cedula string) ([]accionSupresion, error) {
+	var acciones []accionSupresion
+	anotar := func(coleccion, accion string, cantidad int64, err error) error {
+		a := accionSupresion{Base: b.nombre, Coleccion: coleccion, Accion: accion, Cantidad: cantidad}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		acciones = append(acciones, a)
+		return err
+	}
+
+	// Las ventas se conservan como soporte contable, sin datos de contacto
+	resVentas, err := b.db.Collection("ventas").UpdateMany(ctx, filtroCedula(cedula), bson.M{
+		"$unset": bson.M{"correo": "", "correo_hash": "", "telefono": "", "direccion": ""},
+		"$set":   bson.M{"anonimizada_en": time.Now()},
+	})
+	var anonimizadas int64
+	if resVentas != nil {
+		anonimizadas = resVentas.ModifiedCount
+	}
+	if err := anotar("ventas", "anonimizar", anonimizadas, err); err != nil {
+		return acciones, err
+	}
+
+	resSesiones, err := b.db.Collection("sesiones").DeleteMany(ctx, bson.M{"usuario_id": usuario.ID})
+	var cerradas int64
+	if resSesiones != nil {
+		cerradas = resSesiones.DeletedCount
+	}
+	if err := anotar("sesiones", "eliminar", cerradas, err); err != nil {
+		return acciones, err
+	}
+
+	resLogs, err := b.db.Collection("logs").DeleteMany(ctx, filtroIniciosSesion(usuario))
+	var borrados int64
+	if resLogs != nil {
+		borrados = resLogs.DeletedCount
+	}
+	if err := anotar("logs", "eliminar", borrados, err); err != nil {
+		return acciones, err
+	}
+
+	if !usuario.FotoID.IsZero() {
+		err := fotos.NuevoAlmacen(b.db, llavero).Eliminar(ctx, usuario.FotoID)
+		if err := anotar(fotos.Bucket, "eliminar", 1, err); err != nil {
+			return acciones, err
+		}
+	}
+
+	resUsuario, err := b.db.Collection("usuarios").DeleteOne(ctx, filtroCedula(cedula))
+	var eliminados int64
+	if resUsuario != nil {
+		eliminados = resUsuario.DeletedCount
+	}
+	if err := anotar("usuarios", "eliminar", eliminados, err); err != nil {
+		return acciones, err
+	}
+
+	return acciones, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Evento es una función de un organizador en uno de sus escenarios. Los
+// precios son por zona del escenario y el servidor los usa para calcular el
+// total de cada venta.
+type Evento struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OrganizadorID primitive.ObjectID `json:"organizador" bson:"organizador_id"`
+	Nombre        string             `json:"nombre" bson:"nombre"`
+	Descripcion   string             `json:"descripcion,omitempty" bson:"descripcion,omitempty"`
+	Fecha         time.Time          `json:"fecha" bson:"fecha"`
+	EscenarioID   primitive.ObjectID `json:"escenario" bson:"escenario_id"`
+	Precios       []PrecioZona       `json:"precios" bson:"precios"`
+	// Publicado marca los eventos que aparecen en la cartelera y se pueden
+	// comprar.
+	Publicado bool      `json:"publicado" bson:"publicado"`
+	CreadoEn  time.Time `json:"creado_en" bson:"creado_en"`
+}
+
+type PrecioZona struct {
+	Zona   string  `json:"zona" bson:"zona"`
+	Precio float64 `json:"precio" bson:"precio"`
+}
+
+// precio devuelve el precio de una boleta de la zona.
+func (e Evento) precio(zona string) (float64, bool) {
+	for _, p := range e.Precios {
+		if p.Zona == zona {
+			return p.Precio, true
+		}
+	}
+	return 0, false
+}
+
+// validarEvento comprueba el evento contra los escenarios del organizador.
+// Devuelve, por campo, la clave del error de validación.
+func validarEvento(e Evento, organizador Organizador) map[string]string {
+	errores := make(map[string]string)
+	if e.Nombre == "" {
+		errores["nombre"] = "evento.nombre"
+	}
+	if e.Fecha.IsZero() {
+		errores["fecha"] = "evento.fecha"
+	}
+	escenario, ok := organizador.escenario(e.EscenarioID)
+	if !ok {
+		errores["escenario"] = "evento.escenario"
+		return errores
+	}
+	if len(e.Precios) == 0 {
+		errores["precios"] = "evento.precios"
+	}
+	for _, p := range e.Precios {
+		existe := false
+		for _, z := range escenario.Zonas {
+			existe = existe || z.Nombre == p.Zona
+		}
+		if !existe || p.Precio <= 0 {
+			errores["precios"] = "evento.precios"
+		}
+	}
+	return errores
+}
+
+// crearEvento agrega un evento al organizador de la ruta.
+func crearEvento(c *gin.Context) {
+	var evento Evento
+	if err := c.ShouldBindJSON(&evento); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	organizador, ok := buscarOrganizador(c)
+	if !ok {
+		return
+	}
+	if errores := validarEvento(evento, organizador); len(errores) > 0 {
+		responderValidacion(c, errores)
+		return
+	}
+
+	evento.ID = primitive.NewObjectID()
+	evento.OrganizadorID = organizador.ID
+	evento.CreadoEn = time.Now()
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	if _, err := eventosCollection.InsertOne(ctx, evento); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo crear el evento", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	auditar(c, accionEventoCrear, objetivo(objetivoEvento, evento.ID, ""), nil, evento)
+
+	slog.InfoContext(c.Request.Context(), "Evento creado", "evento", evento.ID.Hex(), "organizador", organizador.ID.Hex())
+	responderOK(c, http.StatusCreated, exitoEventoCreado, evento)
+}
+
+// listarEventosOrganizador devuelve todos los eventos del organizador de la
+// ruta, publicados o no.
+func listarEventosOrganizador(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("organizador"))
+	if err != nil {
+		responderError(c, http.StatusNotFound, codigoOrganizadorNoEncontrado)
+		return
+	}
+	listarEventos(c, bson.M{"organizador_id": id})
+}
+
+// listarCartelera devuelve los eventos publicados que aún no han pasado, de
+// todos los organizadores. Es pública.
+func listarCartelera(c *gin.Context) {
+	listarEventos(c, bson.M{"publicado": true, "fecha": bson.M{"$gte": time.Now()}})
+}
+
+func listarEventos(c *gin.Context, filtro bson.M) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	eventos := []Evento{}
+	cursor, err := eventosCollection.Find(ctx, filtro, options.Find().SetSort(bson.D{{Key: "fecha", Value: 1}}))
+	if err == nil {
+		err = cursor.All(ctx, &eventos)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron leer los eventos", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	responderOK(c, http.StatusOK, "", eventos)
+}
+
+// cambiosEvento es el cuerpo de la actualización de un evento. Publicado es
+// un puntero para distinguir false de un campo que no llegó.
+type cambiosEvento struct {
+	Evento
+	Publicado *bool `json:"publicado"`
+}
+
+// actualizarEvento cambia los campos enviados de un evento del organizador
+// de la ruta.
+func actualizarEvento(c *gin.Context) {
+	var cambios cambiosEvento
+	if err := c.ShouldBindJSON(&cambios); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	organizador, ok := buscarOrganizador(c)
+	if !ok {
+		return
+	}
+	eventoID, err := primitive.ObjectIDFromHex(c.Param("evento"))
+	if err != nil {
+		responderError(c, http.StatusNotFound, codigoEventoNoEncontrado)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	// El filtro por organizador impide editar eventos de otro
+	filtro := bson.M{"_id": eventoID, "organizador_id": organizador.ID}
+	var evento Evento
+	if err := eventosCollection.FindOne(ctx, filtro).Decode(&evento); err != nil {
+		if err == mongo.ErrNoDocuments {
+			responderError(c, http.StatusNotFound, codigoEventoNoEncontrado)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al buscar el evento", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+
+	antes := evento
+	if cambios.Nombre != "" {
+		evento.Nombre = cambios.Nombre
+	}
+	if cambios.Descripcion != "" {
+		evento.Descripcion = cambios.Descripcion
+	}
+	if !cambios.Fecha.IsZero() {
+		evento.Fecha = cambios.Fecha
+	}
+	if !cambios.EscenarioID.IsZero() {
+		evento.EscenarioID = cambios.EscenarioID
+	}
+	if cambios.Precios != nil {
+		evento.Precios = cambios.Precios
+	}
+	if cambios.Publicado != nil {
+		evento.Publicado = *cambios.Publicado
+	}
+	if errores := validarEvento(evento, organizador); len(errores) > 0 {
+		responderValidacion(c, errores)
+		return
+	}
+
+	if _, err := eventosCollection.ReplaceOne(ctx, filtro, evento); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo actualizar el evento", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	auditar(c, accionEventoActualizar, objetivo(objetivoEvento, evento.ID, ""), antes, evento)
+
+	slog.InfoContext(c.Request.Context(), "Evento actualizado", "evento", evento.ID.Hex(), "organizador", organizador.ID.Hex())
+	responderOK(c, http.StatusOK, exitoEventoActualizado, evento)
+}
+
+// precioDeEvento calcula el total de la venta con el precio de su zona en el
+// evento y la asigna al organizador del evento. Si el evento no está a la
+// venta responde 404 y, si no tiene esa zona, 400; en ambos casos devuelve
+// false.
+func precioDeEvento(c *gin.Context, venta *Venta) bool {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	var evento Evento
+	err := eventosCollection.FindOne(ctx, bson.M{"_id": venta.EventoID, "publicado": true}).Decode(&evento)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			responderError(c, http.StatusNotFound, codigoEventoNoEncontrado)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al buscar el evento", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return false
+	}
+	precio, ok := evento.precio(venta.Zona)
+	if !ok {
+		responderValidacion(c, map[string]string{"zona": "zona.sin_precio"})
+		return false
+	}
+
+	venta.Total = precio * float64(venta.Cantidad)
+	venta.OrganizadorID = evento.OrganizadorID
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tunombre/qrtixpro-backend/fotos"
+)
+
+// fotoDeUsuario devuelve en base64 la foto de referencia del usuario para la
+// verificación facial. Los usuarios que aún no se migraron a GridFS la tienen
+// embebida en el documento.
+func fotoDeUsuario(ctx context.Context, usuario Usuario) (string, error) {
+	if usuario.FotoID.IsZero() {
+		return usuario.Foto, nil
+	}
+	return fotosAtlas.LeerBase64(ctx, usuario.FotoID)
+}
+
+// obtenerMiniatura sirve una miniatura JPEG de la foto de perfil. Solo el
+// propio usuario puede verla, con el token de una de sus sesiones.
+func obtenerMiniatura(c *gin.Context) {
+	cedula := c.Param("cedula")
+
+	lado := 128
+	if tam := c.Query("tam"); tam != "" {
+		n, err := strconv.Atoi(tam)
+		if err != nil || n < 32 || n > 512 {
+			responderError(c, http.StatusBadRequest, codigoTamanoInvalido)
+			return
+		}
+		lado = n
+	}
+
+	ctx, cancel := contextoSolicitud(c, 10*time.Second)
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, cedula)
+	if !ok {
+		return
+	}
+
+	var datos []byte
+	var err error
+	if usuario.FotoID.IsZero() {
+		datos, _, err = fotos.Decodificar(usuario.Foto)
+	} else {
+		datos, err = fotosAtlas.Leer(ctx, usuario.FotoID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "No se pudo leer la foto del usuario", "cedula", cedula, "error", err)
+		responderError(c, http.StatusNotFound, codigoFotoNoDisponible)
+		return
+	}
+
+	miniatura, err := fotos.Miniatura(datos, lado)
+	if errors.Is(err, fotos.ErrFotoInvalida) {
+		// Fotos guardadas antes de aceptar solo JPEG y PNG
+		slog.WarnContext(ctx, "La foto del usuario no se puede reducir", "cedula", cedula, "error", err)
+		responderError(c, http.StatusNotFound, codigoFotoNoDisponible)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "No se pudo generar la miniatura del usuario", "cedula", cedula, "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "image/jpeg", miniatura)
+}
@@ -0,0 +1,352 @@
+// Package fotos guarda las fotos de perfil de los usuarios en GridFS para que
+// no viajen embebidas en cada documento de la colección usuarios. Cada foto se
+// cifra con su propia clave de datos, guardada envuelta en los metadatos del archivo.
+package fotos
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/tunombre/qrtixpro-backend/cifrado"
+)
+
+// Bucket es el nombre del bucket GridFS donde se guardan las fotos.
+const Bucket = "fotos"
+
+// ErrFotoInvalida indica que la foto recibida no es una imagen JPEG o PNG en
+// base64 válida, o que es demasiado grande.
+var ErrFotoInvalida = errors.New("la foto no es una imagen válida")
+
+// maxPixeles limita las dimensiones de las fotos. image.Decode reserva la
+// memoria según las que declara la cabecera, así que se comprueban antes de
+// decodificar. Caben las fotos de cualquier celular.
+const maxPixeles = 4096 * 4096
+
+// Almacen guarda y recupera fotos en el bucket GridFS de una base de datos.
+type Almacen struct {
+	db      *mongo.Database
+	llavero *cifrado.Llavero
+}
+
+type metadatos struct {
+	ContentType string                `bson:"content_type"`
+	ClaveDatos  *cifrado.ClaveCifrada `bson:"clave_datos,omitempty"`
+}
+
+// NuevoAlmacen crea un almacén de fotos sobre la base de datos indicada.
+func NuevoAlmacen(db *mongo.Database, llavero *cifrado.Llavero) *Almacen {
+	return &Almacen{db: db, llavero: llavero}
+}
+
+// bucket abre el bucket aplicando el deadline del contexto. GridFS maneja los
+// deadlines a nivel de bucket, por eso se crea uno por operación.
+func (a *Almacen) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	b, err := gridfs.NewBucket(a.db, options.GridFSBucket().SetName(Bucket))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = b.SetReadDeadline(deadline)
+		_ = b.SetWriteDeadline(deadline)
+	}
+	return b, nil
+}
+
+// Decodificar convierte una foto en base64, con o sin prefijo "data:", en sus
+// bytes y su tipo de contenido. Solo acepta las que Miniatura puede reducir.
+func Decodificar(foto string) ([]byte, string, error) {
+	foto = strings.TrimSpace(foto)
+	if i := strings.Index(foto, ","); strings.HasPrefix(foto, "data:") && i >= 0 {
+		foto = foto[i+1:]
+	}
+
+	datos, err := base64.StdEncoding.DecodeString(foto)
+	if err != nil {
+		return nil, "", ErrFotoInvalida
+	}
+
+	tipo, err := comprobarImagen(datos)
+	if err != nil {
+		return nil, "", err
+	}
+	return datos, tipo, nil
+}
+
+// comprobarImagen lee solo la cabecera de la imagen y devuelve su tipo de
+// contenido. Acepta JPEG y PNG, los formatos cuyos decodificadores se
+// importan, de hasta maxPixeles.
+func comprobarImagen(datos []byte) (string, error) {
+	config, formato, err := image.DecodeConfig(bytes.NewReader(datos))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrFotoInvalida, err)
+	}
+	if formato != "jpeg" && formato != "png" {
+		return "", fmt.Errorf("%w: formato %s", ErrFotoInvalida, formato)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixeles {
+		return "", fmt.Errorf("%w: %dx%d píxeles", ErrFotoInvalida, config.Width, config.Height)
+	}
+	return "image/" + formato, nil
+}
+
+// Guardar cifra y sube la foto de un usuario con el ID indicado. Usar el mismo
+// ID en MongoDB Atlas y en MongoDB Local mantiene la referencia del usuario
+// válida en ambas bases.
+func (a *Almacen) Guardar(ctx context.Context, id primitive.ObjectID, foto string) error {
+	datos, tipo, err := Decodificar(foto)
+	if err != nil {
+		return err
+	}
+	return a.guardarDatos(ctx, id, datos, tipo)
+}
+
+func (a *Almacen) guardarDatos(ctx context.Context, id primitive.ObjectID, datos []byte, tipo string) error {
+	dek, clave, err := a.llavero.NuevaClave()
+	if err != nil {
+		return err
+	}
+	cifrados, err := cifrado.CifrarBytes(dek, datos)
+	if err != nil {
+		return err
+	}
+
+	b, err := a.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := options.GridFSUpload().SetMetadata(bson.M{
+		"content_type": tipo,
+		"clave_datos":  clave,
+		"subida_en":    time.Now(),
+	})
+	return b.UploadFromStreamWithID(id, id.Hex(), bytes.NewReader(cifrados), opts)
+}
+
+// Leer descarga y descifra la foto con el ID indicado. Las fotos subidas antes
+// de activar el cifrado no tienen clave_datos y se devuelven tal cual.
+func (a *Almacen) Leer(ctx context.Context, id primitive.ObjectID) ([]byte, error) {
+	b, err := a.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var archivo struct {
+		Metadata metadatos `bson:"metadata"`
+	}
+	err = b.GetFilesCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&archivo)
+	if err == mongo.ErrNoDocuments {
+		return nil, gridfs.ErrFileNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := b.DownloadToStream(id, &buf); err != nil {
+		return nil, err
+	}
+
+	if archivo.Metadata.ClaveDatos == nil {
+		return buf.Bytes(), nil
+	}
+	dek, err := a.llavero.Abrir(*archivo.Metadata.ClaveDatos)
+	if err != nil {
+		return nil, err
+	}
+	return cifrado.DescifrarBytes(dek, buf.Bytes())
+}
+
+// CifrarPendientes sube cifradas las fotos guardadas en texto plano. Cada
+// copia cifrada se sube con idCifrado del original, reemplazar cambia la
+// referencia de los usuarios y el original se borra al final: si se
+// interrumpe, la foto sigue en alguna de las dos copias y repetirla retoma
+// donde quedó. Devuelve cuántas fotos cifró.
+func (a *Almacen) CifrarPendientes(ctx context.Context, reemplazar func(ctx context.Context, viejo, nuevo primitive.ObjectID) error) (int, error) {
+	b, err := a.bucket(ctx)
+	if err != nil {
+		return 0, err
+	}
+	archivos := b.GetFilesCollection()
+
+	cursor, err := archivos.Find(ctx, bson.M{"metadata.clave_datos": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	cifradas := 0
+	for cursor.Next(ctx) {
+		var archivo struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&archivo); err != nil {
+			return cifradas, err
+		}
+		nuevo := idCifrado(archivo.ID)
+
+		// La copia puede existir ya si una ejecución anterior se cortó antes
+		// de borrar el original
+		n, err := archivos.CountDocuments(ctx, bson.M{"_id": nuevo})
+		if err != nil {
+			return cifradas, err
+		}
+		if n == 0 {
+			datos, err := a.Leer(ctx, archivo.ID)
+			if err != nil {
+				return cifradas, err
+			}
+			// Quita los fragmentos de una subida que quedó a medias
+			if err := a.Eliminar(ctx, nuevo); err != nil {
+				return cifradas, err
+			}
+			if err := a.guardarDatos(ctx, nuevo, datos, http.DetectContentType(datos)); err != nil {
+				return cifradas, err
+			}
+		}
+
+		if err := reemplazar(ctx, archivo.ID, nuevo); err != nil {
+			return cifradas, err
+		}
+		if err := a.Eliminar(ctx, archivo.ID); err != nil {
+			return cifradas, err
+		}
+		cifradas++
+	}
+	return cifradas, cursor.Err()
+}
+
+// idCifrado deriva el ID de la copia cifrada de una foto del de la foto en
+// texto plano. Es determinista para que MongoDB Atlas y MongoDB Local, que
+// se migran por separado, sigan usando el mismo ID para la misma foto, y
+// conserva la fecha del original.
+func idCifrado(id primitive.ObjectID) primitive.ObjectID {
+	suma := sha256.Sum256(append([]byte("fotos:cifrada:"), id[:]...))
+	var nuevo primitive.ObjectID
+	copy(nuevo[:4], id[:4])
+	copy(nuevo[4:], suma[:])
+	return nuevo
+}
+
+// Reenvolver envuelve con la KEK activa las claves de datos de las fotos que
+// usan una KEK anterior. Devuelve cuántas fotos actualizó.
+func (a *Almacen) Reenvolver(ctx context.Context) (int, error) {
+	b, err := a.bucket(ctx)
+	if err != nil {
+		return 0, err
+	}
+	archivos := b.GetFilesCollection()
+
+	cursor, err := archivos.Find(ctx, bson.M{
+		"metadata.clave_datos":     bson.M{"$exists": true},
+		"metadata.clave_datos.kek": bson.M{"$ne": a.llavero.Activa()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	actualizadas := 0
+	for cursor.Next(ctx) {
+		var archivo struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			Metadata metadatos          `bson:"metadata"`
+		}
+		if err := cursor.Decode(&archivo); err != nil {
+			return actualizadas, err
+		}
+
+		clave, cambio, err := a.llavero.Reenvolver(*archivo.Metadata.ClaveDatos)
+		if err != nil {
+			return actualizadas, err
+		}
+		if !cambio {
+			continue
+		}
+		_, err = archivos.UpdateOne(ctx, bson.M{"_id": archivo.ID}, bson.M{"$set": bson.M{"metadata.clave_datos": clave}})
+		if err != nil {
+			return actualizadas, err
+		}
+		actualizadas++
+	}
+	return actualizadas, cursor.Err()
+}
+
+// LeerBase64 descarga la foto con el ID indicado codificada en base64, el
+// formato que espera el proveedor de verificación facial.
+func (a *Almacen) LeerBase64(ctx context.Context, id primitive.ObjectID) (string, error) {
+	datos, err := a.Leer(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(datos), nil
+}
+
+// Eliminar borra la foto con el ID indicado. Borrar una foto inexistente no es un error.
+func (a *Almacen) Eliminar(ctx context.Context, id primitive.ObjectID) error {
+	b, err := a.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = b.Delete(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Miniatura reduce la imagen para que su lado mayor mida como máximo lado
+// píxeles y la devuelve codificada en JPEG.
+func Miniatura(datos []byte, lado int) ([]byte, error) {
+	if _, err := comprobarImagen(datos); err != nil {
+		return nil, err
+	}
+	origen, _, err := image.Decode(bytes.NewReader(datos))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFotoInvalida, err)
+	}
+
+	limites := origen.Bounds()
+	ancho, alto := limites.Dx(), limites.Dy()
+	if ancho > lado || alto > lado {
+		if ancho >= alto {
+			alto = alto * lado / ancho
+			ancho = lado
+		} else {
+			ancho = ancho * lado / alto
+			alto = lado
+		}
+	}
+	ancho, alto = max(ancho, 1), max(alto, 1)
+
+	destino := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+	for y := 0; y < alto; y++ {
+		sy := limites.Min.Y + y*limites.Dy()/alto
+		for x := 0; x < ancho; x++ {
+			sx := limites.Min.X + x*limites.Dx()/ancho
+			destino.Set(x, y, origen.At(sx, sy))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, destino, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
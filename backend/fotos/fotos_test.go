@@ -0,0 +1,109 @@
+package fotos
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIDCifradoEsDeterministaYDistinto(t *testing.T) {
+	id := primitive.NewObjectID()
+	nuevo := idCifrado(id)
+	if nuevo == id {
+		t.Fatal("la copia cifrada usaría el ID del original")
+	}
+	if idCifrado(id) != nuevo {
+		t.Error("el ID de la copia cambia entre ejecuciones")
+	}
+	if !nuevo.Timestamp().Equal(id.Timestamp()) {
+		t.Errorf("fecha %v, se esperaba %v", nuevo.Timestamp(), id.Timestamp())
+	}
+	if idCifrado(primitive.NewObjectID()) == nuevo {
+		t.Error("dos fotos distintas comparten el ID de la copia")
+	}
+}
+
+func imagenPrueba(t *testing.T, formato string, ancho, alto int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+	var buf bytes.Buffer
+	var err error
+	switch formato {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngGigante devuelve un PNG de pocos bytes que declara en su cabecera
+// ancho×alto píxeles.
+func pngGigante(t *testing.T, ancho, alto uint32) []byte {
+	t.Helper()
+	datos := imagenPrueba(t, "png", 1, 1)
+	// Tras la firma de 8 bytes viene IHDR: longitud, tipo, ancho, alto... y su CRC
+	binary.BigEndian.PutUint32(datos[16:], ancho)
+	binary.BigEndian.PutUint32(datos[20:], alto)
+	binary.BigEndian.PutUint32(datos[29:], crc32.ChecksumIEEE(datos[12:29]))
+	return datos
+}
+
+func TestDecodificarSoloJPEGYPNG(t *testing.T) {
+	for formato, tipo := range map[string]string{"png": "image/png", "jpeg": "image/jpeg"} {
+		foto := base64.StdEncoding.EncodeToString(imagenPrueba(t, formato, 8, 8))
+		if _, got, err := Decodificar("data:" + tipo + ";base64," + foto); err != nil || got != tipo {
+			t.Errorf("%s: Decodificar = %q, %v", formato, got, err)
+		}
+	}
+
+	rechazadas := map[string][]byte{
+		"gif":           imagenPrueba(t, "gif", 8, 8),
+		"texto":         []byte("no es una imagen"),
+		"png gigante":   pngGigante(t, 100000, 100000),
+		"png muy ancho": pngGigante(t, maxPixeles+1, 1),
+	}
+	for nombre, datos := range rechazadas {
+		if _, _, err := Decodificar(base64.StdEncoding.EncodeToString(datos)); !errors.Is(err, ErrFotoInvalida) {
+			t.Errorf("%s: Decodificar = %v, se esperaba ErrFotoInvalida", nombre, err)
+		}
+	}
+	if _, _, err := Decodificar("%%%"); !errors.Is(err, ErrFotoInvalida) {
+		t.Errorf("base64 inválido: %v", err)
+	}
+}
+
+func TestMiniaturaCompruebaAntesDeDecodificar(t *testing.T) {
+	miniatura, err := Miniatura(imagenPrueba(t, "png", 300, 150), 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, formato, err := image.DecodeConfig(bytes.NewReader(miniatura))
+	if err != nil || formato != "jpeg" || config.Width != 128 || config.Height != 64 {
+		t.Errorf("miniatura %s de %dx%d, %v; se esperaba jpeg de 128x64", formato, config.Width, config.Height, err)
+	}
+
+	// Sin decodificar las imágenes que no se pueden reducir
+	for nombre, datos := range map[string][]byte{
+		"gif":         imagenPrueba(t, "gif", 8, 8),
+		"png gigante": pngGigante(t, 100000, 100000),
+	} {
+		if _, err := Miniatura(datos, 128); !errors.Is(err, ErrFotoInvalida) {
+			t.Errorf("%s: Miniatura = %v, se esperaba ErrFotoInvalida", nombre, err)
+		}
+	}
+}
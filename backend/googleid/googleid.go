@@ -0,0 +1,255 @@
+// Package googleid verifica los ID tokens de Inicio de sesión con Google
+// (OpenID Connect). Comprueba la firma con las claves públicas de Google, que
+// se guardan en caché según su Cache-Control, y el emisor, la audiencia y la
+// vigencia del token.
+package googleid
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// URLClaves es el JWKS con el que Google firma los ID tokens.
+const URLClaves = "https://www.googleapis.com/oauth2/v3/certs"
+
+// emisores son los valores de iss que usa Google.
+var emisores = []string{"accounts.google.com", "https://accounts.google.com"}
+
+var (
+	// ErrTokenInvalido indica que el token no es un ID token de Google válido
+	// para esta aplicación. El error envuelto dice por qué.
+	ErrTokenInvalido = errors.New("ID token de Google inválido")
+	// ErrClavesNoDisponibles indica que no se pudieron descargar las claves,
+	// así que no se sabe si el token es válido.
+	ErrClavesNoDisponibles = errors.New("no se pudieron obtener las claves de Google")
+)
+
+const (
+	// vigenciaPorDefecto se usa cuando la respuesta no trae max-age.
+	vigenciaPorDefecto = time.Hour
+	// recargaMinima evita que tokens con kid inventados obliguen a descargar
+	// las claves en cada solicitud.
+	recargaMinima = time.Minute
+	// tolerancia absorbe la diferencia de reloj con Google.
+	tolerancia = time.Minute
+	// maxRespuesta limita el tamaño del JWKS que se acepta.
+	maxRespuesta = 1 << 20
+)
+
+var maxAge = regexp.MustCompile(`max-age=(\d+)`)
+
+// Identidad son los datos del usuario que trae un token verificado.
+type Identidad struct {
+	// Sujeto es el identificador estable de la cuenta de Google. El correo
+	// puede cambiar; el sujeto no.
+	Sujeto           string
+	Correo           string
+	CorreoVerificado bool
+	Nombre           string
+	NombrePila       string
+	Apellido         string
+}
+
+// Verificador valida ID tokens emitidos para Audiencia, el ID de cliente
+// OAuth de la aplicación. Es seguro usarlo desde varias goroutines.
+type Verificador struct {
+	Audiencia string
+	URLClaves string
+	Cliente   *http.Client
+	// ahora permite fijar el reloj en las pruebas.
+	ahora func() time.Time
+
+	mu          sync.Mutex
+	claves      map[string]*rsa.PublicKey
+	vence       time.Time
+	ultimaCarga time.Time
+}
+
+// Nuevo devuelve un verificador para el ID de cliente indicado que descarga
+// las claves de URLClaves.
+func Nuevo(audiencia string) *Verificador {
+	return &Verificador{
+		Audiencia: audiencia,
+		URLClaves: URLClaves,
+		Cliente:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type reclamos struct {
+	jwt.RegisteredClaims
+	Correo           string   `json:"email"`
+	CorreoVerificado booleano `json:"email_verified"`
+	Nombre           string   `json:"name"`
+	NombrePila       string   `json:"given_name"`
+	Apellido         string   `json:"family_name"`
+}
+
+// booleano acepta email_verified como booleano o como texto, que Google
+// usó en tokens antiguos.
+type booleano bool
+
+func (b *booleano) UnmarshalJSON(datos []byte) error {
+	var v any
+	if err := json.Unmarshal(datos, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = booleano(v)
+	case string:
+		*b = v == "true"
+	}
+	return nil
+}
+
+// Verificar comprueba el token y devuelve la identidad que contiene. Los
+// errores envuelven ErrTokenInvalido o ErrClavesNoDisponibles.
+func (v *Verificador) Verificar(ctx context.Context, token string) (Identidad, error) {
+	var r reclamos
+	var errClaves error
+	_, err := jwt.ParseWithClaims(token, &r, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		clave, err := v.clave(ctx, kid)
+		if err != nil {
+			errClaves = err
+		}
+		return clave, err
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(v.Audiencia),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(tolerancia),
+		jwt.WithTimeFunc(v.reloj),
+	)
+	if errors.Is(errClaves, ErrClavesNoDisponibles) {
+		return Identidad{}, errClaves
+	}
+	if err != nil {
+		return Identidad{}, fmt.Errorf("%w: %w", ErrTokenInvalido, err)
+	}
+
+	emisorValido := false
+	for _, e := range emisores {
+		emisorValido = emisorValido || r.Issuer == e
+	}
+	if !emisorValido {
+		return Identidad{}, fmt.Errorf("%w: emisor %q", ErrTokenInvalido, r.Issuer)
+	}
+	if r.Subject == "" {
+		return Identidad{}, fmt.Errorf("%w: sin sujeto", ErrTokenInvalido)
+	}
+
+	return Identidad{
+		Sujeto:           r.Subject,
+		Correo:           r.Correo,
+		CorreoVerificado: bool(r.CorreoVerificado),
+		Nombre:           r.Nombre,
+		NombrePila:       r.NombrePila,
+		Apellido:         r.Apellido,
+	}, nil
+}
+
+func (v *Verificador) reloj() time.Time {
+	if v.ahora != nil {
+		return v.ahora()
+	}
+	return time.Now()
+}
+
+// clave devuelve la clave pública del kid. Recarga el JWKS cuando la caché
+// venció o cuando el kid es desconocido, lo que pasa al rotar Google las
+// claves, pero no más de una vez por recargaMinima en este último caso.
+func (v *Verificador) clave(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ahora := v.reloj()
+	clave, conocida := v.claves[kid]
+	vigente := ahora.Before(v.vence)
+	if conocida && vigente {
+		return clave, nil
+	}
+	if !vigente || ahora.Sub(v.ultimaCarga) >= recargaMinima {
+		if err := v.cargar(ctx, ahora); err != nil {
+			return nil, err
+		}
+		clave, conocida = v.claves[kid]
+	}
+	if !conocida {
+		return nil, fmt.Errorf("clave %q desconocida", kid)
+	}
+	return clave, nil
+}
+
+// cargar descarga el JWKS. Debe llamarse con mu tomado.
+func (v *Verificador) cargar(ctx context.Context, ahora time.Time) error {
+	v.ultimaCarga = ahora
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.URLClaves, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrClavesNoDisponibles, err)
+	}
+	resp, err := v.Cliente.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrClavesNoDisponibles, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: estado %d", ErrClavesNoDisponibles, resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	decodificador := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, maxRespuesta))
+	if err := decodificador.Decode(&jwks); err != nil {
+		return fmt.Errorf("%w: %w", ErrClavesNoDisponibles, err)
+	}
+
+	claves := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		claves[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(claves) == 0 {
+		return fmt.Errorf("%w: el JWKS no trae claves RSA", ErrClavesNoDisponibles)
+	}
+
+	vigencia := vigenciaPorDefecto
+	if m := maxAge.FindStringSubmatch(resp.Header.Get("Cache-Control")); m != nil {
+		if segundos, err := strconv.Atoi(m[1]); err == nil {
+			vigencia = time.Duration(segundos) * time.Second
+		}
+	}
+	v.claves = claves
+	v.vence = ahora.Add(vigencia)
+	return nil
+}
@@ -0,0 +1,270 @@
+package googleid
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const audienciaPrueba = "cliente-prueba.apps.googleusercontent.com"
+
+// servidorClaves sirve un JWKS local en lugar del de Google y cuenta las
+// descargas.
+type servidorClaves struct {
+	*httptest.Server
+	claves    map[string]*rsa.PrivateKey
+	descargas atomic.Int32
+	caido     atomic.Bool
+}
+
+func nuevoServidorClaves(t *testing.T, kids ...string) *servidorClaves {
+	t.Helper()
+	s := &servidorClaves{claves: map[string]*rsa.PrivateKey{}}
+	for _, kid := range kids {
+		s.agregar(t, kid)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.descargas.Add(1)
+		if s.caido.Load() {
+			http.Error(w, "no disponible", http.StatusServiceUnavailable)
+			return
+		}
+		var jwks struct {
+			Keys []map[string]string `json:"keys"`
+		}
+		for kid, clave := range s.claves {
+			jwks.Keys = append(jwks.Keys, map[string]string{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(clave.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(clave.E)).Bytes()),
+			})
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600, must-revalidate")
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *servidorClaves) agregar(t *testing.T, kid string) *rsa.PrivateKey {
+	t.Helper()
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.claves[kid] = clave
+	return clave
+}
+
+// relojPrueba es un reloj que las pruebas adelantan a mano.
+type relojPrueba struct{ t time.Time }
+
+func (r *relojPrueba) ahora() time.Time        { return r.t }
+func (r *relojPrueba) avanzar(d time.Duration) { r.t = r.t.Add(d) }
+
+func verificadorPrueba(s *servidorClaves, reloj *relojPrueba) *Verificador {
+	v := Nuevo(audienciaPrueba)
+	v.URLClaves = s.URL
+	v.Cliente = s.Client()
+	v.ahora = reloj.ahora
+	return v
+}
+
+func reclamosValidos(ahora time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            audienciaPrueba,
+		"sub":            "110169484474386276334",
+		"email":          "ana.perez@example.com",
+		"email_verified": true,
+		"name":           "Ana Pérez",
+		"given_name":     "Ana",
+		"family_name":    "Pérez",
+		"iat":            ahora.Unix(),
+		"exp":            ahora.Add(time.Hour).Unix(),
+	}
+}
+
+func firmar(t *testing.T, clave *rsa.PrivateKey, kid string, r jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, r)
+	token.Header["kid"] = kid
+	firmado, err := token.SignedString(clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return firmado
+}
+
+func TestVerificarTokenValido(t *testing.T) {
+	s := nuevoServidorClaves(t, "k1")
+	reloj := &relojPrueba{time.Now()}
+	v := verificadorPrueba(s, reloj)
+
+	id, err := v.Verificar(context.Background(), firmar(t, s.claves["k1"], "k1", reclamosValidos(reloj.t)))
+	if err != nil {
+		t.Fatalf("Verificar: %v", err)
+	}
+	esperada := Identidad{
+		Sujeto:           "110169484474386276334",
+		Correo:           "ana.perez@example.com",
+		CorreoVerificado: true,
+		Nombre:           "Ana Pérez",
+		NombrePila:       "Ana",
+		Apellido:         "Pérez",
+	}
+	if id != esperada {
+		t.Errorf("identidad = %+v, se esperaba %+v", id, esperada)
+	}
+}
+
+func TestVerificarRechazaTokens(t *testing.T) {
+	s := nuevoServidorClaves(t, "k1")
+	reloj := &relojPrueba{time.Now()}
+	v := verificadorPrueba(s, reloj)
+	otraClave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	con := func(cambio func(jwt.MapClaims)) jwt.MapClaims {
+		r := reclamosValidos(reloj.t)
+		cambio(r)
+		return r
+	}
+	casos := []struct {
+		nombre string
+		token  string
+	}{
+		{"otra audiencia", firmar(t, s.claves["k1"], "k1", con(func(r jwt.MapClaims) { r["aud"] = "otra-app.apps.googleusercontent.com" }))},
+		{"otro emisor", firmar(t, s.claves["k1"], "k1", con(func(r jwt.MapClaims) { r["iss"] = "https://evil.example" }))},
+		{"vencido", firmar(t, s.claves["k1"], "k1", con(func(r jwt.MapClaims) { r["exp"] = reloj.t.Add(-2 * time.Minute).Unix() }))},
+		{"sin vencimiento", firmar(t, s.claves["k1"], "k1", con(func(r jwt.MapClaims) { delete(r, "exp") }))},
+		{"emitido en el futuro", firmar(t, s.claves["k1"], "k1", con(func(r jwt.MapClaims) { r["iat"] = reloj.t.Add(10 * time.Minute).Unix() }))},
+		{"sin sujeto", firmar(t, s.claves["k1"], "k1", con(func(r jwt.MapClaims) { delete(r, "sub") }))},
+		{"firmado con otra clave", firmar(t, otraClave, "k1", reclamosValidos(reloj.t))},
+		{"kid desconocido", firmar(t, s.claves["k1"], "k9", reclamosValidos(reloj.t))},
+		{"alg none", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, reclamosValidos(reloj.t))
+			token.Header["kid"] = "k1"
+			firmado, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return firmado
+		}()},
+		{"HS256 con la clave pública", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, reclamosValidos(reloj.t))
+			token.Header["kid"] = "k1"
+			firmado, _ := token.SignedString(s.claves["k1"].PublicKey.N.Bytes())
+			return firmado
+		}()},
+		{"basura", "no.es.un-jwt"},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			if _, err := v.Verificar(context.Background(), caso.token); !errors.Is(err, ErrTokenInvalido) {
+				t.Errorf("err = %v, se esperaba ErrTokenInvalido", err)
+			}
+		})
+	}
+}
+
+func TestVerificarCorreoVerificadoComoTexto(t *testing.T) {
+	s := nuevoServidorClaves(t, "k1")
+	reloj := &relojPrueba{time.Now()}
+	v := verificadorPrueba(s, reloj)
+
+	for valor, esperado := range map[any]bool{"true": true, "false": false, false: false} {
+		r := reclamosValidos(reloj.t)
+		r["email_verified"] = valor
+		id, err := v.Verificar(context.Background(), firmar(t, s.claves["k1"], "k1", r))
+		if err != nil {
+			t.Fatalf("email_verified=%v: %v", valor, err)
+		}
+		if id.CorreoVerificado != esperado {
+			t.Errorf("email_verified=%v: CorreoVerificado = %v", valor, id.CorreoVerificado)
+		}
+	}
+}
+
+func TestCacheDeClaves(t *testing.T) {
+	s := nuevoServidorClaves(t, "k1")
+	reloj := &relojPrueba{time.Now()}
+	v := verificadorPrueba(s, reloj)
+	verificar := func() error {
+		_, err := v.Verificar(context.Background(), firmar(t, s.claves["k1"], "k1", reclamosValidos(reloj.t)))
+		return err
+	}
+
+	for range 3 {
+		if err := verificar(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.descargas.Load(); n != 1 {
+		t.Fatalf("descargas con la caché vigente = %d, se esperaba 1", n)
+	}
+
+	// Pasado el max-age se vuelven a descargar
+	reloj.avanzar(time.Hour + time.Second)
+	if err := verificar(); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.descargas.Load(); n != 2 {
+		t.Fatalf("descargas tras vencer la caché = %d, se esperaba 2", n)
+	}
+}
+
+func TestRotacionDeClaves(t *testing.T) {
+	s := nuevoServidorClaves(t, "k1")
+	reloj := &relojPrueba{time.Now()}
+	v := verificadorPrueba(s, reloj)
+	if _, err := v.Verificar(context.Background(), firmar(t, s.claves["k1"], "k1", reclamosValidos(reloj.t))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Google publica una clave nueva antes de que venza la caché
+	reloj.avanzar(2 * recargaMinima)
+	nueva := s.agregar(t, "k2")
+	if _, err := v.Verificar(context.Background(), firmar(t, nueva, "k2", reclamosValidos(reloj.t))); err != nil {
+		t.Fatalf("token con la clave rotada: %v", err)
+	}
+	if n := s.descargas.Load(); n != 2 {
+		t.Fatalf("descargas = %d, se esperaba 2", n)
+	}
+
+	// Un kid inventado no fuerza otra descarga dentro de recargaMinima
+	for range 3 {
+		v.Verificar(context.Background(), firmar(t, nueva, "inventado", reclamosValidos(reloj.t)))
+	}
+	if n := s.descargas.Load(); n != 2 {
+		t.Fatalf("descargas con kid desconocido = %d, se esperaba 2", n)
+	}
+}
+
+func TestClavesNoDisponibles(t *testing.T) {
+	s := nuevoServidorClaves(t, "k1")
+	s.caido.Store(true)
+	reloj := &relojPrueba{time.Now()}
+	v := verificadorPrueba(s, reloj)
+
+	_, err := v.Verificar(context.Background(), firmar(t, s.claves["k1"], "k1", reclamosValidos(reloj.t)))
+	if !errors.Is(err, ErrClavesNoDisponibles) {
+		t.Fatalf("err = %v, se esperaba ErrClavesNoDisponibles", err)
+	}
+	if errors.Is(err, ErrTokenInvalido) {
+		t.Error("un fallo al descargar las claves no debe tratarse como token inválido")
+	}
+}
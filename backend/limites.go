@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tunombre/qrtixpro-backend/config"
+	"github.com/tunombre/qrtixpro-backend/limites"
+)
+
+// almacenLimites guarda las cubetas y los bloqueos de las rutas de
+// autenticación. Con varias instancias debe ser el de Mongo.
+var almacenLimites limites.Almacen
+
+// iniciarLimites crea el almacén configurado. Debe llamarse después de
+// conectarBases.
+func iniciarLimites() {
+	if cfg.Limites.Almacen != "mongo" {
+		almacenLimites = limites.NuevoEnMemoria()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+	almacen, err := limites.NuevoMongo(ctx, client.Database(cfg.Mongo.BaseDatos).Collection("limites"))
+	if err != nil {
+		log.Fatal("❌ ERROR: No se pudo preparar la colección de límites: ", err)
+	}
+	almacenLimites = almacen
+}
+
+func cubeta(c config.Cubeta) limites.Cubeta {
+	return limites.Cubeta{Capacidad: c.Capacidad, Periodo: c.Periodo.Duration()}
+}
+
+// limitarPorIP limita las solicitudes de cada IP a las rutas de
+// autenticación. Si el almacén falla deja pasar la solicitud: es preferible
+// perder el límite un momento a impedir que todos inicien sesión.
+func limitarPorIP(c *gin.Context) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	permitido, espera, err := almacenLimites.Tomar(ctx, "ip:"+c.ClientIP(), cubeta(cfg.Limites.PorIP))
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo consultar el límite por IP", "error", err)
+	} else if !permitido {
+		slog.WarnContext(c.Request.Context(), "Límite por IP excedido", "ip", c.ClientIP())
+		metricaLimitadas.WithLabelValues("ip").Inc()
+		responderLimitado(c, http.StatusTooManyRequests, codigoLimiteExcedido, espera)
+		return
+	}
+	c.Next()
+}
+
+// limitarIdentificador limita los intentos sobre una misma cédula o correo
+// desde cualquier IP. La clave usa el índice ciego para no guardar el dato en
+// claro. Devuelve false si ya respondió con 429.
+func limitarIdentificador(ctx context.Context, c *gin.Context, campo, valor string) bool {
+	clave := "id:" + campo + ":" + llavero.IndiceCiego(campo, valor)
+	permitido, espera, err := almacenLimites.Tomar(ctx, clave, cubeta(cfg.Limites.PorIdentificador))
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo consultar el límite por identificador", "error", err)
+		return true
+	}
+	if !permitido {
+		slog.WarnContext(c.Request.Context(), "Límite por identificador excedido", campo, valor)
+		metricaLimitadas.WithLabelValues("identificador").Inc()
+		responderLimitado(c, http.StatusTooManyRequests, codigoLimiteExcedido, espera)
+		return false
+	}
+	return true
+}
+
+// claveCuenta identifica la cuenta en los contadores de fallos y bloqueos.
+func claveCuenta(cedula string) string {
+	return "cuenta:" + llavero.IndiceCiego("cedula", cedula)
+}
+
+// cuentaBloqueada responde con 423 si la cuenta está bloqueada por intentos
+// fallidos. Se consulta antes de comprobar la contraseña o el rostro para
+// que un bloqueo no se pueda usar para seguir adivinando.
+func cuentaBloqueada(ctx context.Context, c *gin.Context, cedula string) bool {
+	resta, err := almacenLimites.Bloqueo(ctx, claveCuenta(cedula))
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo consultar el bloqueo de la cuenta", "error", err)
+		return false
+	}
+	if resta > 0 {
+		slog.WarnContext(c.Request.Context(), "Intento sobre una cuenta bloqueada", "cedula", cedula)
+		metricaLimitadas.WithLabelValues("bloqueo").Inc()
+		responderLimitado(c, http.StatusLocked, codigoCuentaBloqueada, resta)
+		return true
+	}
+	return false
+}
+
+// registrarFallo anota una contraseña o un rostro rechazado y bloquea la
+// cuenta al llegar a limites.intentos_fallidos dentro de la ventana.
+func registrarFallo(ctx context.Context, c *gin.Context, cedula string) {
+	clave := claveCuenta(cedula)
+	fallos, err := almacenLimites.SumarFallo(ctx, clave, cfg.Limites.VentanaFallos.Duration())
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo registrar el intento fallido", "error", err)
+		return
+	}
+	if fallos < cfg.Limites.IntentosFallidos {
+		return
+	}
+	if err := almacenLimites.Bloquear(ctx, clave, time.Now().Add(cfg.Limites.Bloqueo.Duration())); err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo bloquear la cuenta", "error", err)
+		return
+	}
+	slog.WarnContext(c.Request.Context(), "Cuenta bloqueada por intentos fallidos", "cedula", cedula, "fallos", fallos)
+}
+
+// reiniciarFallos borra los fallos acumulados tras un acceso correcto.
+func reiniciarFallos(ctx context.Context, c *gin.Context, cedula string) {
+	if err := almacenLimites.Reiniciar(ctx, claveCuenta(cedula)); err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudieron reiniciar los intentos fallidos", "error", err)
+	}
+}
+
+// responderLimitado responde con el código indicado y Retry-After en
+// segundos enteros, redondeando hacia arriba.
+func responderLimitado(c *gin.Context, estado int, codigo string, espera time.Duration) {
+	segundos := max(int(math.Ceil(espera.Seconds())), 1)
+	c.Header("Retry-After", strconv.Itoa(segundos))
+	responderError(c, estado, codigo)
+}
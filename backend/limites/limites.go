@@ -0,0 +1,53 @@
+// Package limites implementa los límites de frecuencia y los bloqueos por
+// intentos fallidos de las rutas de autenticación.
+//
+// Los límites son cubetas de fichas (token bucket): cada clave arranca con
+// Capacidad fichas, cada solicitud gasta una y se recargan de forma continua
+// hasta llenarse en Periodo. Los bloqueos cuentan fallos en una ventana fija
+// y, al llegar al máximo, impiden usar la clave hasta una fecha.
+//
+// Hay dos almacenes: EnMemoria, suficiente con una sola instancia, y Mongo,
+// para compartir los contadores entre varias instancias del backend.
+package limites
+
+import (
+	"context"
+	"time"
+)
+
+// Cubeta configura un límite de frecuencia.
+type Cubeta struct {
+	// Capacidad es el número de solicitudes seguidas que se permiten.
+	Capacidad int
+	// Periodo es lo que tarda en recargarse la cubeta vacía.
+	Periodo time.Duration
+}
+
+// recarga devuelve las fichas que se recuperan por segundo.
+func (c Cubeta) recarga() float64 {
+	return float64(c.Capacidad) / c.Periodo.Seconds()
+}
+
+// espera devuelve cuánto falta para tener una ficha entera.
+func (c Cubeta) espera(fichas float64) time.Duration {
+	if fichas >= 1 {
+		return 0
+	}
+	return time.Duration((1 - fichas) / c.recarga() * float64(time.Second))
+}
+
+// Almacen guarda el estado de las cubetas, los fallos y los bloqueos.
+type Almacen interface {
+	// Tomar gasta una ficha de la cubeta clave. Si no queda ninguna devuelve
+	// false y cuánto falta para la siguiente.
+	Tomar(ctx context.Context, clave string, c Cubeta) (bool, time.Duration, error)
+	// SumarFallo anota un fallo de clave y devuelve los acumulados en la
+	// ventana actual. La ventana empieza con el primer fallo.
+	SumarFallo(ctx context.Context, clave string, ventana time.Duration) (int, error)
+	// Bloquear impide usar clave hasta el instante indicado y borra sus fallos.
+	Bloquear(ctx context.Context, clave string, hasta time.Time) error
+	// Bloqueo devuelve cuánto le queda al bloqueo de clave, o 0 si no tiene.
+	Bloqueo(ctx context.Context, clave string) (time.Duration, error)
+	// Reiniciar borra los fallos de clave, por ejemplo tras un acierto.
+	Reiniciar(ctx context.Context, clave string) error
+}
@@ -0,0 +1,137 @@
+package limites
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EnMemoria guarda los límites en el proceso. Se pierden al reiniciar y no se
+// comparten entre instancias.
+type EnMemoria struct {
+	mu        sync.Mutex
+	cubetas   map[string]*cubeta
+	fallos    map[string]*contador
+	bloqueos  map[string]time.Time
+	purgadoEn time.Time
+	// ahora permite fijar el reloj en las pruebas.
+	ahora func() time.Time
+}
+
+type cubeta struct {
+	fichas      float64
+	actualizada time.Time
+	periodo     time.Duration
+}
+
+type contador struct {
+	fallos int
+	expira time.Time
+}
+
+// NuevoEnMemoria crea un almacén en memoria vacío.
+func NuevoEnMemoria() *EnMemoria {
+	return &EnMemoria{
+		cubetas:  map[string]*cubeta{},
+		fallos:   map[string]*contador{},
+		bloqueos: map[string]time.Time{},
+	}
+}
+
+func (m *EnMemoria) reloj() time.Time {
+	if m.ahora != nil {
+		return m.ahora()
+	}
+	return time.Now()
+}
+
+func (m *EnMemoria) Tomar(_ context.Context, clave string, c Cubeta) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ahora := m.reloj()
+	m.purgar(ahora)
+
+	b, ok := m.cubetas[clave]
+	if !ok {
+		b = &cubeta{fichas: float64(c.Capacidad), actualizada: ahora}
+		m.cubetas[clave] = b
+	}
+	b.periodo = c.Periodo
+	b.fichas = min(float64(c.Capacidad), b.fichas+ahora.Sub(b.actualizada).Seconds()*c.recarga())
+	b.actualizada = ahora
+
+	if b.fichas < 1 {
+		return false, c.espera(b.fichas), nil
+	}
+	b.fichas--
+	return true, 0, nil
+}
+
+func (m *EnMemoria) SumarFallo(_ context.Context, clave string, ventana time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ahora := m.reloj()
+
+	f, ok := m.fallos[clave]
+	if !ok || !ahora.Before(f.expira) {
+		f = &contador{expira: ahora.Add(ventana)}
+		m.fallos[clave] = f
+	}
+	f.fallos++
+	return f.fallos, nil
+}
+
+func (m *EnMemoria) Bloquear(_ context.Context, clave string, hasta time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bloqueos[clave] = hasta
+	delete(m.fallos, clave)
+	return nil
+}
+
+func (m *EnMemoria) Bloqueo(_ context.Context, clave string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hasta, ok := m.bloqueos[clave]
+	if !ok {
+		return 0, nil
+	}
+	resta := hasta.Sub(m.reloj())
+	if resta <= 0 {
+		delete(m.bloqueos, clave)
+		return 0, nil
+	}
+	return resta, nil
+}
+
+func (m *EnMemoria) Reiniciar(_ context.Context, clave string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.fallos, clave)
+	return nil
+}
+
+// purgar borra, como mucho una vez por minuto, las entradas que ya no
+// cambian nada: cubetas llenas, ventanas vencidas y bloqueos terminados.
+// Debe llamarse con mu tomado.
+func (m *EnMemoria) purgar(ahora time.Time) {
+	if ahora.Sub(m.purgadoEn) < time.Minute {
+		return
+	}
+	m.purgadoEn = ahora
+	for clave, b := range m.cubetas {
+		if ahora.Sub(b.actualizada) >= b.periodo {
+			delete(m.cubetas, clave)
+		}
+	}
+	for clave, f := range m.fallos {
+		if !ahora.Before(f.expira) {
+			delete(m.fallos, clave)
+		}
+	}
+	for clave, hasta := range m.bloqueos {
+		if !ahora.Before(hasta) {
+			delete(m.bloqueos, clave)
+		}
+	}
+}
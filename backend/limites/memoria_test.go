@@ -0,0 +1,186 @@
+package limites
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// relojPrueba es un reloj que las pruebas adelantan a mano.
+type relojPrueba struct{ t time.Time }
+
+func (r *relojPrueba) ahora() time.Time        { return r.t }
+func (r *relojPrueba) avanzar(d time.Duration) { r.t = r.t.Add(d) }
+
+func memoriaPrueba() (*EnMemoria, *relojPrueba) {
+	reloj := &relojPrueba{time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	m := NuevoEnMemoria()
+	m.ahora = reloj.ahora
+	return m, reloj
+}
+
+func tomar(t *testing.T, m *EnMemoria, clave string, c Cubeta) (bool, time.Duration) {
+	t.Helper()
+	permitido, espera, err := m.Tomar(context.Background(), clave, c)
+	if err != nil {
+		t.Fatalf("Tomar: %v", err)
+	}
+	return permitido, espera
+}
+
+func TestCubetaPermiteLaCapacidadSeguida(t *testing.T) {
+	m, _ := memoriaPrueba()
+	c := Cubeta{Capacidad: 5, Periodo: time.Minute}
+
+	for i := range 5 {
+		if permitido, _ := tomar(t, m, "ip:1.2.3.4", c); !permitido {
+			t.Fatalf("solicitud %d rechazada dentro de la capacidad", i+1)
+		}
+	}
+	permitido, espera := tomar(t, m, "ip:1.2.3.4", c)
+	if permitido {
+		t.Fatal("se permitió una solicitud con la cubeta vacía")
+	}
+	// Con 5 fichas por minuto, una ficha tarda 12 s
+	if espera != 12*time.Second {
+		t.Errorf("espera = %v, se esperaba 12s", espera)
+	}
+
+	if permitido, _ := tomar(t, m, "ip:5.6.7.8", c); !permitido {
+		t.Error("la cubeta de otra clave no debería compartir las fichas")
+	}
+}
+
+func TestCubetaSeRecarga(t *testing.T) {
+	m, reloj := memoriaPrueba()
+	c := Cubeta{Capacidad: 5, Periodo: time.Minute}
+	for range 5 {
+		tomar(t, m, "ip:1.2.3.4", c)
+	}
+
+	// A mitad de una ficha la espera es la mitad
+	reloj.avanzar(6 * time.Second)
+	permitido, espera := tomar(t, m, "ip:1.2.3.4", c)
+	if permitido || espera != 6*time.Second {
+		t.Fatalf("a los 6s: permitido = %v, espera = %v; se esperaba false, 6s", permitido, espera)
+	}
+
+	reloj.avanzar(6 * time.Second)
+	if permitido, _ := tomar(t, m, "ip:1.2.3.4", c); !permitido {
+		t.Fatal("a los 12s ya debería haber una ficha")
+	}
+	if permitido, _ := tomar(t, m, "ip:1.2.3.4", c); permitido {
+		t.Fatal("solo se recargó una ficha")
+	}
+
+	// La recarga no pasa de la capacidad aunque pase mucho tiempo
+	reloj.avanzar(time.Hour)
+	for i := range 5 {
+		if permitido, _ := tomar(t, m, "ip:1.2.3.4", c); !permitido {
+			t.Fatalf("solicitud %d rechazada tras recargar", i+1)
+		}
+	}
+	if permitido, _ := tomar(t, m, "ip:1.2.3.4", c); permitido {
+		t.Error("la cubeta se recargó por encima de la capacidad")
+	}
+}
+
+func TestEsperaRedondeaLaFichaQueFalta(t *testing.T) {
+	c := Cubeta{Capacidad: 3, Periodo: time.Hour}
+	casos := map[float64]time.Duration{
+		1:    0,
+		2.5:  0,
+		0:    20 * time.Minute,
+		0.5:  10 * time.Minute,
+		0.75: 5 * time.Minute,
+	}
+	for fichas, esperada := range casos {
+		if espera := c.espera(fichas); espera != esperada {
+			t.Errorf("espera(%v) = %v, se esperaba %v", fichas, espera, esperada)
+		}
+	}
+}
+
+func TestFallosCuentanDentroDeLaVentana(t *testing.T) {
+	m, reloj := memoriaPrueba()
+	ctx := context.Background()
+	ventana := 15 * time.Minute
+
+	for i := 1; i <= 4; i++ {
+		fallos, err := m.SumarFallo(ctx, "cuenta:a", ventana)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fallos != i {
+			t.Fatalf("fallo %d: SumarFallo = %d", i, fallos)
+		}
+		reloj.avanzar(time.Minute)
+	}
+
+	// La ventana empieza con el primer fallo y no se extiende con los demás
+	reloj.avanzar(ventana - 4*time.Minute)
+	if fallos, _ := m.SumarFallo(ctx, "cuenta:a", ventana); fallos != 1 {
+		t.Errorf("tras la ventana: SumarFallo = %d, se esperaba 1", fallos)
+	}
+
+	if err := m.Reiniciar(ctx, "cuenta:a"); err != nil {
+		t.Fatal(err)
+	}
+	if fallos, _ := m.SumarFallo(ctx, "cuenta:a", ventana); fallos != 1 {
+		t.Errorf("tras Reiniciar: SumarFallo = %d, se esperaba 1", fallos)
+	}
+}
+
+func TestBloqueoVenceYBorraLosFallos(t *testing.T) {
+	m, reloj := memoriaPrueba()
+	ctx := context.Background()
+	ventana := 15 * time.Minute
+	for range 5 {
+		m.SumarFallo(ctx, "cuenta:a", ventana)
+	}
+
+	if err := m.Bloquear(ctx, "cuenta:a", reloj.t.Add(15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if resta, _ := m.Bloqueo(ctx, "cuenta:a"); resta != 15*time.Minute {
+		t.Errorf("Bloqueo = %v, se esperaba 15m", resta)
+	}
+	if resta, _ := m.Bloqueo(ctx, "cuenta:b"); resta != 0 {
+		t.Errorf("otra cuenta: Bloqueo = %v, se esperaba 0", resta)
+	}
+
+	reloj.avanzar(10 * time.Minute)
+	if resta, _ := m.Bloqueo(ctx, "cuenta:a"); resta != 5*time.Minute {
+		t.Errorf("a los 10m: Bloqueo = %v, se esperaba 5m", resta)
+	}
+
+	reloj.avanzar(5 * time.Minute)
+	if resta, _ := m.Bloqueo(ctx, "cuenta:a"); resta != 0 {
+		t.Errorf("al vencer: Bloqueo = %v, se esperaba 0", resta)
+	}
+	// Bloquear borró los fallos: la cuenta vuelve a empezar de cero
+	if fallos, _ := m.SumarFallo(ctx, "cuenta:a", ventana); fallos != 1 {
+		t.Errorf("tras el bloqueo: SumarFallo = %d, se esperaba 1", fallos)
+	}
+}
+
+func TestPurgarBorraLoQueYaNoCambiaNada(t *testing.T) {
+	m, reloj := memoriaPrueba()
+	ctx := context.Background()
+	c := Cubeta{Capacidad: 2, Periodo: time.Minute}
+	tomar(t, m, "ip:1.2.3.4", c)
+	m.SumarFallo(ctx, "cuenta:a", time.Minute)
+	m.Bloquear(ctx, "cuenta:b", reloj.t.Add(time.Minute))
+
+	reloj.avanzar(2 * time.Minute)
+	tomar(t, m, "ip:5.6.7.8", c)
+	if _, ok := m.cubetas["ip:1.2.3.4"]; ok {
+		t.Error("no se purgó la cubeta llena")
+	}
+	if _, ok := m.fallos["cuenta:a"]; ok {
+		t.Error("no se purgó la ventana vencida")
+	}
+	if _, ok := m.bloqueos["cuenta:b"]; ok {
+		t.Error("no se purgó el bloqueo terminado")
+	}
+}
@@ -0,0 +1,119 @@
+package limites
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo guarda los límites en una colección para compartirlos entre
+// instancias. Cada operación es una sola actualización atómica; los
+// documentos caducan solos con un índice TTL sobre expira_en.
+type Mongo struct {
+	coleccion *mongo.Collection
+}
+
+// NuevoMongo prepara la colección, incluido su índice TTL.
+func NuevoMongo(ctx context.Context, coleccion *mongo.Collection) (*Mongo, error) {
+	_, err := coleccion.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expira_en", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Mongo{coleccion: coleccion}, nil
+}
+
+func (m *Mongo) Tomar(ctx context.Context, clave string, c Cubeta) (bool, time.Duration, error) {
+	ahora := time.Now()
+	capacidad := float64(c.Capacidad)
+	porMilisegundo := c.recarga() / 1000
+
+	// Recarga según el tiempo transcurrido y, si alcanza, gasta una ficha
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"fichas": bson.M{"$min": bson.A{capacidad, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$fichas", capacidad}},
+				bson.M{"$multiply": bson.A{
+					bson.M{"$subtract": bson.A{ahora, bson.M{"$ifNull": bson.A{"$actualizada", ahora}}}},
+					porMilisegundo,
+				}},
+			}}}},
+			"actualizada": ahora,
+			"expira_en":   ahora.Add(c.Periodo),
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"permitido": bson.M{"$gte": bson.A{"$fichas", 1}},
+			"fichas": bson.M{"$cond": bson.A{
+				bson.M{"$gte": bson.A{"$fichas", 1}},
+				bson.M{"$subtract": bson.A{"$fichas", 1}},
+				"$fichas",
+			}},
+		}}},
+	}
+
+	var doc struct {
+		Fichas    float64 `bson:"fichas"`
+		Permitido bool    `bson:"permitido"`
+	}
+	err := m.coleccion.FindOneAndUpdate(ctx, bson.M{"_id": "cubeta:" + clave}, pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&doc)
+	if err != nil {
+		return false, 0, err
+	}
+	if !doc.Permitido {
+		return false, c.espera(doc.Fichas), nil
+	}
+	return true, 0, nil
+}
+
+func (m *Mongo) SumarFallo(ctx context.Context, clave string, ventana time.Duration) (int, error) {
+	ahora := time.Now()
+	vigente := bson.M{"$gt": bson.A{"$expira_en", ahora}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"fallos":    bson.M{"$cond": bson.A{vigente, bson.M{"$add": bson.A{"$fallos", 1}}, 1}},
+			"expira_en": bson.M{"$cond": bson.A{vigente, "$expira_en", ahora.Add(ventana)}},
+		}}},
+	}
+
+	var doc struct {
+		Fallos int `bson:"fallos"`
+	}
+	err := m.coleccion.FindOneAndUpdate(ctx, bson.M{"_id": "fallos:" + clave}, pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&doc)
+	return doc.Fallos, err
+}
+
+func (m *Mongo) Bloquear(ctx context.Context, clave string, hasta time.Time) error {
+	_, err := m.coleccion.UpdateOne(ctx, bson.M{"_id": "bloqueo:" + clave},
+		bson.M{"$set": bson.M{"hasta": hasta, "expira_en": hasta}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	return m.Reiniciar(ctx, clave)
+}
+
+func (m *Mongo) Bloqueo(ctx context.Context, clave string) (time.Duration, error) {
+	var doc struct {
+		Hasta time.Time `bson:"hasta"`
+	}
+	err := m.coleccion.FindOne(ctx, bson.M{"_id": "bloqueo:" + clave}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return max(time.Until(doc.Hasta), 0), nil
+}
+
+func (m *Mongo) Reiniciar(ctx context.Context, clave string) error {
+	_, err := m.coleccion.DeleteOne(ctx, bson.M{"_id": "fallos:" + clave})
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tunombre/qrtixpro-backend/cifrado"
+	"github.com/tunombre/qrtixpro-backend/config"
+	"github.com/tunombre/qrtixpro-backend/limites"
+)
+
+// llaveroPrueba crea un llavero con una clave aleatoria.
+func llaveroPrueba(t *testing.T) *cifrado.Llavero {
+	t.Helper()
+	clave := make([]byte, 32)
+	if _, err := rand.Read(clave); err != nil {
+		t.Fatal(err)
+	}
+	l, err := cifrado.NuevoLlavero(map[string][]byte{"v1": clave}, "v1", clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// prepararLimites deja los globales que usan los límites con un almacén en
+// memoria nuevo y los restaura al terminar.
+func prepararLimites(t *testing.T, intentos int) {
+	t.Helper()
+	l := llaveroPrueba(t)
+
+	cfgAntes, llaveroAntes, almacenAntes := cfg, llavero, almacenLimites
+	t.Cleanup(func() { cfg, llavero, almacenLimites = cfgAntes, llaveroAntes, almacenAntes })
+
+	c := config.PorDefecto()
+	c.Limites.IntentosFallidos = intentos
+	c.Limites.VentanaFallos = config.Duracion(15 * time.Minute)
+	c.Limites.Bloqueo = config.Duracion(15 * time.Minute)
+	cfg, llavero, almacenLimites = &c, l, limites.NuevoEnMemoria()
+}
+
+func contextoPrueba() (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/sesiones", nil)
+	return c, w
+}
+
+func TestRetryAfterRedondeaHaciaArriba(t *testing.T) {
+	casos := map[time.Duration]string{
+		0:                      "1",
+		300 * time.Millisecond: "1",
+		12 * time.Second:       "12",
+		12*time.Second + 1:     "13",
+		15 * time.Minute:       "900",
+		14*time.Minute + 59*time.Second + 500*time.Millisecond: "900",
+	}
+	for espera, esperado := range casos {
+		c, w := contextoPrueba()
+		responderLimitado(c, http.StatusTooManyRequests, codigoLimiteExcedido, espera)
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("%v: estado = %d", espera, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != esperado {
+			t.Errorf("%v: Retry-After = %q, se esperaba %q", espera, got, esperado)
+		}
+	}
+}
+
+func TestBloqueoAlLlegarAlUmbral(t *testing.T) {
+	prepararLimites(t, 3)
+	ctx := context.Background()
+	c, _ := contextoPrueba()
+
+	for i := 1; i < 3; i++ {
+		registrarFallo(ctx, c, "1020304050")
+		if c, _ := contextoPrueba(); cuentaBloqueada(ctx, c, "1020304050") {
+			t.Fatalf("bloqueada tras %d fallos, el umbral es 3", i)
+		}
+	}
+	registrarFallo(ctx, c, "1020304050")
+
+	c, w := contextoPrueba()
+	if !cuentaBloqueada(ctx, c, "1020304050") {
+		t.Fatal("no se bloqueó al llegar al umbral")
+	}
+	if w.Code != http.StatusLocked {
+		t.Errorf("estado = %d, se esperaba 423", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "900" {
+		t.Errorf("Retry-After = %q, se esperaba 900", got)
+	}
+
+	if c, _ := contextoPrueba(); cuentaBloqueada(ctx, c, "9080706050") {
+		t.Error("el bloqueo alcanzó a otra cuenta")
+	}
+}
+
+func TestAciertoReiniciaLosFallos(t *testing.T) {
+	prepararLimites(t, 3)
+	ctx := context.Background()
+	c, _ := contextoPrueba()
+
+	registrarFallo(ctx, c, "1020304050")
+	registrarFallo(ctx, c, "1020304050")
+	reiniciarFallos(ctx, c, "1020304050")
+	registrarFallo(ctx, c, "1020304050")
+	registrarFallo(ctx, c, "1020304050")
+
+	if c, _ := contextoPrueba(); cuentaBloqueada(ctx, c, "1020304050") {
+		t.Error("se bloqueó contando fallos anteriores a un acierto")
+	}
+}
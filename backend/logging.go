@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const cabeceraIDSolicitud = "X-Request-ID"
+
+type claveContexto int
+
+const claveIDSolicitud claveContexto = iota
+
+var (
+	patronIDSolicitud = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+	patronCorreo      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	patronImagen      = regexp.MustCompile(`data:image/[A-Za-z0-9.+-]+;base64,[A-Za-z0-9+/=]*|[A-Za-z0-9+/]{200,}={0,2}`)
+)
+
+const imagenOmitida = "[imagen omitida]"
+
+// configurarLogs instala un logger JSON en stdout como logger por defecto. El
+// paquete log estándar también pasa por él, así que ningún mensaje se escapa
+// de la redacción de datos personales.
+func configurarLogs(nivel string) {
+	var n slog.Level
+	if err := n.UnmarshalText([]byte(nivel)); err != nil {
+		n = slog.LevelInfo
+	}
+	json := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:       n,
+		ReplaceAttr: redactarAtributo,
+	})
+	slog.SetDefault(slog.New(manejadorSolicitud{json}))
+}
+
+// manejadorSolicitud añade el request_id y la traza del contexto a cada registro.
+type manejadorSolicitud struct {
+	slog.Handler
+}
+
+func (h manejadorSolicitud) Handle(ctx context.Context, r slog.Record) error {
+	if id := idSolicitud(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if traceID, spanID, ok := spanActual(ctx); ok {
+		r.AddAttrs(slog.String("trace_id", traceID), slog.String("span_id", spanID))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h manejadorSolicitud) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return manejadorSolicitud{h.Handler.WithAttrs(attrs)}
+}
+
+func (h manejadorSolicitud) WithGroup(nombre string) slog.Handler {
+	return manejadorSolicitud{h.Handler.WithGroup(nombre)}
+}
+
+// redactarAtributo enmascara los atributos con datos personales según su
+// clave y limpia correos e imágenes que aparezcan dentro de cualquier texto,
+// incluido el mensaje y los errores.
+func redactarAtributo(_ []string, a slog.Attr) slog.Attr {
+	switch strings.ToLower(a.Key) {
+	case "cedula":
+		return slog.String(a.Key, enmascararFinal(a.Value.String(), 3))
+	case "telefono":
+		return slog.String(a.Key, enmascararFinal(a.Value.String(), 2))
+	case "correo", "email":
+		return slog.String(a.Key, enmascararCorreo(a.Value.String()))
+	case "foto", "imagen", "image_base64_1", "image_base64_2":
+		return slog.String(a.Key, imagenOmitida)
+	case "contrasena", "direccion", "api_key", "api_secret", "authorization":
+		return slog.String(a.Key, "[REDACTADO]")
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, limpiarTexto(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, limpiarTexto(err.Error()))
+		}
+	}
+	return a
+}
+
+// limpiarTexto reemplaza correos e imágenes en base64 dentro de un texto libre.
+func limpiarTexto(s string) string {
+	s = patronImagen.ReplaceAllLiteralString(s, imagenOmitida)
+	return patronCorreo.ReplaceAllStringFunc(s, enmascararCorreo)
+}
+
+// enmascararFinal deja visibles solo los últimos n caracteres: 1234567890 → *******890.
+func enmascararFinal(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return strings.Repeat("*", len(r))
+	}
+	return strings.Repeat("*", len(r)-n) + string(r[len(r)-n:])
+}
+
+// enmascararCorreo deja la primera letra y el dominio: juan@correo.com → j***@correo.com.
+func enmascararCorreo(s string) string {
+	usuario, dominio, ok := strings.Cut(s, "@")
+	if !ok || usuario == "" {
+		return "***"
+	}
+	return string([]rune(usuario)[0]) + "***@" + dominio
+}
+
+// idSolicitud devuelve el identificador de solicitud guardado en ctx.
+func idSolicitud(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(claveIDSolicitud).(string)
+	return id
+}
+
+// middlewareIDSolicitud reutiliza el X-Request-ID del cliente si es válido o
+// genera uno nuevo, lo devuelve en la respuesta y lo deja en el contexto de
+// la solicitud para que aparezca en los logs.
+func middlewareIDSolicitud(c *gin.Context) {
+	id := c.GetHeader(cabeceraIDSolicitud)
+	if !patronIDSolicitud.MatchString(id) {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	c.Header(cabeceraIDSolicitud, id)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), claveIDSolicitud, id))
+	c.Next()
+}
+
+// middlewareRegistro escribe una línea por solicitud. Se registra la ruta de
+// Gin y no la URL, porque la URL puede llevar la cédula.
+func middlewareRegistro(c *gin.Context) {
+	inicio := time.Now()
+	c.Next()
+
+	ruta := c.FullPath()
+	if ruta == "" {
+		ruta = "no_encontrada"
+	}
+	estado := c.Writer.Status()
+
+	nivel := slog.LevelInfo
+	switch {
+	case estado >= 500:
+		nivel = slog.LevelError
+	case estado >= 400:
+		nivel = slog.LevelWarn
+	case ruta == "/healthz" || ruta == "/readyz" || ruta == "/metrics":
+		nivel = slog.LevelDebug
+	}
+
+	attrs := []any{
+		"metodo", c.Request.Method,
+		"ruta", ruta,
+		"estado", estado,
+		"duracion_ms", time.Since(inicio).Milliseconds(),
+		"ip", c.ClientIP(),
+		"bytes", c.Writer.Size(),
+	}
+	if errs := c.Errors.ByType(gin.ErrorTypeAny); len(errs) > 0 {
+		attrs = append(attrs, "error", errs.String())
+	}
+	slog.Log(c.Request.Context(), nivel, "Solicitud HTTP", attrs...)
+}
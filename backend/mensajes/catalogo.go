@@ -0,0 +1,243 @@
+package mensajes
+
+// Al agregar una clave hay que traducirla en todos los catálogos.
+
+var espanolColombia = map[string]string{
+	// Errores
+	"DATOS_INVALIDOS":             "Datos inválidos",
+	"VALIDACION_FALLIDA":          "Hay campos con errores. Revíselos e intente de nuevo",
+	"CAMPOS_OBLIGATORIOS":         "Faltan campos obligatorios",
+	"TAMANO_INVALIDO":             "El tamaño debe estar entre 32 y 512 píxeles",
+	"CEDULA_DUPLICADA":            "Ya existe un usuario con esta cédula",
+	"CORREO_DUPLICADO":            "Ya existe un usuario con este correo electrónico",
+	"USUARIO_NO_ENCONTRADO":       "Usuario no encontrado",
+	"CREDENCIALES_INVALIDAS":      "Cédula o contraseña incorrecta",
+	"AUTENTICACION_REQUERIDA":     "Autenticación requerida",
+	"VERIFICACION_FACIAL_FALLIDA": "Verificación facial fallida",
+	"FOTO_NO_DISPONIBLE":          "El usuario no tiene foto disponible",
+	"TIEMPO_AGOTADO":              "El servidor tardó demasiado en responder. Por favor, intente nuevamente",
+	"LIMITE_EXCEDIDO":             "Demasiados intentos. Espere un momento antes de volver a intentarlo",
+	"CUENTA_BLOQUEADA":            "La cuenta está bloqueada temporalmente por intentos fallidos. Intente más tarde",
+	"RETO_INVALIDO":               "La solicitud de inicio de sesión no es válida o expiró. Vuelva a empezar",
+	"TOKEN_INVALIDO":              "El enlace no es válido, ya se usó o expiró. Solicite uno nuevo",
+	"CORREO_NO_VERIFICADO":        "Confirme su correo electrónico antes de comprar boletas",
+	"CODIGO_REQUERIDO":            "Ingrese el código de su aplicación de autenticación",
+	"CODIGO_INVALIDO":             "El código no es válido o ya se usó",
+	"TOTP_YA_ACTIVO":              "La verificación en dos pasos con aplicación ya está activa",
+	"TOTP_SIN_INSCRIPCION":        "No hay una inscripción de aplicación de autenticación en curso",
+	"PASSKEY_INVALIDA":            "La llave de acceso no es válida. Intente de nuevo o use otro método",
+	"PASSKEY_NO_ENCONTRADA":       "La llave de acceso no existe",
+	"LIMITE_PASSKEYS":             "Ya tiene el máximo de llaves de acceso o esa llave ya está registrada",
+	"TOKEN_GOOGLE_INVALIDO":       "No se pudo validar el inicio de sesión con Google. Intente de nuevo",
+	"CORREO_GOOGLE_NO_VERIFICADO": "La cuenta de Google no tiene un correo verificado",
+	"GOOGLE_YA_VINCULADA":         "El correo ya está vinculado a otra cuenta de Google",
+	"PERMISO_DENEGADO":            "No tiene permiso para realizar esta operación",
+	"VENTA_NO_ENCONTRADA":         "Venta no encontrada",
+	"BOLETA_INVALIDA":             "La boleta no pertenece a una venta completada",
+	"BOLETA_YA_USADA":             "La boleta ya se usó para ingresar",
+	"ORGANIZADOR_NO_ENCONTRADO":   "Organizador no encontrado",
+	"EVENTO_NO_ENCONTRADO":        "El evento no existe o no está a la venta",
+	"SESION_INVALIDA":             "La sesión no existe, venció o fue cerrada; inicia sesión de nuevo",
+	"SESION_NO_ENCONTRADA":        "La sesión no existe o ya fue cerrada",
+	"SEGUNDO_FACTOR_REQUERIDO":    "Para cambiar esto inicia sesión de nuevo pasando tu segundo factor",
+	"PERFIL_COMPLETO":             "La cuenta ya tiene cédula; actualícela desde sus datos de usuario",
+	"SERVICIO_NO_DISPONIBLE":      "El servicio no está disponible en este momento",
+	"RUTA_NO_ENCONTRADA":          "La ruta solicitada no existe",
+	"METODO_NO_PERMITIDO":         "Método no permitido para esta ruta",
+	"ERROR_INTERNO":               "Error interno del servidor. Por favor, intente más tarde",
+
+	// Éxitos
+	"VENTA_REGISTRADA":            "Venta registrada exitosamente",
+	"USUARIO_REGISTRADO":          "Usuario registrado con éxito. Revise su correo para confirmarlo",
+	"USUARIO_ACTUALIZADO":         "Usuario actualizado con éxito",
+	"USUARIO_ELIMINADO":           "Usuario eliminado con éxito",
+	"INICIO_SESION_EXITOSO":       "Inicio de sesión exitoso",
+	"VERIFICACION_FACIAL_EXITOSA": "Verificación facial exitosa",
+	"RETO_EMITIDO":                "Si el correo está registrado, continúe con la verificación facial",
+	"RESTABLECIMIENTO_SOLICITADO": "Si el correo está registrado, recibirá un enlace para restablecer la contraseña",
+	"CONTRASENA_RESTABLECIDA":     "Contraseña restablecida. Inicie sesión con la nueva contraseña",
+	"CORREO_CONFIRMADO":           "Correo confirmado. Ya puede comprar boletas",
+	"CONFIRMACION_REENVIADA":      "Si el correo está pendiente de confirmación, recibirá un nuevo enlace",
+	"TOTP_ACTIVADO":               "Aplicación de autenticación activada. Guarde los códigos de recuperación en un lugar seguro",
+	"TOTP_DESACTIVADO":            "Aplicación de autenticación desactivada. Volverá a usar la verificación facial",
+	"PASSKEY_REGISTRADA":          "Llave de acceso registrada",
+	"PASSKEY_ELIMINADA":           "Llave de acceso eliminada",
+	"CUENTA_GOOGLE_CREADA":        "Cuenta creada con Google. Complete su perfil para comprar boletas",
+	"PERFIL_COMPLETADO":           "Perfil completado. Ya puede comprar boletas",
+	"ROLES_ACTUALIZADOS":          "Roles actualizados",
+	"INGRESO_REGISTRADO":          "Ingreso registrado",
+	"ORGANIZADOR_CREADO":          "Organizador creado",
+	"ORGANIZADOR_ACTUALIZADO":     "Organizador actualizado",
+	"EVENTO_CREADO":               "Evento creado",
+	"EVENTO_ACTUALIZADO":          "Evento actualizado",
+	"SESION_REVOCADA":             "Sesión cerrada",
+	"ULTIMA_SESION_ACTUALIZADA":   "Última sesión actualizada con éxito",
+	"DATOS_SUPRIMIDOS":            "Datos personales suprimidos",
+
+	// Validación de formularios
+	"nombres.obligatorio":     "El nombre es obligatorio",
+	"nombres.letras":          "El nombre solo debe contener letras",
+	"nombres.longitud":        "El nombre debe tener al menos 2 caracteres",
+	"apellidos.obligatorio":   "El apellido es obligatorio",
+	"apellidos.letras":        "El apellido solo debe contener letras",
+	"apellidos.longitud":      "El apellido debe tener al menos 2 caracteres",
+	"cedula.obligatorio":      "La cédula es obligatoria",
+	"cedula.numeros":          "La cédula solo debe contener números",
+	"cedula.longitud":         "La cédula debe tener entre 5 y 12 dígitos",
+	"correo.obligatorio":      "El correo electrónico es obligatorio",
+	"correo.formato":          "Ingrese un correo electrónico válido",
+	"telefono.obligatorio":    "El teléfono es obligatorio",
+	"telefono.numeros":        "El teléfono solo debe contener números",
+	"telefono.longitud":       "El teléfono debe tener entre 7 y 15 dígitos",
+	"contrasena.obligatorio":  "La contraseña es obligatoria",
+	"contrasena.longitud":     "La contraseña debe tener al menos 8 caracteres",
+	"contrasena.complejidad":  "La contraseña debe contener al menos una letra minúscula, una mayúscula, un número y un carácter especial",
+	"foto.obligatorio":        "La foto es obligatoria",
+	"foto.formato":            "La foto debe ser una imagen JPEG o PNG de hasta 4096×4096 píxeles",
+	"roles.desconocido":       "Hay roles desconocidos. Use admin, organizador, porteria o cliente",
+	"roles.admin_propio":      "No puede quitarse a sí mismo el rol de administrador",
+	"permisos.desconocido":    "Hay permisos desconocidos",
+	"organizador.obligatorio": "Los roles organizador y porteria requieren un organizador",
+	"organizador.desconocido": "El organizador no existe",
+	"organizador.nombre":      "El nombre del organizador es obligatorio",
+	"organizador.nit":         "El NIT debe tener entre 6 y 12 dígitos y, opcionalmente, el dígito de verificación",
+	"escenarios.invalidos":    "Cada escenario necesita nombre, ciudad y zonas con nombre y capacidad",
+	"escenarios.en_uso":       "No se puede quitar un escenario que tiene eventos",
+	"pago.incompleto":         "Los datos de pago requieren banco, titular y documento del titular",
+	"pago.tipo_cuenta":        "El tipo de cuenta debe ser ahorros o corriente",
+	"pago.numero_cuenta":      "El número de cuenta debe tener entre 6 y 20 dígitos",
+	"evento.nombre":           "El nombre del evento es obligatorio",
+	"evento.fecha":            "La fecha del evento es obligatoria",
+	"evento.escenario":        "El escenario no es del organizador",
+	"evento.precios":          "Cada precio debe ser mayor que cero y de una zona del escenario",
+	"zona.sin_precio":         "El evento no vende boletas en esa zona",
+	"auditoria.objetivo":      "El objetivo debe ser un ID válido",
+	"auditoria.fecha":         "La fecha debe ir en formato RFC 3339, por ejemplo 2024-05-01T00:00:00Z",
+	"auditoria.limite":        "El límite debe estar entre 1 y 500",
+
+	// Correos
+	"correo.restablecer.asunto": "Restablecer su contraseña de QR-TixPro",
+	"correo.restablecer.texto":  "Recibimos una solicitud para restablecer la contraseña de su cuenta.\n\nPara elegir una nueva, abra este enlace:\n%s\n\nEl enlace vence en %d minutos y solo se puede usar una vez. Si no fue usted, ignore este correo: su contraseña no cambiará.",
+	"correo.confirmar.asunto":   "Confirme su correo en QR-TixPro",
+	"correo.confirmar.texto":    "Gracias por registrarse en QR-TixPro.\n\nPara confirmar su correo y poder comprar boletas, abra este enlace:\n%s\n\nEl enlace vence en %d horas. Si no creó esta cuenta, ignore este correo.",
+}
+
+var inglesEstadosUnidos = map[string]string{
+	// Errors
+	"DATOS_INVALIDOS":             "Invalid data",
+	"VALIDACION_FALLIDA":          "Some fields have errors. Please review them and try again",
+	"CAMPOS_OBLIGATORIOS":         "Required fields are missing",
+	"TAMANO_INVALIDO":             "Size must be between 32 and 512 pixels",
+	"CEDULA_DUPLICADA":            "A user with this ID number already exists",
+	"CORREO_DUPLICADO":            "A user with this email address already exists",
+	"USUARIO_NO_ENCONTRADO":       "User not found",
+	"CREDENCIALES_INVALIDAS":      "Incorrect ID number or password",
+	"AUTENTICACION_REQUERIDA":     "Authentication required",
+	"VERIFICACION_FACIAL_FALLIDA": "Face verification failed",
+	"FOTO_NO_DISPONIBLE":          "The user has no photo available",
+	"TIEMPO_AGOTADO":              "The server took too long to respond. Please try again",
+	"LIMITE_EXCEDIDO":             "Too many attempts. Please wait a moment before trying again",
+	"CUENTA_BLOQUEADA":            "The account is temporarily locked after failed attempts. Please try again later",
+	"RETO_INVALIDO":               "The sign-in request is invalid or has expired. Please start again",
+	"TOKEN_INVALIDO":              "The link is invalid, has already been used or has expired. Please request a new one",
+	"CORREO_NO_VERIFICADO":        "Confirm your email address before buying tickets",
+	"CODIGO_REQUERIDO":            "Enter the code from your authenticator app",
+	"CODIGO_INVALIDO":             "The code is invalid or has already been used",
+	"TOTP_YA_ACTIVO":              "Authenticator app sign-in is already enabled",
+	"TOTP_SIN_INSCRIPCION":        "There is no authenticator app enrollment in progress",
+	"PASSKEY_INVALIDA":            "The passkey is not valid. Try again or use another method",
+	"PASSKEY_NO_ENCONTRADA":       "The passkey does not exist",
+	"LIMITE_PASSKEYS":             "You already have the maximum number of passkeys or that passkey is already registered",
+	"TOKEN_GOOGLE_INVALIDO":       "The Google sign-in could not be validated. Please try again",
+	"CORREO_GOOGLE_NO_VERIFICADO": "The Google account does not have a verified email address",
+	"GOOGLE_YA_VINCULADA":         "The email address is already linked to another Google account",
+	"PERMISO_DENEGADO":            "You do not have permission to perform this operation",
+	"VENTA_NO_ENCONTRADA":         "Sale not found",
+	"BOLETA_INVALIDA":             "The ticket does not belong to a completed sale",
+	"BOLETA_YA_USADA":             "The ticket has already been used to enter",
+	"ORGANIZADOR_NO_ENCONTRADO":   "Organizer not found",
+	"EVENTO_NO_ENCONTRADO":        "The event does not exist or is not on sale",
+	"SESION_INVALIDA":             "The session does not exist, has expired or was closed; sign in again",
+	"SESION_NO_ENCONTRADA":        "The session does not exist or was already closed",
+	"SEGUNDO_FACTOR_REQUERIDO":    "To change this, sign in again using your second factor",
+	"PERFIL_COMPLETO":             "The account already has an ID number; update it from your user details",
+	"SERVICIO_NO_DISPONIBLE":      "The service is currently unavailable",
+	"RUTA_NO_ENCONTRADA":          "The requested route does not exist",
+	"METODO_NO_PERMITIDO":         "Method not allowed for this route",
+	"ERROR_INTERNO":               "Internal server error. Please try again later",
+
+	// Successes
+	"VENTA_REGISTRADA":            "Purchase registered successfully",
+	"USUARIO_REGISTRADO":          "User registered successfully. Check your email to confirm it",
+	"USUARIO_ACTUALIZADO":         "User updated successfully",
+	"USUARIO_ELIMINADO":           "User deleted successfully",
+	"INICIO_SESION_EXITOSO":       "Signed in successfully",
+	"VERIFICACION_FACIAL_EXITOSA": "Face verification succeeded",
+	"RETO_EMITIDO":                "If the email address is registered, continue with face verification",
+	"RESTABLECIMIENTO_SOLICITADO": "If the email address is registered, you will receive a link to reset your password",
+	"CONTRASENA_RESTABLECIDA":     "Password reset. Sign in with your new password",
+	"CORREO_CONFIRMADO":           "Email address confirmed. You can now buy tickets",
+	"CONFIRMACION_REENVIADA":      "If the email address is awaiting confirmation, you will receive a new link",
+	"TOTP_ACTIVADO":               "Authenticator app enabled. Keep the recovery codes somewhere safe",
+	"TOTP_DESACTIVADO":            "Authenticator app disabled. Face verification will be used again",
+	"PASSKEY_REGISTRADA":          "Passkey registered",
+	"PASSKEY_ELIMINADA":           "Passkey deleted",
+	"CUENTA_GOOGLE_CREADA":        "Account created with Google. Complete your profile to buy tickets",
+	"PERFIL_COMPLETADO":           "Profile completed. You can now buy tickets",
+	"ROLES_ACTUALIZADOS":          "Roles updated",
+	"INGRESO_REGISTRADO":          "Entry recorded",
+	"ORGANIZADOR_CREADO":          "Organizer created",
+	"ORGANIZADOR_ACTUALIZADO":     "Organizer updated",
+	"EVENTO_CREADO":               "Event created",
+	"EVENTO_ACTUALIZADO":          "Event updated",
+	"SESION_REVOCADA":             "Session closed",
+	"ULTIMA_SESION_ACTUALIZADA":   "Last sign-in updated successfully",
+	"DATOS_SUPRIMIDOS":            "Personal data erased",
+
+	// Form validation
+	"nombres.obligatorio":     "First name is required",
+	"nombres.letras":          "First name must contain only letters",
+	"nombres.longitud":        "First name must be at least 2 characters long",
+	"apellidos.obligatorio":   "Last name is required",
+	"apellidos.letras":        "Last name must contain only letters",
+	"apellidos.longitud":      "Last name must be at least 2 characters long",
+	"cedula.obligatorio":      "ID number is required",
+	"cedula.numeros":          "ID number must contain only digits",
+	"cedula.longitud":         "ID number must be between 5 and 12 digits",
+	"correo.obligatorio":      "Email address is required",
+	"correo.formato":          "Enter a valid email address",
+	"telefono.obligatorio":    "Phone number is required",
+	"telefono.numeros":        "Phone number must contain only digits",
+	"telefono.longitud":       "Phone number must be between 7 and 15 digits",
+	"contrasena.obligatorio":  "Password is required",
+	"contrasena.longitud":     "Password must be at least 8 characters long",
+	"contrasena.complejidad":  "Password must contain at least one lowercase letter, one uppercase letter, one number and one special character",
+	"foto.obligatorio":        "Photo is required",
+	"foto.formato":            "Photo must be a JPEG or PNG image of up to 4096×4096 pixels",
+	"roles.desconocido":       "Unknown roles. Use admin, organizador, porteria or cliente",
+	"roles.admin_propio":      "You cannot remove the administrator role from yourself",
+	"permisos.desconocido":    "Unknown permissions",
+	"organizador.obligatorio": "The organizador and porteria roles require an organizer",
+	"organizador.desconocido": "The organizer does not exist",
+	"organizador.nombre":      "The organizer name is required",
+	"organizador.nit":         "The tax ID must have 6 to 12 digits and, optionally, the check digit",
+	"escenarios.invalidos":    "Each venue needs a name, a city and zones with name and capacity",
+	"escenarios.en_uso":       "A venue that has events cannot be removed",
+	"pago.incompleto":         "Payout details require bank, account holder and holder ID",
+	"pago.tipo_cuenta":        "Account type must be ahorros or corriente",
+	"pago.numero_cuenta":      "Account number must have 6 to 20 digits",
+	"evento.nombre":           "The event name is required",
+	"evento.fecha":            "The event date is required",
+	"evento.escenario":        "The venue does not belong to the organizer",
+	"evento.precios":          "Each price must be greater than zero and for a zone of the venue",
+	"zona.sin_precio":         "The event does not sell tickets in that zone",
+	"auditoria.objetivo":      "The target must be a valid ID",
+	"auditoria.fecha":         "The date must be in RFC 3339 format, for example 2024-05-01T00:00:00Z",
+	"auditoria.limite":        "The limit must be between 1 and 500",
+
+	// Emails
+	"correo.restablecer.asunto": "Reset your QR-TixPro password",
+	"correo.restablecer.texto":  "We received a request to reset the password for your account.\n\nTo choose a new one, open this link:\n%s\n\nThe link expires in %d minutes and can only be used once. If this wasn't you, ignore this email: your password will not change.",
+	"correo.confirmar.asunto":   "Confirm your email address for QR-TixPro",
+	"correo.confirmar.texto":    "Thank you for signing up for QR-TixPro.\n\nTo confirm your email address and be able to buy tickets, open this link:\n%s\n\nThe link expires in %d hours. If you didn't create this account, ignore this email.",
+}
@@ -0,0 +1,54 @@
+// Package mensajes traduce los mensajes de la API al idioma del cliente.
+//
+// Cada mensaje se identifica con una clave estable: el código de error para
+// los errores (USUARIO_NO_ENCONTRADO), un código de éxito para las respuestas
+// correctas (USUARIO_REGISTRADO) y campo.regla para la validación de
+// formularios (cedula.longitud). El idioma se elige con Accept-Language entre
+// los que tienen catálogo; si ninguno coincide se usa es-CO.
+package mensajes
+
+import "golang.org/x/text/language"
+
+const (
+	EspanolColombia     = "es-CO"
+	InglesEstadosUnidos = "en-US"
+
+	// PorDefecto es el idioma cuando el cliente no pide ninguno que conozcamos.
+	PorDefecto = EspanolColombia
+)
+
+var (
+	idiomas  = []string{EspanolColombia, InglesEstadosUnidos}
+	matcher  = language.NewMatcher([]language.Tag{language.MustParse(EspanolColombia), language.MustParse(InglesEstadosUnidos)})
+	catalogo = map[string]map[string]string{
+		EspanolColombia:     espanolColombia,
+		InglesEstadosUnidos: inglesEstadosUnidos,
+	}
+)
+
+// Resolver elige el idioma para un encabezado Accept-Language. Un "en-GB" o
+// un "en" se resuelven a en-US y cualquier variante de español a es-CO.
+func Resolver(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return PorDefecto
+	}
+	_, indice, confianza := matcher.Match(tags...)
+	if confianza == language.No {
+		return PorDefecto
+	}
+	return idiomas[indice]
+}
+
+// Texto devuelve el mensaje de clave en idioma. Si falta la traducción usa el
+// idioma por defecto y, en último caso, la clave misma para que el hueco sea
+// visible sin romper la respuesta.
+func Texto(idioma, clave string) string {
+	if t, ok := catalogo[idioma][clave]; ok {
+		return t
+	}
+	if t, ok := catalogo[PorDefecto][clave]; ok {
+		return t
+	}
+	return clave
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Métricas de Prometheus expuestas en /metrics.
+var (
+	metricaSolicitudes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qrtixpro_http_requests_total",
+		Help: "Solicitudes HTTP atendidas por ruta, método y código de estado.",
+	}, []string{"route", "method", "status"})
+
+	metricaDuracionSolicitudes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qrtixpro_http_request_duration_seconds",
+		Help:    "Latencia de las solicitudes HTTP por ruta, método y código de estado.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	metricaDuracionMongo = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qrtixpro_mongo_operation_duration_seconds",
+		Help:    "Latencia de los comandos de MongoDB por base (atlas o local), colección y comando.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"database", "collection", "command", "outcome"})
+
+	metricaRetrasoReplica = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qrtixpro_mirror_replication_lag_seconds",
+		Help:    "Tiempo entre la escritura en MongoDB Atlas y su copia en MongoDB Local.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"collection"})
+
+	metricaFallosReplica = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qrtixpro_mirror_replication_failures_total",
+		Help: "Escrituras que no se pudieron copiar a MongoDB Local.",
+	}, []string{"collection"})
+
+	metricaDuracionFacePP = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qrtixpro_face_verification_duration_seconds",
+		Help:    "Latencia de las llamadas a Face++ por resultado (match, no_match o error).",
+		Buckets: []float64{.1, .25, .5, 1, 2, 3, 5, 8, 13},
+	}, []string{"outcome"})
+
+	metricaConfianzaFacePP = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "qrtixpro_face_verification_confidence",
+		Help:    "Distribución del nivel de confianza devuelto por Face++ (0 a 100).",
+		Buckets: prometheus.LinearBuckets(10, 10, 10),
+	})
+
+	metricaBoletasVendidas = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qrtixpro_tickets_sold_total",
+		Help: "Boletas vendidas por zona de la lista de precios del evento, o sin_evento.",
+	}, []string{"zone"})
+
+	metricaLimitadas = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qrtixpro_rate_limited_total",
+		Help: "Solicitudes rechazadas por límite de frecuencia (ip o identificador) o por cuenta bloqueada (bloqueo).",
+	}, []string{"limit"})
+)
+
+// middlewareMetricas cuenta las solicitudes HTTP y mide su latencia. Usa la
+// plantilla de la ruta (por ejemplo /usuarios/:cedula/foto) para no crear una
+// serie por cada cédula.
+func middlewareMetricas(c *gin.Context) {
+	inicio := time.Now()
+	c.Next()
+
+	ruta := c.FullPath()
+	if ruta == "" {
+		ruta = "no_encontrada"
+	}
+	estado := strconv.Itoa(c.Writer.Status())
+	metricaSolicitudes.WithLabelValues(ruta, c.Request.Method, estado).Inc()
+	metricaDuracionSolicitudes.WithLabelValues(ruta, c.Request.Method, estado).Observe(time.Since(inicio).Seconds())
+}
+
+// monitorMongo mide la latencia de cada comando enviado a la base indicada
+// ("atlas" o "local"). La colección solo viene en el evento de inicio, así que
+// se guarda por RequestID hasta que llega el de fin.
+func monitorMongo(base string) *event.CommandMonitor {
+	var enCurso sync.Map
+
+	terminar := func(requestID int64, comando string, duracion time.Duration, resultado string) {
+		coleccion, _ := enCurso.LoadAndDelete(requestID)
+		nombre, _ := coleccion.(string)
+		metricaDuracionMongo.WithLabelValues(base, nombre, comando, resultado).Observe(duracion.Seconds())
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			enCurso.Store(e.RequestID, coleccionDeComando(e.Command))
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			terminar(e.RequestID, e.CommandName, e.Duration, "ok")
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			terminar(e.RequestID, e.CommandName, e.Duration, "error")
+		},
+	}
+}
+
+// coleccionDeComando extrae la colección de un comando de MongoDB. En la
+// mayoría va como valor del primer campo ({"find": "usuarios"}); getMore la
+// lleva en el campo "collection".
+func coleccionDeComando(comando bson.Raw) string {
+	elementos, err := comando.Elements()
+	if err != nil || len(elementos) == 0 {
+		return ""
+	}
+	if nombre, ok := elementos[0].Value().StringValueOK(); ok {
+		return nombre
+	}
+	if nombre, ok := comando.Lookup("collection").StringValueOK(); ok {
+		return nombre
+	}
+	return ""
+}
+
+// zonaSinEvento es la etiqueta de las ventas sin evento, cuya zona es texto
+// libre del cliente que no se valida contra ninguna lista de precios.
+const zonaSinEvento = "sin_evento"
+
+// observarVenta cuenta las boletas de una venta registrada. Solo usa la zona
+// como etiqueta cuando precioDeEvento ya la validó, para que un cliente no
+// pueda crear series sin límite.
+func observarVenta(venta Venta) {
+	zona := zonaSinEvento
+	if !venta.EventoID.IsZero() {
+		zona = venta.Zona
+	}
+	metricaBoletasVendidas.WithLabelValues(zona).Add(float64(venta.Cantidad))
+}
+
+// observarReplica registra el resultado de copiar a MongoDB Local una
+// escritura que terminó en MongoDB Atlas en el instante desde.
+func observarReplica(coleccion string, desde time.Time, err error) {
+	if err != nil {
+		metricaFallosReplica.WithLabelValues(coleccion).Inc()
+		return
+	}
+	metricaRetrasoReplica.WithLabelValues(coleccion).Observe(time.Since(desde).Seconds())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tunombre/qrtixpro-backend/migrations"
+)
+
+// ejecutarMigraciones atiende el subcomando "migrate" (up | status) sobre
+// MongoDB Atlas y, si está conectada, sobre MongoDB Local.
+func ejecutarMigraciones(args []string) {
+	if len(args) != 1 || (args[0] != "up" && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, "Uso: qrtixpro-backend migrate [up|status]")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	fallo := false
+	for _, b := range basesConectadas() {
+		switch args[0] {
+		case "up":
+			aplicadas, err := migrations.Up(ctx, migrations.Entorno{DB: b.db, Llavero: llavero})
+			for _, m := range aplicadas {
+				log.Printf("✅ %s: migración %04d aplicada (%s)", b.nombre, m.Version, m.Descripcion)
+			}
+			if err != nil {
+				log.Printf("❌ ERROR: %s: %v", b.nombre, err)
+				fallo = true
+			} else if len(aplicadas) == 0 {
+				log.Printf("ℹ️ %s: no hay migraciones pendientes", b.nombre)
+			}
+		case "status":
+			estados, err := migrations.Status(ctx, b.db)
+			if err != nil {
+				log.Printf("❌ ERROR: %s: %v", b.nombre, err)
+				fallo = true
+				continue
+			}
+			fmt.Printf("%s:\n", b.nombre)
+			for _, e := range estados {
+				estado := "pendiente"
+				if e.Aplicada {
+					estado = "aplicada " + e.AplicadaEn.Format(time.RFC3339)
+				}
+				fmt.Printf("  %04d  %-50s  %s\n", e.Version, e.Descripcion, estado)
+			}
+		}
+	}
+
+	if fallo {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// logsFechaHoraComoFecha convierte logs.fecha_hora, guardado como texto
+// "2006-01-02 15:04:05" en hora de Colombia, a una fecha BSON. Solo toca los
+// documentos cuyo campo sigue siendo texto, por lo que es seguro repetirla.
+// Un texto que no tiene ese formato se deja como está en lugar de detener la
+// migración.
+func logsFechaHoraComoFecha(ctx context.Context, e Entorno) error {
+	_, err := e.DB.Collection("logs").UpdateMany(ctx,
+		bson.M{"fecha_hora": bson.M{"$type": "string"}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"fecha_hora": bson.M{"$dateFromString": bson.M{
+					"dateString": "$fecha_hora",
+					"format":     "%Y-%m-%d %H:%M:%S",
+					"timezone":   "America/Bogota",
+					"onError":    "$fecha_hora",
+				}},
+			}}},
+		},
+	)
+	return err
+}
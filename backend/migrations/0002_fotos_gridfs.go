@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/tunombre/qrtixpro-backend/fotos"
+)
+
+// fotosAGridFS mueve las fotos embebidas en usuarios.foto al bucket GridFS y
+// deja solo la referencia foto_id en el documento. El foto_id se fija antes de
+// subir el archivo, así que si la migración se interrumpe, repetirla reemplaza
+// el archivo en lugar de dejar uno huérfano.
+func fotosAGridFS(ctx context.Context, e Entorno) error {
+	usuarios := e.DB.Collection("usuarios")
+	almacen := fotos.NuevoAlmacen(e.DB, e.Llavero)
+
+	cursor, err := usuarios.Find(ctx, bson.M{"foto": bson.M{"$type": "string", "$ne": ""}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID     primitive.ObjectID `bson:"_id"`
+			Foto   string             `bson:"foto"`
+			FotoID primitive.ObjectID `bson:"foto_id,omitempty"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+
+		if doc.FotoID.IsZero() {
+			doc.FotoID = primitive.NewObjectID()
+			_, err := usuarios.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"foto_id": doc.FotoID}})
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := almacen.Eliminar(ctx, doc.FotoID); err != nil {
+			return err
+		}
+		if err := almacen.Guardar(ctx, doc.FotoID, doc.Foto); err != nil {
+			if errors.Is(err, fotos.ErrFotoInvalida) {
+				// La foto queda embebida; el login sigue usándola mientras tanto.
+				log.Printf("⚠️ Advertencia: foto inválida para el usuario %s, se deja sin migrar", doc.ID.Hex())
+				_, err = usuarios.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$unset": bson.M{"foto_id": ""}})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		_, err := usuarios.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$unset": bson.M{"foto": ""}})
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,135 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/tunombre/qrtixpro-backend/cifrado"
+	"github.com/tunombre/qrtixpro-backend/fotos"
+)
+
+// camposCifrados indica qué campos de texto se cifran en cada colección.
+var camposCifrados = map[string][]string{
+	"usuarios": {"cedula", "correo", "telefono"},
+	"ventas":   {"cedula", "correo", "telefono", "direccion"},
+}
+
+// cifrarDatosPersonales cifra los campos personales de usuarios y ventas que
+// aún estén en texto plano, calcula los índices ciegos de cédula y correo,
+// cambia la cédula de los inicios de sesión en logs por su índice ciego y
+// cifra las fotos de GridFS. Solo procesa registros sin clave_datos y las
+// fotos en claro se borran después de guardar su copia cifrada, así que es
+// seguro repetirla.
+func cifrarDatosPersonales(ctx context.Context, e Entorno) error {
+	for nombre, campos := range camposCifrados {
+		if err := cifrarColeccion(ctx, e.DB.Collection(nombre), campos, e.Llavero); err != nil {
+			return fmt.Errorf("%s: %w", nombre, err)
+		}
+	}
+
+	_, err := e.DB.Collection("usuarios").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "cedula_hash", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "correo_hash", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("creando índices de usuarios: %w", err)
+	}
+	_, err = e.DB.Collection("ventas").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "cedula_hash", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("creando índices de ventas: %w", err)
+	}
+
+	if err := ocultarCedulasLogs(ctx, e.DB.Collection("logs"), e.Llavero); err != nil {
+		return fmt.Errorf("logs: %w", err)
+	}
+	_, err = e.DB.Collection("logs").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "cedula_hash", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("creando índices de logs: %w", err)
+	}
+
+	usuarios := e.DB.Collection("usuarios")
+	reemplazar := func(ctx context.Context, viejo, nuevo primitive.ObjectID) error {
+		_, err := usuarios.UpdateMany(ctx, bson.M{"foto_id": viejo}, bson.M{"$set": bson.M{"foto_id": nuevo}})
+		return err
+	}
+	if _, err := fotos.NuevoAlmacen(e.DB, e.Llavero).CifrarPendientes(ctx, reemplazar); err != nil {
+		return fmt.Errorf("fotos: %w", err)
+	}
+	return nil
+}
+
+func cifrarColeccion(ctx context.Context, coleccion *mongo.Collection, campos []string, llavero *cifrado.Llavero) error {
+	cursor, err := coleccion.Find(ctx, bson.M{"clave_datos": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+
+		dek, clave, err := llavero.NuevaClave()
+		if err != nil {
+			return err
+		}
+
+		cambios := bson.M{"clave_datos": clave}
+		for _, campo := range campos {
+			valor, _ := doc[campo].(string)
+			if valor != "" && (campo == "cedula" || campo == "correo") {
+				cambios[campo+"_hash"] = llavero.IndiceCiego(campo, valor)
+			}
+			if cambios[campo], err = cifrado.Cifrar(dek, valor); err != nil {
+				return err
+			}
+		}
+
+		if _, err := coleccion.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": cambios}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// ocultarCedulasLogs quita la cédula en claro de los inicios de sesión y deja
+// su índice ciego, por el que se siguen encontrando los registros anteriores
+// a usuario_id. Los que ya no tienen cédula no se tocan.
+func ocultarCedulasLogs(ctx context.Context, logs *mongo.Collection, llavero *cifrado.Llavero) error {
+	cursor, err := logs.Find(ctx, bson.M{"cedula": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"cedula": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID     any `bson:"_id"`
+			Cedula any `bson:"cedula"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+
+		cambios := bson.M{"$unset": bson.M{"cedula": ""}}
+		if cedula, _ := doc.Cedula.(string); cedula != "" {
+			cambios["$set"] = bson.M{"cedula_hash": llavero.IndiceCiego("cedula", cedula)}
+		}
+		if _, err := logs.UpdateOne(ctx, bson.M{"_id": doc.ID}, cambios); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
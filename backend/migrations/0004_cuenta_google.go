@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indiceCuentaGoogle crea el índice de usuarios.google_sub, con el que
+// /auth/google busca la cuenta vinculada. Es único para que una cuenta de
+// Google no quede vinculada a dos usuarios.
+func indiceCuentaGoogle(ctx context.Context, e Entorno) error {
+	_, err := e.DB.Collection("usuarios").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "google_sub", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	})
+	return err
+}
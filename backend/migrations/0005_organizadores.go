@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indicesOrganizadores crea los índices con los que se filtran por
+// organizador las ventas y los eventos, y el de la cartelera.
+func indicesOrganizadores(ctx context.Context, e Entorno) error {
+	_, err := e.DB.Collection("ventas").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "organizador_id", Value: 1}, {Key: "fecha", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.DB.Collection("eventos").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "organizador_id", Value: 1}, {Key: "fecha", Value: 1}}},
+		{Keys: bson.D{{Key: "publicado", Value: 1}, {Key: "fecha", Value: 1}}},
+	})
+	return err
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// indicesAuditoria crea los índices de las consultas de la auditoría: por
+// fecha y, dentro de cada filtro, de la más reciente a la más antigua.
+func indicesAuditoria(ctx context.Context, e Entorno) error {
+	_, err := e.DB.Collection("auditoria").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "fecha", Value: -1}}},
+		{Keys: bson.D{{Key: "actor.cedula_hash", Value: 1}, {Key: "fecha", Value: -1}}},
+		{Keys: bson.D{{Key: "objetivo.cedula_hash", Value: 1}, {Key: "fecha", Value: -1}}},
+		{Keys: bson.D{{Key: "objetivo.id", Value: 1}, {Key: "fecha", Value: -1}}},
+		{Keys: bson.D{{Key: "accion", Value: 1}, {Key: "fecha", Value: -1}}},
+	})
+	return err
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indicesSesiones crea el índice único del hash de las sesiones, por el que
+// se valida cada solicitud, y los de los listados de sesiones e inicios de
+// sesión de un usuario.
+func indicesSesiones(ctx context.Context, e Entorno) error {
+	_, err := e.DB.Collection("sesiones").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "usuario_id", Value: 1}, {Key: "ultimo_uso", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.DB.Collection("logs").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "usuario_id", Value: 1}, {Key: "fecha_hora", Value: -1}},
+	})
+	return err
+}
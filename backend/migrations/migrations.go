@@ -0,0 +1,141 @@
+// Package migrations aplica cambios de esquema versionados sobre las bases de
+// datos de QR-TixPro. Cada migración se registra en la colección
+// schema_migrations una vez aplicada, de modo que ejecutar "migrate up" varias
+// veces solo aplica las pendientes.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/tunombre/qrtixpro-backend/cifrado"
+)
+
+// Collection es el nombre de la colección donde se registran las migraciones aplicadas.
+const Collection = "schema_migrations"
+
+// Entorno agrupa lo que una migración necesita para ejecutarse.
+type Entorno struct {
+	DB      *mongo.Database
+	Llavero *cifrado.Llavero
+}
+
+// Migration describe un cambio de esquema. Up debe ser idempotente: si se
+// interrumpe a mitad de camino, volver a ejecutarla no debe dañar los datos.
+type Migration struct {
+	Version     int
+	Descripcion string
+	Up          func(ctx context.Context, e Entorno) error
+}
+
+// Estado indica si una migración ya fue aplicada en una base de datos.
+type Estado struct {
+	Migration
+	Aplicada   bool
+	AplicadaEn time.Time
+}
+
+type registro struct {
+	Version     int       `bson:"version"`
+	Descripcion string    `bson:"descripcion"`
+	AplicadaEn  time.Time `bson:"aplicada_en"`
+}
+
+// migraciones contiene todas las migraciones conocidas. Las nuevas se agregan
+// al final con la siguiente versión disponible.
+var migraciones = []Migration{
+	{Version: 1, Descripcion: "Convertir logs.fecha_hora de texto a fecha BSON", Up: logsFechaHoraComoFecha},
+	{Version: 2, Descripcion: "Mover las fotos de perfil de usuarios a GridFS", Up: fotosAGridFS},
+	{Version: 3, Descripcion: "Cifrar datos personales y crear índices ciegos", Up: cifrarDatosPersonales},
+	{Version: 4, Descripcion: "Índice único de la cuenta de Google vinculada", Up: indiceCuentaGoogle},
+	{Version: 5, Descripcion: "Índices por organizador de ventas y eventos", Up: indicesOrganizadores},
+	{Version: 6, Descripcion: "Índices de la auditoría", Up: indicesAuditoria},
+	{Version: 7, Descripcion: "Índices de las sesiones y los inicios de sesión", Up: indicesSesiones},
+}
+
+// All devuelve las migraciones registradas ordenadas por versión.
+func All() []Migration {
+	todas := make([]Migration, len(migraciones))
+	copy(todas, migraciones)
+	sort.Slice(todas, func(i, j int) bool { return todas[i].Version < todas[j].Version })
+	return todas
+}
+
+func aplicadas(ctx context.Context, db *mongo.Database) (map[int]registro, error) {
+	cursor, err := db.Collection(Collection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	resultado := make(map[int]registro)
+	for cursor.Next(ctx) {
+		var r registro
+		if err := cursor.Decode(&r); err != nil {
+			return nil, err
+		}
+		resultado[r.Version] = r
+	}
+	return resultado, cursor.Err()
+}
+
+// Status devuelve el estado de cada migración en la base de datos indicada.
+func Status(ctx context.Context, db *mongo.Database) ([]Estado, error) {
+	hechas, err := aplicadas(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("leyendo %s: %w", Collection, err)
+	}
+
+	var estados []Estado
+	for _, m := range All() {
+		r, ok := hechas[m.Version]
+		estados = append(estados, Estado{Migration: m, Aplicada: ok, AplicadaEn: r.AplicadaEn})
+	}
+	return estados, nil
+}
+
+// Up aplica en orden las migraciones pendientes y devuelve las que se aplicaron.
+// Se detiene en la primera que falle, dejando registradas las anteriores.
+func Up(ctx context.Context, e Entorno) ([]Migration, error) {
+	db := e.DB
+	_, err := db.Collection(Collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creando índice de %s: %w", Collection, err)
+	}
+
+	hechas, err := aplicadas(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("leyendo %s: %w", Collection, err)
+	}
+
+	var aplicadasAhora []Migration
+	for _, m := range All() {
+		if _, ok := hechas[m.Version]; ok {
+			continue
+		}
+
+		if err := m.Up(ctx, e); err != nil {
+			return aplicadasAhora, fmt.Errorf("migración %d (%s): %w", m.Version, m.Descripcion, err)
+		}
+
+		_, err := db.Collection(Collection).InsertOne(ctx, registro{
+			Version:     m.Version,
+			Descripcion: m.Descripcion,
+			AplicadaEn:  time.Now(),
+		})
+		if err != nil {
+			return aplicadasAhora, fmt.Errorf("registrando migración %d: %w", m.Version, err)
+		}
+		aplicadasAhora = append(aplicadasAhora, m)
+	}
+	return aplicadasAhora, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// configurarTLSAtlas aplica a las opciones del cliente de MongoDB Atlas la
+// configuración TLS: CA adicionales, certificado de cliente y, solo en
+// desarrollo, el modo inseguro. Si hay certificado de cliente y la URI no trae
+// credenciales, el cliente se autentica con MONGODB-X509.
+func configurarTLSAtlas(opts *options.ClientOptions) error {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	conf := cfg.Mongo.TLS
+
+	if conf.ArchivoCA != "" {
+		pem, err := os.ReadFile(conf.ArchivoCA)
+		if err != nil {
+			return fmt.Errorf("leyendo el bundle de CA: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("el bundle de CA no contiene certificados PEM válidos")
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if conf.CertificadoCliente != "" {
+		clave := conf.ClaveCliente
+		if clave == "" {
+			clave = conf.CertificadoCliente
+		}
+		certificado, err := tls.LoadX509KeyPair(conf.CertificadoCliente, clave)
+		if err != nil {
+			return fmt.Errorf("cargando el certificado de cliente: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{certificado}
+
+		if opts.Auth == nil {
+			opts.SetAuth(options.Credential{AuthMechanism: "MONGODB-X509"})
+		}
+	}
+
+	if conf.Inseguro {
+		tlsCfg.InsecureSkipVerify = true
+		log.Println("🚨🚨🚨 ATENCIÓN: la verificación TLS de MongoDB Atlas está DESACTIVADA (MONGO_TLS_INSEGURO)")
+		log.Println("🚨🚨🚨 Cualquiera en la red puede suplantar la base de datos. Usar solo en desarrollo local.")
+	}
+
+	opts.SetTLSConfig(tlsCfg)
+	return nil
+}
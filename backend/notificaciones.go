@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/tunombre/qrtixpro-backend/correo"
+)
+
+// timeoutCorreo limita cada envío. Los correos se envían fuera de la
+// solicitud, así que no retrasan la respuesta.
+const timeoutCorreo = 30 * time.Second
+
+var remitenteCorreo correo.Remitente
+
+// iniciarCorreo elige el remitente configurado. Sin servidor SMTP, lo que
+// Validar solo permite en desarrollo, los correos van a los logs.
+func iniciarCorreo() {
+	if cfg.Correo.Servidor == "" {
+		slog.Warn("Sin servidor SMTP: los correos se escribirán en los logs")
+		remitenteCorreo = correo.Registro{}
+		return
+	}
+	remitenteCorreo = correo.SMTP{
+		Servidor:   cfg.Correo.Servidor,
+		Usuario:    cfg.Correo.Usuario,
+		Contrasena: cfg.Correo.Contrasena,
+		De:         cfg.Correo.Remitente,
+	}
+}
+
+// enviarCorreo envía m en segundo plano. ctx solo aporta los valores de la
+// solicitud (request_id y traza) para los logs; su cancelación no corta el envío.
+func enviarCorreo(ctx context.Context, m correo.Mensaje) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeoutCorreo)
+	go func() {
+		defer cancel()
+		if err := remitenteCorreo.Enviar(ctx, m); err != nil {
+			slog.ErrorContext(ctx, "No se pudo enviar el correo", "para", m.Para, "asunto", m.Asunto, "error", err)
+		}
+	}()
+}
+
+// enlaceConToken agrega el token como parámetro "token" a una URL del frontend.
+func enlaceConToken(base, token string) string {
+	enlace, _ := url.Parse(base)
+	consulta := enlace.Query()
+	consulta.Set("token", token)
+	enlace.RawQuery = consulta.Encode()
+	return enlace.String()
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tunombre/qrtixpro-backend/mensajes"
+)
+
+const prefijoV1 = "/api/v1"
+
+// rutaAPI describe una operación de /api/v1. La misma tabla registra las
+// rutas en Gin y genera el documento OpenAPI, así que no pueden divergir.
+type rutaAPI struct {
+	Metodo    string
+	Ruta      string
+	Handler   gin.HandlerFunc
+	Operacion string
+	Resumen   string
+	Etiqueta  string
+	// Cuerpo es un valor del tipo que se decodifica del cuerpo; nil si no lleva.
+	Cuerpo any
+	// Parcial marca los cuerpos de PATCH, en los que ningún campo es obligatorio.
+	Parcial bool
+	// Consulta es un valor del tipo que se decodifica de la query string con
+	// ShouldBindQuery; nil si no lleva.
+	Consulta any
+	// Data es un valor del tipo que va en "data" al responder con éxito.
+	Data any
+	// Binario es el tipo MIME de la respuesta exitosa cuando no es JSON.
+	Binario string
+	// Errores son los estados HTTP de error que puede devolver.
+	Errores []int
+	// Titular indica que, además del permiso, solo el titular de la cédula
+	// puede llamarla; poder gestionar usuarios no basta.
+	Titular bool
+	// Permiso es el que exige exigirPermiso, con el token de una sesión. En
+	// las rutas con :cedula además la cédula tiene que ser la de quien llama.
+	Permiso string
+	// Limitada aplica el límite por IP de las rutas de autenticación.
+	Limitada bool
+}
+
+// rutasV1 es la API versionada. Las rutas antiguas de registrarRutasLegado
+// apuntan a los mismos handlers.
+var rutasV1 = []rutaAPI{
+	{
+		Metodo: http.MethodPost, Ruta: "/usuarios", Handler: registrarUsuario,
+		Operacion: "registrarUsuario", Resumen: "Registra un usuario con su foto", Etiqueta: "usuarios",
+		Cuerpo: Usuario{}, Errores: []int{400, 409, 500},
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/usuarios/:cedula", Handler: obtenerUsuario,
+		Operacion: "obtenerUsuario", Resumen: "Consulta un usuario por cédula", Etiqueta: "usuarios",
+		Data: datosUsuario{}, Errores: []int{401, 403, 404, 500, 504}, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodPatch, Ruta: "/usuarios/:cedula", Handler: actualizarUsuario,
+		Operacion: "actualizarUsuario", Resumen: "Actualiza los campos enviados de un usuario", Etiqueta: "usuarios",
+		Cuerpo: Usuario{}, Parcial: true, Errores: []int{400, 401, 403, 404, 409, 500}, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodDelete, Ruta: "/usuarios/:cedula", Handler: eliminarUsuario,
+		Operacion: "eliminarUsuario", Resumen: "Elimina un usuario y sus datos personales", Etiqueta: "usuarios",
+		Errores: []int{401, 403, 404, 500}, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodPut, Ruta: "/perfil", Handler: completarPerfil,
+		Operacion: "completarPerfil", Resumen: "Agrega cédula, teléfono y foto a la cuenta de la sesión creada con Google", Etiqueta: "usuarios",
+		Cuerpo: solicitudPerfil{}, Errores: []int{400, 401, 403, 409, 500}, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodPut, Ruta: "/usuarios/:cedula/ultima-sesion", Handler: actualizarUltimaSesion,
+		Operacion: "actualizarUltimaSesion", Resumen: "Registra la hora actual del servidor como última sesión", Etiqueta: "usuarios",
+		Errores: []int{400, 401, 403, 404, 500}, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodPut, Ruta: "/usuarios/:cedula/roles", Handler: asignarRoles,
+		Operacion: "asignarRoles", Resumen: "Reemplaza los roles, permisos y organizador de un usuario", Etiqueta: "usuarios",
+		Cuerpo: solicitudRoles{}, Data: datosRoles{}, Errores: []int{400, 401, 403, 404, 500}, Permiso: permisoGestionarUsuarios,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/usuarios/:cedula/foto", Handler: obtenerMiniatura,
+		Operacion: "obtenerMiniatura", Resumen: "Devuelve la miniatura JPEG de la foto del titular", Etiqueta: "datos personales",
+		Binario: "image/jpeg", Errores: []int{400, 401, 403, 404, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/usuarios/:cedula/datos", Handler: exportarDatosPersonales,
+		Operacion: "exportarDatosPersonales", Resumen: "Exporta todos los datos personales del titular", Etiqueta: "datos personales",
+		Data: map[string]any{}, Errores: []int{401, 403, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodDelete, Ruta: "/usuarios/:cedula/datos", Handler: solicitarSupresion,
+		Operacion: "suprimirDatosPersonales", Resumen: "Suprime los datos personales del titular", Etiqueta: "datos personales",
+		Data: registroSupresion{}, Errores: []int{401, 403, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/usuarios/:cedula/totp", Handler: iniciarTOTP,
+		Operacion: "iniciarTOTP", Resumen: "Genera un secreto TOTP pendiente y su código QR", Etiqueta: "autenticación",
+		Data: datosInscripcionTOTP{}, Errores: []int{401, 403, 409, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/usuarios/:cedula/totp/activacion", Handler: activarTOTP,
+		Operacion: "activarTOTP", Resumen: "Activa TOTP como segundo factor y entrega los códigos de recuperación", Etiqueta: "autenticación",
+		Cuerpo: solicitudCodigoTOTP{}, Data: datosCodigosRecuperacion{}, Errores: []int{400, 401, 403, 409, 429, 500}, Titular: true, Permiso: permisoDatosPropios, Limitada: true,
+	},
+	{
+		Metodo: http.MethodDelete, Ruta: "/usuarios/:cedula/totp", Handler: desactivarTOTP,
+		Operacion: "desactivarTOTP", Resumen: "Vuelve a la verificación facial con un código TOTP o de recuperación", Etiqueta: "autenticación",
+		Cuerpo: solicitudCodigoTOTP{}, Errores: []int{400, 401, 403, 409, 423, 429, 500}, Titular: true, Permiso: permisoDatosPropios, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/usuarios/:cedula/passkeys/ceremonias", Handler: iniciarRegistroPasskey,
+		Operacion: "iniciarRegistroPasskey", Resumen: "Emite el desafío para registrar una llave de acceso", Etiqueta: "autenticación",
+		Data: datosCeremoniaPasskey{}, Errores: []int{401, 403, 409, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/usuarios/:cedula/passkeys", Handler: registrarPasskey,
+		Operacion: "registrarPasskey", Resumen: "Guarda la llave de acceso creada por el navegador", Etiqueta: "autenticación",
+		Cuerpo: solicitudRegistroPasskey{}, Data: datosPasskey{}, Errores: []int{400, 401, 403, 409, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/usuarios/:cedula/passkeys", Handler: listarPasskeys,
+		Operacion: "listarPasskeys", Resumen: "Lista las llaves de acceso del titular", Etiqueta: "autenticación",
+		Data: []datosPasskey{}, Errores: []int{401, 403, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodDelete, Ruta: "/usuarios/:cedula/passkeys/:id", Handler: eliminarPasskey,
+		Operacion: "eliminarPasskey", Resumen: "Elimina una llave de acceso del titular", Etiqueta: "autenticación",
+		Errores: []int{400, 401, 403, 404, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/usuarios/:cedula/sesiones", Handler: listarSesiones,
+		Operacion: "listarSesiones", Resumen: "Lista las sesiones vigentes del titular", Etiqueta: "autenticación",
+		Data: []sesion{}, Errores: []int{401, 403, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodDelete, Ruta: "/usuarios/:cedula/sesiones/:id", Handler: revocarSesion,
+		Operacion: "revocarSesion", Resumen: "Revoca una sesión del titular", Etiqueta: "autenticación",
+		Errores: []int{401, 403, 404, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/usuarios/:cedula/inicios-sesion", Handler: listarIniciosSesion,
+		Operacion: "listarIniciosSesion", Resumen: "Lista los intentos de inicio de sesión recientes del titular", Etiqueta: "autenticación",
+		Data: []inicioSesion{}, Errores: []int{401, 403, 500}, Titular: true, Permiso: permisoDatosPropios,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/sesiones/passkey/ceremonias", Handler: iniciarSesionPasskey,
+		Operacion: "iniciarSesionPasskey", Resumen: "Emite el desafío para entrar con una llave de acceso", Etiqueta: "autenticación",
+		Data: datosCeremoniaPasskey{}, Errores: []int{429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/sesiones/passkey", Handler: completarSesionPasskey,
+		Operacion: "completarSesionPasskey", Resumen: "Inicia sesión con la firma de una llave de acceso, sin contraseña ni rostro", Etiqueta: "autenticación",
+		Cuerpo: solicitudInicioPasskey{}, Data: datosSesion{}, Errores: []int{400, 401, 423, 429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/auth/google", Handler: iniciarSesionGoogle,
+		Operacion: "iniciarSesionGoogle", Resumen: "Inicia sesión con un ID token de Google; vincula o crea la cuenta por el correo verificado", Etiqueta: "autenticación",
+		Cuerpo: solicitudSesionGoogle{}, Data: datosSesionGoogle{}, Errores: []int{400, 401, 409, 423, 429, 500, 503}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/sesiones", Handler: iniciarSesion,
+		Operacion: "iniciarSesion", Resumen: "Inicia sesión con cédula, contraseña y el segundo factor del usuario", Etiqueta: "autenticación",
+		Cuerpo: solicitudInicioSesion{}, Data: datosSesion{}, Errores: []int{400, 401, 423, 429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/verificaciones/correo", Handler: verificarCorreo,
+		Operacion: "verificarCorreo", Resumen: "Emite un reto de inicio de sesión para un correo, esté o no registrado", Etiqueta: "autenticación",
+		Cuerpo: solicitudVerificarCorreo{}, Data: datosReto{}, Errores: []int{400, 429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/verificaciones/rostro", Handler: verificarRostro,
+		Operacion: "verificarRostro", Resumen: "Canjea un reto con el segundo factor del usuario: foto o código TOTP", Etiqueta: "autenticación",
+		Cuerpo: solicitudVerificarRostro{}, Data: datosSesion{}, Errores: []int{400, 401, 423, 429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/password/olvido", Handler: olvidoContrasena,
+		Operacion: "olvidoContrasena", Resumen: "Envía un enlace para restablecer la contraseña, si el correo está registrado", Etiqueta: "autenticación",
+		Cuerpo: solicitudOlvidoContrasena{}, Errores: []int{400, 429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/password/restablecer", Handler: restablecerContrasena,
+		Operacion: "restablecerContrasena", Resumen: "Fija una contraseña nueva con el token del correo", Etiqueta: "autenticación",
+		Cuerpo: solicitudRestablecerContrasena{}, Errores: []int{400, 429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/confirmaciones-correo", Handler: confirmarCorreo,
+		Operacion: "confirmarCorreo", Resumen: "Confirma el correo con el token del enlace y activa la cuenta", Etiqueta: "usuarios",
+		Cuerpo: solicitudConfirmarCorreo{}, Errores: []int{400, 429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/confirmaciones-correo/reenvio", Handler: reenviarConfirmacion,
+		Operacion: "reenviarConfirmacion", Resumen: "Envía otro enlace de confirmación, si el correo está pendiente", Etiqueta: "usuarios",
+		Cuerpo: solicitudReenviarConfirmacion{}, Errores: []int{400, 429, 500}, Limitada: true,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/ventas", Handler: registrarVenta,
+		Operacion: "registrarVenta", Resumen: "Registra la compra de boletas a nombre de quien llama; con evento, al precio de su zona", Etiqueta: "ventas",
+		Cuerpo: Venta{}, Data: datosVentaRegistrada{}, Errores: []int{400, 401, 403, 404, 500}, Permiso: permisoComprar,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/ventas", Handler: listarVentas,
+		Operacion: "listarVentas", Resumen: "Lista las ventas propias, las de los eventos del organizador propio o, para el administrador, todas", Etiqueta: "ventas",
+		Data: []Venta{}, Errores: []int{401, 403, 500}, Permiso: permisoConsultarVentas,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/eventos", Handler: listarCartelera,
+		Operacion: "listarCartelera", Resumen: "Lista los eventos publicados que aún no han pasado, con sus precios", Etiqueta: "eventos",
+		Data: []Evento{}, Errores: []int{500},
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/organizadores", Handler: crearOrganizador,
+		Operacion: "crearOrganizador", Resumen: "Da de alta un organizador con sus escenarios y datos de pago", Etiqueta: "organizadores",
+		Cuerpo: Organizador{}, Data: Organizador{}, Errores: []int{400, 401, 403, 500}, Permiso: permisoGestionarOrganizadores,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/organizadores", Handler: listarOrganizadores,
+		Operacion: "listarOrganizadores", Resumen: "Lista los organizadores con los datos de pago enmascarados", Etiqueta: "organizadores",
+		Data: []Organizador{}, Errores: []int{401, 403, 500}, Permiso: permisoGestionarOrganizadores,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/organizadores/:organizador", Handler: obtenerOrganizador,
+		Operacion: "obtenerOrganizador", Resumen: "Consulta el organizador propio, con los datos de pago enmascarados", Etiqueta: "organizadores",
+		Data: Organizador{}, Errores: []int{401, 403, 404, 500}, Permiso: permisoGestionarEventos,
+	},
+	{
+		Metodo: http.MethodPatch, Ruta: "/organizadores/:organizador", Handler: actualizarOrganizador,
+		Operacion: "actualizarOrganizador", Resumen: "Actualiza los datos, escenarios o datos de pago del organizador propio", Etiqueta: "organizadores",
+		Cuerpo: Organizador{}, Parcial: true, Data: Organizador{}, Errores: []int{400, 401, 403, 404, 500}, Permiso: permisoGestionarEventos,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/organizadores/:organizador/eventos", Handler: crearEvento,
+		Operacion: "crearEvento", Resumen: "Crea un evento en un escenario del organizador con precios por zona", Etiqueta: "eventos",
+		Cuerpo: Evento{}, Data: Evento{}, Errores: []int{400, 401, 403, 404, 500}, Permiso: permisoGestionarEventos,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/organizadores/:organizador/eventos", Handler: listarEventosOrganizador,
+		Operacion: "listarEventosOrganizador", Resumen: "Lista los eventos del organizador, publicados o no", Etiqueta: "eventos",
+		Data: []Evento{}, Errores: []int{401, 403, 404, 500}, Permiso: permisoGestionarEventos,
+	},
+	{
+		Metodo: http.MethodPatch, Ruta: "/organizadores/:organizador/eventos/:evento", Handler: actualizarEvento,
+		Operacion: "actualizarEvento", Resumen: "Actualiza los campos enviados de un evento del organizador", Etiqueta: "eventos",
+		Cuerpo: Evento{}, Parcial: true, Data: Evento{}, Errores: []int{400, 401, 403, 404, 500}, Permiso: permisoGestionarEventos,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/organizadores/:organizador/reporte", Handler: reporteVentas,
+		Operacion: "reporteVentas", Resumen: "Resume por evento y zona las ventas, ingresos y recaudo del organizador", Etiqueta: "organizadores",
+		Data: []filaReporte{}, Errores: []int{401, 403, 404, 500}, Permiso: permisoConsultarReportes,
+	},
+	{
+		Metodo: http.MethodPost, Ruta: "/ventas/:id/ingresos", Handler: registrarIngreso,
+		Operacion: "registrarIngreso", Resumen: "Registra en portería el ingreso con una boleta del organizador propio; cada boleta sirve una vez", Etiqueta: "ventas",
+		Cuerpo: solicitudIngreso{}, Data: datosIngreso{}, Errores: []int{400, 401, 403, 404, 409, 500}, Permiso: permisoRegistrarIngresos,
+	},
+	{
+		Metodo: http.MethodGet, Ruta: "/auditoria", Handler: consultarAuditoria,
+		Operacion: "consultarAuditoria", Resumen: "Consulta los cambios registrados, del más reciente al más antiguo", Etiqueta: "auditoría",
+		Consulta: filtroAuditoria{}, Data: []registroAuditoria{}, Errores: []int{400, 401, 403, 500}, Permiso: permisoConsultarAuditoria,
+	},
+}
+
+// registrarRutasV1 monta /api/v1 y su documento OpenAPI.
+func registrarRutasV1(r *gin.Engine) {
+	v1 := r.Group(prefijoV1)
+	for _, ruta := range rutasV1 {
+		var cadena []gin.HandlerFunc
+		if ruta.Limitada {
+			cadena = append(cadena, limitarPorIP)
+		}
+		if ruta.Permiso != "" {
+			cadena = append(cadena, exigirPermiso(ruta.Permiso))
+		}
+		v1.Handle(ruta.Metodo, ruta.Ruta, append(cadena, ruta.Handler)...)
+	}
+	v1.GET("/openapi.json", servirOpenAPI)
+}
+
+// obsoleta marca una ruta antigua con el encabezado Deprecation (RFC 9745) y
+// un Link a la documentación y, si se puede resolver, a la ruta de /api/v1
+// que la reemplaza. {cedula} se completa con la de la ruta; en las rutas que
+// la reciben en el cuerpo solo queda el enlace a la documentación.
+func obsoleta(sucesora string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		enlaces := "<" + prefijoV1 + `/openapi.json>; rel="deprecation"`
+		if cedula := c.Param("cedula"); cedula != "" || !strings.Contains(sucesora, "{cedula}") {
+			ruta := strings.ReplaceAll(sucesora, "{cedula}", url.PathEscape(cedula))
+			enlaces += ", <" + prefijoV1 + ruta + `>; rel="successor-version"`
+		}
+		c.Header("Link", enlaces)
+		c.Next()
+	}
+}
+
+var documentoOpenAPI = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(generarOpenAPI(rutasV1))
+})
+
+func servirOpenAPI(c *gin.Context) {
+	doc, err := documentoOpenAPI()
+	if err != nil {
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", doc)
+}
+
+var parametroRuta = regexp.MustCompile(`:(\w+)`)
+
+// generarOpenAPI arma el documento OpenAPI 3 de las rutas indicadas. Los
+// esquemas de los cuerpos y de "data" salen de los tipos Go por reflexión,
+// con los nombres de sus etiquetas json.
+func generarOpenAPI(rutas []rutaAPI) gin.H {
+	esquemas := gin.H{
+		"Respuesta": gin.H{
+			"type":     "object",
+			"required": []string{"ok"},
+			"properties": gin.H{
+				"ok":         gin.H{"type": "boolean"},
+				"mensaje":    gin.H{"type": "string", "description": "Mensaje en el idioma de Accept-Language"},
+				"data":       gin.H{},
+				"request_id": gin.H{"type": "string"},
+			},
+		},
+		"Error": gin.H{
+			"type":     "object",
+			"required": []string{"ok", "codigo", "mensaje"},
+			"properties": gin.H{
+				"ok":         gin.H{"type": "boolean", "enum": []bool{false}},
+				"codigo":     gin.H{"type": "string", "enum": codigosDeError()},
+				"mensaje":    gin.H{"type": "string"},
+				"errores":    gin.H{"type": "object", "additionalProperties": gin.H{"type": "string"}},
+				"request_id": gin.H{"type": "string"},
+			},
+		},
+	}
+
+	paths := gin.H{}
+	for _, ruta := range rutas {
+		path := parametroRuta.ReplaceAllString(ruta.Ruta, "{$1}")
+		operaciones, _ := paths[path].(gin.H)
+		if operaciones == nil {
+			operaciones = gin.H{}
+			paths[path] = operaciones
+		}
+
+		parametros := parametrosDe(ruta.Ruta)
+		if ruta.Consulta != nil {
+			parametros = append(parametros, parametrosConsulta(reflect.TypeOf(ruta.Consulta), esquemas)...)
+		}
+		op := gin.H{
+			"operationId": ruta.Operacion,
+			"summary":     ruta.Resumen,
+			"tags":        []string{ruta.Etiqueta},
+			"parameters":  parametros,
+			"responses":   respuestasDe(ruta, esquemas),
+		}
+		if ruta.Cuerpo != nil {
+			cuerpo := gin.H{
+				"required": true,
+				"content":  gin.H{"application/json": gin.H{"schema": esquemaDe(reflect.TypeOf(ruta.Cuerpo), esquemas)}},
+			}
+			if ruta.Parcial {
+				cuerpo["description"] = "Solo se modifican los campos enviados; los demás conservan su valor"
+			}
+			op["requestBody"] = cuerpo
+		}
+		if ruta.Titular {
+			op["x-titular"] = true
+		}
+		if ruta.Permiso != "" {
+			op["security"] = []gin.H{{"sesion": []string{}}}
+			op["x-permiso"] = ruta.Permiso
+		}
+		operaciones[strings.ToLower(ruta.Metodo)] = op
+	}
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":       "QRTixPro API",
+			"version":     "1.0.0",
+			"description": "Las rutas sin prefijo (/registro, /login, ...) siguen disponibles como alias obsoletos.",
+		},
+		"servers": []gin.H{{"url": prefijoV1}},
+		"paths":   paths,
+		"components": gin.H{
+			"schemas": esquemas,
+			"parameters": gin.H{
+				"AcceptLanguage": gin.H{
+					"name": "Accept-Language", "in": "header",
+					"schema": gin.H{"type": "string", "enum": []string{mensajes.EspanolColombia, mensajes.InglesEstadosUnidos}},
+				},
+			},
+			"securitySchemes": gin.H{
+				"sesion": gin.H{"type": "http", "scheme": "bearer", "description": "Token de la sesión devuelto al iniciar sesión, de un usuario con el permiso de x-permiso. Con x-titular, además, del titular de la cédula"},
+			},
+		},
+	}
+}
+
+func parametrosDe(ruta string) []gin.H {
+	parametros := []gin.H{{"$ref": "#/components/parameters/AcceptLanguage"}}
+	for _, m := range parametroRuta.FindAllStringSubmatch(ruta, -1) {
+		parametros = append(parametros, gin.H{
+			"name": m[1], "in": "path", "required": true,
+			"schema": gin.H{"type": "string"},
+		})
+	}
+	return parametros
+}
+
+// parametrosConsulta describe los campos con etiqueta form de un struct como
+// parámetros opcionales de la query string.
+func parametrosConsulta(t reflect.Type, esquemas gin.H) []gin.H {
+	var parametros []gin.H
+	for i := 0; i < t.NumField(); i++ {
+		campo := t.Field(i)
+		nombre := campo.Tag.Get("form")
+		if nombre == "" || nombre == "-" {
+			continue
+		}
+		parametros = append(parametros, gin.H{
+			"name": nombre, "in": "query",
+			"schema": esquemaDe(campo.Type, esquemas),
+		})
+	}
+	return parametros
+}
+
+func respuestasDe(ruta rutaAPI, esquemas gin.H) gin.H {
+	exito := gin.H{"$ref": "#/components/schemas/Respuesta"}
+	if ruta.Data != nil {
+		exito = gin.H{"allOf": []any{
+			exito,
+			gin.H{"properties": gin.H{"data": esquemaDe(reflect.TypeOf(ruta.Data), esquemas)}},
+		}}
+	}
+	respuestas := gin.H{"200": gin.H{
+		"description": "OK",
+		"content":     gin.H{"application/json": gin.H{"schema": exito}},
+	}}
+	if ruta.Binario != "" {
+		respuestas["200"] = gin.H{
+			"description": "OK",
+			"content":     gin.H{ruta.Binario: gin.H{"schema": gin.H{"type": "string", "format": "binary"}}},
+		}
+	}
+	for _, estado := range ruta.Errores {
+		detalle := gin.H{
+			"description": http.StatusText(estado),
+			"content":     gin.H{"application/json": gin.H{"schema": gin.H{"$ref": "#/components/schemas/Error"}}},
+		}
+		if estado == http.StatusTooManyRequests || estado == http.StatusLocked {
+			detalle["headers"] = gin.H{"Retry-After": gin.H{
+				"description": "Segundos que hay que esperar antes de reintentar",
+				"schema":      gin.H{"type": "integer"},
+			}}
+		}
+		respuestas[strconv.Itoa(estado)] = detalle
+	}
+	return respuestas
+}
+
+var tipoTiempo = reflect.TypeOf(time.Time{})
+
+// esquemaDe traduce un tipo Go a un esquema OpenAPI. Los structs con nombre
+// se registran en esquemas y se devuelven como $ref.
+func esquemaDe(t reflect.Type, esquemas gin.H) gin.H {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == tipoTiempo:
+		return gin.H{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.String:
+		return gin.H{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return gin.H{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return gin.H{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return gin.H{"type": "array", "items": esquemaDe(t.Elem(), esquemas)}
+	case t.Kind() == reflect.Map:
+		return gin.H{"type": "object"}
+	case t.Kind() != reflect.Struct:
+		return gin.H{}
+	}
+
+	nombre := t.Name()
+	if nombre != "" {
+		if _, ok := esquemas[nombre]; ok {
+			return gin.H{"$ref": "#/components/schemas/" + nombre}
+		}
+		esquemas[nombre] = gin.H{} // evita recursión infinita
+	}
+
+	propiedades := gin.H{}
+	for i := 0; i < t.NumField(); i++ {
+		campo := t.Field(i)
+		etiqueta := campo.Tag.Get("json")
+		if !campo.IsExported() || etiqueta == "-" {
+			continue
+		}
+		nombreCampo, _, _ := strings.Cut(etiqueta, ",")
+		if nombreCampo == "" {
+			nombreCampo = campo.Name
+		}
+		propiedades[nombreCampo] = esquemaDe(campo.Type, esquemas)
+	}
+	esquema := gin.H{"type": "object", "properties": propiedades}
+
+	if nombre == "" {
+		return esquema
+	}
+	esquemas[nombre] = esquema
+	return gin.H{"$ref": "#/components/schemas/" + nombre}
+}
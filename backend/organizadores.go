@@ -0,0 +1,378 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/tunombre/qrtixpro-backend/cifrado"
+)
+
+// Un organizador es un promotor que vende por QR-TixPro: un club, una
+// productora, un teatro. Es el inquilino de la plataforma: sus eventos,
+// escenarios, precios, datos de pago y ventas solo los ven sus usuarios y
+// los administradores.
+
+// Tipos de cuenta bancaria para los pagos al organizador.
+const (
+	cuentaAhorros   = "ahorros"
+	cuentaCorriente = "corriente"
+)
+
+var (
+	formatoNIT          = regexp.MustCompile(`^\d{6,12}(-\d)?$`)
+	formatoNumeroCuenta = regexp.MustCompile(`^\d{6,20}$`)
+)
+
+type Organizador struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Nombre     string             `json:"nombre" bson:"nombre"`
+	NIT        string             `json:"nit" bson:"nit"`
+	Escenarios []Escenario        `json:"escenarios" bson:"escenarios"`
+	// Pago son los datos de la cuenta donde se le gira el recaudo. El número
+	// de cuenta y el documento del titular se guardan cifrados y la API solo
+	// los devuelve enmascarados.
+	Pago     *DatosPago `json:"pago,omitempty" bson:"pago,omitempty"`
+	CreadoEn time.Time  `json:"creado_en" bson:"creado_en"`
+	// ClaveDatos es la clave con la que se cifran los datos de pago.
+	ClaveDatos *cifrado.ClaveCifrada `json:"-" bson:"clave_datos,omitempty"`
+}
+
+// Escenario es un lugar donde el organizador hace eventos, con sus zonas.
+// El ID lo asigna el servidor y se conserva al editar la lista.
+type Escenario struct {
+	ID        primitive.ObjectID `json:"id" bson:"id"`
+	Nombre    string             `json:"nombre" bson:"nombre"`
+	Ciudad    string             `json:"ciudad" bson:"ciudad"`
+	Direccion string             `json:"direccion" bson:"direccion"`
+	Zonas     []ZonaEscenario    `json:"zonas" bson:"zonas"`
+}
+
+type ZonaEscenario struct {
+	Nombre    string `json:"nombre" bson:"nombre"`
+	Capacidad int    `json:"capacidad" bson:"capacidad"`
+}
+
+type DatosPago struct {
+	Banco            string `json:"banco" bson:"banco"`
+	TipoCuenta       string `json:"tipo_cuenta" bson:"tipo_cuenta"`
+	NumeroCuenta     string `json:"numero_cuenta" bson:"numero_cuenta"`
+	Titular          string `json:"titular" bson:"titular"`
+	DocumentoTitular string `json:"documento_titular" bson:"documento_titular"`
+}
+
+// escenario devuelve el escenario con ese ID, si es del organizador.
+func (o Organizador) escenario(id primitive.ObjectID) (Escenario, bool) {
+	for _, e := range o.Escenarios {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Escenario{}, false
+}
+
+// descifrarOrganizador descifra en su lugar los datos de pago.
+func descifrarOrganizador(o *Organizador) error {
+	if o.Pago == nil {
+		return nil
+	}
+	return descifrarCampos(o.ClaveDatos, &o.Pago.NumeroCuenta, &o.Pago.DocumentoTitular)
+}
+
+// enmascararPago deja ver solo los últimos cuatro dígitos de la cuenta y del
+// documento, suficientes para que el organizador reconozca su cuenta.
+func enmascararPago(o *Organizador) {
+	if o.Pago == nil {
+		return
+	}
+	enmascarar := func(valor string) string {
+		if len(valor) <= 4 {
+			return "****"
+		}
+		return "****" + valor[len(valor)-4:]
+	}
+	o.Pago.NumeroCuenta = enmascarar(o.Pago.NumeroCuenta)
+	o.Pago.DocumentoTitular = enmascarar(o.Pago.DocumentoTitular)
+}
+
+// cifrarPago arma los campos de un $set con los datos de pago cifrados.
+func cifrarPago(pago DatosPago, clave *cifrado.ClaveCifrada) (bson.M, error) {
+	cifrados, err := cifrarCampos(map[string]string{
+		"numero_cuenta":     pago.NumeroCuenta,
+		"documento_titular": pago.DocumentoTitular,
+	}, clave)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{
+		"clave_datos": cifrados["clave_datos"],
+		"pago": bson.M{
+			"banco":             pago.Banco,
+			"tipo_cuenta":       pago.TipoCuenta,
+			"numero_cuenta":     cifrados["numero_cuenta"],
+			"titular":           pago.Titular,
+			"documento_titular": cifrados["documento_titular"],
+		},
+	}, nil
+}
+
+// validarOrganizador devuelve, por campo, la clave del error de validación.
+// Completa los IDs de los escenarios nuevos.
+func validarOrganizador(o *Organizador) map[string]string {
+	errores := make(map[string]string)
+	if o.Nombre == "" {
+		errores["nombre"] = "organizador.nombre"
+	}
+	if !formatoNIT.MatchString(o.NIT) {
+		errores["nit"] = "organizador.nit"
+	}
+	for i := range o.Escenarios {
+		e := &o.Escenarios[i]
+		if e.ID.IsZero() {
+			e.ID = primitive.NewObjectID()
+		}
+		if e.Nombre == "" || e.Ciudad == "" || len(e.Zonas) == 0 {
+			errores["escenarios"] = "escenarios.invalidos"
+		}
+		for _, z := range e.Zonas {
+			if z.Nombre == "" || z.Capacidad <= 0 {
+				errores["escenarios"] = "escenarios.invalidos"
+			}
+		}
+	}
+	if p := o.Pago; p != nil {
+		if p.Banco == "" || p.Titular == "" || p.DocumentoTitular == "" {
+			errores["pago"] = "pago.incompleto"
+		} else if p.TipoCuenta != cuentaAhorros && p.TipoCuenta != cuentaCorriente {
+			errores["pago"] = "pago.tipo_cuenta"
+		} else if !formatoNumeroCuenta.MatchString(p.NumeroCuenta) {
+			errores["pago"] = "pago.numero_cuenta"
+		}
+	}
+	return errores
+}
+
+// buscarOrganizador lee el organizador de la ruta. Si no existe responde 404
+// y devuelve false.
+func buscarOrganizador(c *gin.Context) (Organizador, bool) {
+	var organizador Organizador
+	id, err := primitive.ObjectIDFromHex(c.Param("organizador"))
+	if err != nil {
+		responderError(c, http.StatusNotFound, codigoOrganizadorNoEncontrado)
+		return organizador, false
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	err = organizadoresCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&organizador)
+	if err == nil {
+		err = descifrarOrganizador(&organizador)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			responderError(c, http.StatusNotFound, codigoOrganizadorNoEncontrado)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al buscar el organizador", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return organizador, false
+	}
+	return organizador, true
+}
+
+// crearOrganizador da de alta un organizador. Sus usuarios se le asignan
+// después con asignarRoles.
+func crearOrganizador(c *gin.Context) {
+	var organizador Organizador
+	if err := c.ShouldBindJSON(&organizador); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	if errores := validarOrganizador(&organizador); len(errores) > 0 {
+		responderValidacion(c, errores)
+		return
+	}
+
+	organizador.ID = primitive.NewObjectID()
+	organizador.CreadoEn = time.Now()
+	if organizador.Escenarios == nil {
+		organizador.Escenarios = []Escenario{}
+	}
+	doc := bson.M{
+		"_id":        organizador.ID,
+		"nombre":     organizador.Nombre,
+		"nit":        organizador.NIT,
+		"escenarios": organizador.Escenarios,
+		"creado_en":  organizador.CreadoEn,
+	}
+	if organizador.Pago != nil {
+		pago, err := cifrarPago(*organizador.Pago, nil)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudieron cifrar los datos de pago", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+			return
+		}
+		for k, v := range pago {
+			doc[k] = v
+		}
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	if _, err := organizadoresCollection.InsertOne(ctx, doc); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo crear el organizador", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	auditar(c, accionOrganizadorCrear, objetivo(objetivoOrganizador, organizador.ID, ""), nil, organizador)
+
+	slog.InfoContext(c.Request.Context(), "Organizador creado", "organizador", organizador.ID.Hex(), "por", usuarioAutenticado(c).Cedula)
+	enmascararPago(&organizador)
+	responderOK(c, http.StatusCreated, exitoOrganizadorCreado, organizador)
+}
+
+// listarOrganizadores devuelve todos los organizadores, con los datos de
+// pago enmascarados.
+func listarOrganizadores(c *gin.Context) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	organizadores := []Organizador{}
+	cursor, err := organizadoresCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "nombre", Value: 1}}))
+	if err == nil {
+		err = cursor.All(ctx, &organizadores)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron leer los organizadores", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	for i := range organizadores {
+		if err := descifrarOrganizador(&organizadores[i]); err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudieron descifrar los datos de pago", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+			return
+		}
+		enmascararPago(&organizadores[i])
+	}
+	responderOK(c, http.StatusOK, "", organizadores)
+}
+
+func obtenerOrganizador(c *gin.Context) {
+	organizador, ok := buscarOrganizador(c)
+	if !ok {
+		return
+	}
+	enmascararPago(&organizador)
+	responderOK(c, http.StatusOK, "", organizador)
+}
+
+// actualizarOrganizador cambia los campos enviados. Escenarios reemplaza la
+// lista completa, pero no puede quitar un escenario que tenga eventos.
+func actualizarOrganizador(c *gin.Context) {
+	var cambios Organizador
+	if err := c.ShouldBindJSON(&cambios); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	organizador, ok := buscarOrganizador(c)
+	if !ok {
+		return
+	}
+	antes := organizador
+
+	if cambios.Nombre != "" {
+		organizador.Nombre = cambios.Nombre
+	}
+	if cambios.NIT != "" {
+		organizador.NIT = cambios.NIT
+	}
+	if cambios.Escenarios != nil {
+		organizador.Escenarios = cambios.Escenarios
+	}
+	if cambios.Pago != nil {
+		organizador.Pago = cambios.Pago
+	}
+	errores := validarOrganizador(&organizador)
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	if cambios.Escenarios != nil {
+		ids := make([]primitive.ObjectID, 0, len(organizador.Escenarios))
+		for _, e := range organizador.Escenarios {
+			ids = append(ids, e.ID)
+		}
+		enUso, err := eventosCollection.CountDocuments(ctx, bson.M{"organizador_id": organizador.ID, "escenario_id": bson.M{"$nin": ids}})
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudieron contar los eventos del organizador", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+			return
+		}
+		if enUso > 0 {
+			errores["escenarios"] = "escenarios.en_uso"
+		}
+	}
+	if len(errores) > 0 {
+		responderValidacion(c, errores)
+		return
+	}
+
+	campos := bson.M{
+		"nombre":     organizador.Nombre,
+		"nit":        organizador.NIT,
+		"escenarios": organizador.Escenarios,
+	}
+	if cambios.Pago != nil {
+		pago, err := cifrarPago(*organizador.Pago, organizador.ClaveDatos)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudieron cifrar los datos de pago", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+			return
+		}
+		for k, v := range pago {
+			campos[k] = v
+		}
+	}
+	if _, err := organizadoresCollection.UpdateOne(ctx, bson.M{"_id": organizador.ID}, bson.M{"$set": campos}); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo actualizar el organizador", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	auditar(c, accionOrganizadorActualizar, objetivo(objetivoOrganizador, organizador.ID, ""), antes, organizador)
+
+	slog.InfoContext(c.Request.Context(), "Organizador actualizado", "organizador", organizador.ID.Hex(), "por", usuarioAutenticado(c).Cedula, "pago", cambios.Pago != nil)
+	enmascararPago(&organizador)
+	responderOK(c, http.StatusOK, exitoOrganizadorActualizado, organizador)
+}
+
+// existeOrganizador indica si hay un organizador con ese ID.
+func existeOrganizador(c *gin.Context, id primitive.ObjectID) (bool, error) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	n, err := organizadoresCollection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// rolesDeOrganizador son los roles que trabajan para un organizador y por
+// eso necesitan uno asignado.
+var rolesDeOrganizador = []string{rolOrganizador, rolPorteria}
+
+func necesitaOrganizador(roles []string) bool {
+	return slices.ContainsFunc(roles, func(rol string) bool { return slices.Contains(rolesDeOrganizador, rol) })
+}
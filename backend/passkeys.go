@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/tunombre/qrtixpro-backend/config"
+)
+
+// maxPasskeys limita las llaves de acceso por usuario.
+const maxPasskeys = 10
+
+var (
+	relyingParty *webauthn.WebAuthn
+
+	// errContadorPasskey indica que el contador de firmas no avanzó: la
+	// llave pudo clonarse o la aserción se está reutilizando.
+	errContadorPasskey = errors.New("el contador de firmas de la llave no avanzó")
+)
+
+// credencialPasskey es una llave de acceso registrada, guardada en el arreglo
+// passkeys del usuario.
+type credencialPasskey struct {
+	ID             []byte   `bson:"id"`
+	ClavePublica   []byte   `bson:"clave_publica"`
+	TipoAtestacion string   `bson:"tipo_atestacion,omitempty"`
+	Transportes    []string `bson:"transportes,omitempty"`
+	AAGUID         []byte   `bson:"aaguid,omitempty"`
+	// Contador es el último contador de firmas aceptado. Las llaves que no
+	// llevan contador lo dejan siempre en cero.
+	Contador         uint32    `bson:"contador"`
+	RespaldoElegible bool      `bson:"respaldo_elegible"`
+	Respaldada       bool      `bson:"respaldada"`
+	Nombre           string    `bson:"nombre"`
+	CreadaEn         time.Time `bson:"creada_en"`
+	UltimoUso        time.Time `bson:"ultimo_uso,omitempty"`
+}
+
+// ceremoniaWebAuthn guarda entre el desafío y la respuesta los datos de
+// sesión de una ceremonia. Como los tokens, se guarda solo el hash.
+type ceremoniaWebAuthn struct {
+	Hash string `bson:"_id"`
+	// UsuarioID es el dueño de una ceremonia de registro; va vacío en las de
+	// inicio de sesión, en las que el usuario lo dice la llave.
+	UsuarioID primitive.ObjectID   `bson:"usuario_id,omitempty"`
+	Sesion    webauthn.SessionData `bson:"sesion"`
+	CreadoEn  time.Time            `bson:"creado_en"`
+	ExpiraEn  time.Time            `bson:"expira_en"`
+}
+
+// usuarioWebAuthn adapta Usuario a webauthn.User. El identificador de la
+// llave es el _id del usuario, que no contiene datos personales.
+type usuarioWebAuthn struct {
+	Usuario
+}
+
+func (u usuarioWebAuthn) WebAuthnID() []byte {
+	return u.ID[:]
+}
+
+func (u usuarioWebAuthn) WebAuthnName() string {
+	return u.Cedula
+}
+
+func (u usuarioWebAuthn) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.Nombres + " " + u.Apellidos)
+}
+
+func (u usuarioWebAuthn) WebAuthnCredentials() []webauthn.Credential {
+	credenciales := make([]webauthn.Credential, len(u.Passkeys))
+	for i, p := range u.Passkeys {
+		credenciales[i] = p.credencial()
+	}
+	return credenciales
+}
+
+// credencial convierte la llave guardada al tipo de la biblioteca.
+func (p credencialPasskey) credencial() webauthn.Credential {
+	transportes := make([]protocol.AuthenticatorTransport, len(p.Transportes))
+	for i, t := range p.Transportes {
+		transportes[i] = protocol.AuthenticatorTransport(t)
+	}
+	return webauthn.Credential{
+		ID:              p.ID,
+		PublicKey:       p.ClavePublica,
+		AttestationType: p.TipoAtestacion,
+		Transport:       transportes,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: p.RespaldoElegible,
+			BackupState:    p.Respaldada,
+		},
+		Authenticator: webauthn.Authenticator{AAGUID: p.AAGUID, SignCount: p.Contador},
+	}
+}
+
+// nuevaCredencialPasskey convierte la credencial recién creada al formato
+// que se guarda.
+func nuevaCredencialPasskey(c *webauthn.Credential, nombre string, ahora time.Time) credencialPasskey {
+	transportes := make([]string, len(c.Transport))
+	for i, t := range c.Transport {
+		transportes[i] = string(t)
+	}
+	return credencialPasskey{
+		ID:               c.ID,
+		ClavePublica:     c.PublicKey,
+		TipoAtestacion:   c.AttestationType,
+		Transportes:      transportes,
+		AAGUID:           c.Authenticator.AAGUID,
+		Contador:         c.Authenticator.SignCount,
+		RespaldoElegible: c.Flags.BackupEligible,
+		Respaldada:       c.Flags.BackupState,
+		Nombre:           nombre,
+		CreadaEn:         ahora,
+	}
+}
+
+// nuevoRelyingParty crea el verificador de ceremonias. Se exige verificación
+// del usuario (PIN o biometría) porque la llave reemplaza contraseña y rostro.
+func nuevoRelyingParty(c config.WebAuthn) (*webauthn.WebAuthn, error) {
+	vigencia := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    c.VigenciaCeremonia.Duration(),
+		TimeoutUVD: c.VigenciaCeremonia.Duration(),
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          c.RPID,
+		RPDisplayName: c.Nombre,
+		RPOrigins:     c.Origenes,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: vigencia, Registration: vigencia},
+	})
+}
+
+// iniciarWebAuthn crea el verificador con la configuración cargada.
+func iniciarWebAuthn() error {
+	rp, err := nuevoRelyingParty(cfg.WebAuthn)
+	if err != nil {
+		return err
+	}
+	relyingParty = rp
+	return nil
+}
+
+// completarRegistroPasskey valida la respuesta del navegador a la ceremonia
+// de registro y devuelve la credencial creada.
+func completarRegistroPasskey(rp *webauthn.WebAuthn, usuario Usuario, sesion webauthn.SessionData, respuesta []byte) (*webauthn.Credential, error) {
+	datos, err := protocol.ParseCredentialCreationResponseBytes(respuesta)
+	if err != nil {
+		return nil, err
+	}
+	return rp.CreateCredential(usuarioWebAuthn{usuario}, sesion, datos)
+}
+
+// completarInicioPasskey valida una aserción de una llave descubrible.
+// buscar obtiene el usuario por el _id que trae la llave. Devuelve el
+// usuario y la credencial con el contador nuevo, o errContadorPasskey si el
+// contador no avanzó.
+func completarInicioPasskey(rp *webauthn.WebAuthn, sesion webauthn.SessionData, respuesta []byte, buscar func(primitive.ObjectID) (Usuario, error)) (Usuario, *webauthn.Credential, error) {
+	datos, err := protocol.ParseCredentialRequestResponseBytes(respuesta)
+	if err != nil {
+		return Usuario{}, nil, err
+	}
+
+	var usuario Usuario
+	_, credencial, err := rp.ValidatePasskeyLogin(func(_, identificador []byte) (webauthn.User, error) {
+		if len(identificador) != len(primitive.ObjectID{}) {
+			return nil, mongo.ErrNoDocuments
+		}
+		var id primitive.ObjectID
+		copy(id[:], identificador)
+		u, err := buscar(id)
+		if err != nil {
+			return nil, err
+		}
+		usuario = u
+		return usuarioWebAuthn{u}, nil
+	}, sesion, datos)
+	if err != nil {
+		return usuario, nil, err
+	}
+	if credencial.Authenticator.CloneWarning {
+		return usuario, nil, errContadorPasskey
+	}
+	return usuario, credencial, nil
+}
+
+// guardarCeremonia guarda los datos de sesión y devuelve el token con el que
+// el cliente los referencia al responder.
+func guardarCeremonia(ctx context.Context, usuarioID primitive.ObjectID, sesion *webauthn.SessionData) (string, error) {
+	token, hash, err := generarSecreto()
+	if err != nil {
+		return "", err
+	}
+	_, err = ceremoniasCollection.InsertOne(ctx, ceremoniaWebAuthn{
+		Hash:      hash,
+		UsuarioID: usuarioID,
+		Sesion:    *sesion,
+		CreadoEn:  time.Now(),
+		ExpiraEn:  sesion.Expires,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// canjearCeremonia borra y devuelve la ceremonia vigente del token. Cada
+// desafío sirve una sola vez.
+func canjearCeremonia(ctx context.Context, token string) (ceremoniaWebAuthn, error) {
+	var ceremonia ceremoniaWebAuthn
+	err := ceremoniasCollection.FindOneAndDelete(ctx, bson.M{
+		"_id":       hashSecreto(token),
+		"expira_en": bson.M{"$gt": time.Now()},
+	}).Decode(&ceremonia)
+	if err == mongo.ErrNoDocuments {
+		return ceremonia, errTokenInvalido
+	}
+	return ceremonia, err
+}
+
+// datosCeremoniaPasskey es la respuesta al iniciar una ceremonia. Opciones
+// va tal cual a navigator.credentials.create o get.
+type datosCeremoniaPasskey struct {
+	Ceremonia string `json:"ceremonia"`
+	Opciones  any    `json:"opciones"`
+}
+
+// solicitudRegistroPasskey es el cuerpo para guardar una llave nueva.
+type solicitudRegistroPasskey struct {
+	Ceremonia string `json:"ceremonia"`
+	// Nombre ayuda al titular a reconocer la llave, por ejemplo "Teléfono".
+	Nombre string `json:"nombre,omitempty"`
+	// Credencial es el PublicKeyCredential del navegador serializado en JSON.
+	Credencial map[string]any `json:"credencial"`
+}
+
+// solicitudInicioPasskey es el cuerpo de POST /api/v1/sesiones/passkey.
+type solicitudInicioPasskey struct {
+	Ceremonia  string         `json:"ceremonia"`
+	Credencial map[string]any `json:"credencial"`
+}
+
+// datosPasskey es una llave del titular como se lista.
+type datosPasskey struct {
+	ID        string     `json:"id"`
+	Nombre    string     `json:"nombre"`
+	CreadaEn  time.Time  `json:"creada_en"`
+	UltimoUso *time.Time `json:"ultimo_uso,omitempty"`
+}
+
+// iniciarRegistroPasskey emite el desafío para crear una llave del titular.
+// Como una llave entra sin contraseña ni segundo factor, solo se registra
+// desde una sesión que sí pasó el segundo factor.
+func iniciarRegistroPasskey(c *gin.Context) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, c.Param("cedula"))
+	if !ok || !exigirSegundoFactor(c, usuario) {
+		return
+	}
+	if len(usuario.Passkeys) >= maxPasskeys {
+		responderError(c, http.StatusConflict, codigoLimitePasskeys)
+		return
+	}
+
+	// Excluir las llaves ya registradas evita duplicarlas en el mismo autenticador
+	existentes := webauthn.Credentials(usuarioWebAuthn{usuario}.WebAuthnCredentials())
+	opciones, sesion, err := relyingParty.BeginRegistration(usuarioWebAuthn{usuario},
+		webauthn.WithExclusions(existentes.CredentialDescriptors()))
+	if err == nil {
+		var ceremonia string
+		ceremonia, err = guardarCeremonia(ctx, usuario.ID, sesion)
+		if err == nil {
+			responderOK(c, http.StatusOK, "", datosCeremoniaPasskey{Ceremonia: ceremonia, Opciones: opciones})
+			return
+		}
+	}
+	slog.ErrorContext(c.Request.Context(), "No se pudo iniciar el registro de la llave de acceso", "error", err)
+	responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+}
+
+// registrarPasskey valida la respuesta del autenticador y guarda la llave.
+func registrarPasskey(c *gin.Context) {
+	var datos solicitudRegistroPasskey
+	if err := c.ShouldBindJSON(&datos); err != nil || datos.Ceremonia == "" || datos.Credencial == nil {
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, c.Param("cedula"))
+	if !ok || !exigirSegundoFactor(c, usuario) {
+		return
+	}
+	ceremonia, err := canjearCeremonia(ctx, datos.Ceremonia)
+	if err == nil && ceremonia.UsuarioID != usuario.ID {
+		err = errTokenInvalido
+	}
+	if err != nil {
+		if errors.Is(err, errTokenInvalido) {
+			responderError(c, http.StatusBadRequest, codigoRetoInvalido)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al canjear la ceremonia de registro", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+
+	respuesta, _ := json.Marshal(datos.Credencial)
+	credencial, err := completarRegistroPasskey(relyingParty, usuario, ceremonia.Sesion, respuesta)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Registro de llave de acceso rechazado", "cedula", usuario.Cedula, "error", err)
+		responderError(c, http.StatusBadRequest, codigoPasskeyInvalida)
+		return
+	}
+
+	nombre := strings.TrimSpace(datos.Nombre)
+	if nombre == "" {
+		nombre = "Llave de acceso"
+	}
+	// El filtro por tamaño evita pasar del límite con registros simultáneos
+	nueva := nuevaCredencialPasskey(credencial, nombre, time.Now())
+	filtro := bson.M{
+		"_id":         usuario.ID,
+		"passkeys.id": bson.M{"$ne": nueva.ID},
+		"passkeys." + strconv.Itoa(maxPasskeys-1): bson.M{"$exists": false},
+	}
+	cambios := bson.M{"$push": bson.M{"passkeys": nueva}}
+	resultado, err := collection.UpdateOne(ctx, filtro, cambios)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo guardar la llave de acceso", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	if resultado.ModifiedCount == 0 {
+		responderError(c, http.StatusConflict, codigoLimitePasskeys)
+		return
+	}
+	replicarUsuario(c, usuario.Cedula, time.Now(), cambios)
+
+	registrada := datosDePasskey(nueva)
+	auditar(c, accionPasskeyRegistrar, objetivo(objetivoUsuario, usuario.ID, usuario.Cedula),
+		nil, bson.M{"passkey": bson.M{"id": registrada.ID, "nombre": registrada.Nombre}})
+
+	slog.InfoContext(c.Request.Context(), "Llave de acceso registrada", "cedula", usuario.Cedula)
+	responderOK(c, http.StatusCreated, exitoPasskeyRegistrada, registrada)
+}
+
+// listarPasskeys devuelve las llaves del titular, sin las claves públicas.
+func listarPasskeys(c *gin.Context) {
+	usuario, ok := autorizarTitular(c, c.Param("cedula"))
+	if !ok {
+		return
+	}
+	lista := make([]datosPasskey, len(usuario.Passkeys))
+	for i, p := range usuario.Passkeys {
+		lista[i] = datosDePasskey(p)
+	}
+	responderOK(c, http.StatusOK, "", lista)
+}
+
+// eliminarPasskey borra una llave del titular.
+func eliminarPasskey(c *gin.Context) {
+	id, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, c.Param("cedula"))
+	if !ok {
+		return
+	}
+	cambios := bson.M{"$pull": bson.M{"passkeys": bson.M{"id": id}}}
+	resultado, err := collection.UpdateOne(ctx, bson.M{"_id": usuario.ID}, cambios)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo eliminar la llave de acceso", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	if resultado.ModifiedCount == 0 {
+		responderError(c, http.StatusNotFound, codigoPasskeyNoEncontrada)
+		return
+	}
+	replicarUsuario(c, usuario.Cedula, time.Now(), cambios)
+
+	auditar(c, accionPasskeyEliminar, objetivo(objetivoUsuario, usuario.ID, usuario.Cedula),
+		bson.M{"passkey": bson.M{"id": c.Param("id")}}, nil)
+
+	slog.InfoContext(c.Request.Context(), "Llave de acceso eliminada", "cedula", usuario.Cedula)
+	responderOK(c, http.StatusOK, exitoPasskeyEliminada, nil)
+}
+
+// iniciarSesionPasskey emite el desafío para entrar con una llave. No pide
+// cédula: el navegador ofrece las llaves que tenga para el sitio.
+func iniciarSesionPasskey(c *gin.Context) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	opciones, sesion, err := relyingParty.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err == nil {
+		var ceremonia string
+		ceremonia, err = guardarCeremonia(ctx, primitive.NilObjectID, sesion)
+		if err == nil {
+			responderOK(c, http.StatusOK, "", datosCeremoniaPasskey{Ceremonia: ceremonia, Opciones: opciones})
+			return
+		}
+	}
+	slog.ErrorContext(c.Request.Context(), "No se pudo iniciar el inicio de sesión con llave de acceso", "error", err)
+	responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+}
+
+// completarSesionPasskey valida la aserción y, si el contador de firmas
+// avanzó, lo guarda e inicia la sesión.
+func completarSesionPasskey(c *gin.Context) {
+	var datos solicitudInicioPasskey
+	if err := c.ShouldBindJSON(&datos); err != nil || datos.Ceremonia == "" || datos.Credencial == nil {
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	ceremonia, err := canjearCeremonia(ctx, datos.Ceremonia)
+	if err == nil && !ceremonia.UsuarioID.IsZero() {
+		err = errTokenInvalido
+	}
+	if err != nil {
+		if errors.Is(err, errTokenInvalido) {
+			responderError(c, http.StatusUnauthorized, codigoRetoInvalido)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al canjear la ceremonia de inicio de sesión", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+
+	var errBusqueda error
+	respuesta, _ := json.Marshal(datos.Credencial)
+	usuario, credencial, err := completarInicioPasskey(relyingParty, ceremonia.Sesion, respuesta, func(id primitive.ObjectID) (Usuario, error) {
+		var u Usuario
+		errBusqueda = collection.FindOne(ctx, bson.M{"_id": id}).Decode(&u)
+		if errBusqueda == nil {
+			errBusqueda = descifrarUsuario(&u)
+		}
+		return u, errBusqueda
+	})
+	if errBusqueda != nil && errBusqueda != mongo.ErrNoDocuments {
+		slog.ErrorContext(c.Request.Context(), "Error al buscar el usuario de la llave de acceso", "error", errBusqueda)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	if usuario.Cedula != "" && cuentaBloqueada(ctx, c, usuario.Cedula) {
+		return
+	}
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Llave de acceso rechazada", "error", err)
+		if usuario.Cedula != "" {
+			registrarFallo(ctx, c, usuario.Cedula)
+		}
+		if !usuario.ID.IsZero() {
+			registrarInicioFallido(c, ctx, usuario, metodoPasskey, motivoPasskey)
+		}
+		responderError(c, http.StatusUnauthorized, codigoPasskeyInvalida)
+		return
+	}
+
+	// La actualización es condicional para que dos aserciones con el mismo
+	// contador no pasen a la vez. Las llaves sin contador siempre envían cero.
+	contador := credencial.Authenticator.SignCount
+	elemento := bson.M{"id": credencial.ID}
+	if contador > 0 {
+		elemento["contador"] = bson.M{"$lt": contador}
+	}
+	ahora := time.Now()
+	cambios := bson.M{"$set": bson.M{
+		"passkeys.$.contador":   contador,
+		"passkeys.$.respaldada": credencial.Flags.BackupState,
+		"passkeys.$.ultimo_uso": ahora,
+	}}
+	resultado, err := collection.UpdateOne(ctx, bson.M{"_id": usuario.ID, "passkeys": bson.M{"$elemMatch": elemento}}, cambios)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo actualizar el contador de la llave de acceso", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	if resultado.MatchedCount == 0 {
+		slog.WarnContext(c.Request.Context(), "Llave de acceso rechazada", "cedula", usuario.Cedula, "error", errContadorPasskey)
+		registrarFallo(ctx, c, usuario.Cedula)
+		registrarInicioFallido(c, ctx, usuario, metodoPasskey, motivoPasskey)
+		responderError(c, http.StatusUnauthorized, codigoPasskeyInvalida)
+		return
+	}
+	replicarPasskeyUsada(c, usuario.Cedula, credencial.ID, ahora, cambios)
+
+	reiniciarFallos(ctx, c, usuario.Cedula)
+	sesion, ok := abrirSesion(c, ctx, usuario, metodoPasskey)
+	if !ok {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Inicio de sesión con llave de acceso", "cedula", usuario.Cedula)
+	responderOK(c, http.StatusOK, exitoInicioSesion, sesion)
+}
+
+// replicarPasskeyUsada copia a MongoDB Local el uso de la llave. El operador
+// posicional necesita la llave en el filtro, así que no sirve replicarUsuario.
+func replicarPasskeyUsada(c *gin.Context, cedula string, id []byte, escritoEnAtlas time.Time, cambios bson.M) {
+	if collectionLocal == nil || clientLocal == nil {
+		return
+	}
+	ctxLocal, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	filtro := filtroCedula(cedula)
+	filtro["passkeys.id"] = id
+	_, err := collectionLocal.UpdateOne(ctxLocal, filtro, cambios)
+	observarReplica("usuarios", escritoEnAtlas, err)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo actualizar la llave en MongoDB Local", "error", err)
+	}
+}
+
+func datosDePasskey(p credencialPasskey) datosPasskey {
+	d := datosPasskey{
+		ID:       base64.RawURLEncoding.EncodeToString(p.ID),
+		Nombre:   p.Nombre,
+		CreadaEn: p.CreadaEn,
+	}
+	if !p.UltimoUso.IsZero() {
+		d.UltimoUso = &p.UltimoUso
+	}
+	return d
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/tunombre/qrtixpro-backend/config"
+)
+
+const origenPrueba = "http://localhost:3000"
+
+// autenticadorSoftware hace de llave de acceso con una clave P-256 en
+// memoria, sin hardware ni navegador.
+type autenticadorSoftware struct {
+	clave         *ecdsa.PrivateKey
+	id            []byte
+	identificador []byte
+	contador      uint32
+	// sinContador imita a las llaves sincronizadas, que siempre firman con
+	// contador cero.
+	sinContador bool
+}
+
+func nuevoAutenticador(t *testing.T) *autenticadorSoftware {
+	t.Helper()
+	clave, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &autenticadorSoftware{clave: clave, id: id}
+}
+
+// Banderas de authenticatorData: presencia, verificación y datos de la
+// credencial adjuntos.
+const (
+	banderaUP = 0x01
+	banderaUV = 0x04
+	banderaAT = 0x40
+)
+
+func (a *autenticadorSoftware) siguienteContador() uint32 {
+	if !a.sinContador {
+		a.contador++
+	}
+	return a.contador
+}
+
+func datosAutenticador(rpID string, banderas byte, contador uint32) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	datos := append(hash[:], banderas)
+	return binary.BigEndian.AppendUint32(datos, contador)
+}
+
+func datosCliente(t *testing.T, tipo string, desafio protocol.URLEncodedBase64, origen string) []byte {
+	t.Helper()
+	datos, err := json.Marshal(map[string]any{
+		"type":      tipo,
+		"challenge": desafio.String(),
+		"origin":    origen,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return datos
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// crear responde a navigator.credentials.create con atestación "none".
+func (a *autenticadorSoftware) crear(t *testing.T, opciones *protocol.CredentialCreation, identificador []byte) []byte {
+	t.Helper()
+	a.identificador = identificador
+
+	x := a.clave.X.FillBytes(make([]byte, 32))
+	y := a.clave.Y.FillBytes(make([]byte, 32))
+	clavePublica, err := cbor.Marshal(map[int]any{1: 2, 3: -7, -1: 1, -2: x, -3: y})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	datos := datosAutenticador(opciones.Response.RelyingParty.ID, banderaUP|banderaUV|banderaAT, a.siguienteContador())
+	datos = append(datos, make([]byte, 16)...) // AAGUID
+	datos = binary.BigEndian.AppendUint16(datos, uint16(len(a.id)))
+	datos = append(datos, a.id...)
+	datos = append(datos, clavePublica...)
+
+	atestacion, err := cbor.Marshal(map[string]any{"fmt": "none", "attStmt": map[string]any{}, "authData": datos})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	respuesta, err := json.Marshal(map[string]any{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(datosCliente(t, "webauthn.create", opciones.Response.Challenge, origenPrueba)),
+			"attestationObject": b64(atestacion),
+			"transports":        []string{"internal"},
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]any{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return respuesta
+}
+
+// firmar responde a navigator.credentials.get desde origen.
+func (a *autenticadorSoftware) firmar(t *testing.T, opciones *protocol.CredentialAssertion, origen string) []byte {
+	t.Helper()
+	datos := datosAutenticador(opciones.Response.RelyingPartyID, banderaUP|banderaUV, a.siguienteContador())
+	cliente := datosCliente(t, "webauthn.get", opciones.Response.Challenge, origen)
+
+	hashCliente := sha256.Sum256(cliente)
+	resumen := sha256.Sum256(append(append([]byte{}, datos...), hashCliente[:]...))
+	firma, err := ecdsa.SignASN1(rand.Reader, a.clave, resumen[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	respuesta, err := json.Marshal(map[string]any{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64(cliente),
+			"authenticatorData": b64(datos),
+			"signature":         b64(firma),
+			"userHandle":        b64(a.identificador),
+		},
+		"clientExtensionResults": map[string]any{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return respuesta
+}
+
+func relyingPartyPrueba(t *testing.T) *webauthn.WebAuthn {
+	t.Helper()
+	rp, err := nuevoRelyingParty(config.WebAuthn{
+		RPID:              "localhost",
+		Nombre:            "QR-TixPro",
+		Origenes:          []string{origenPrueba},
+		VigenciaCeremonia: config.Duracion(5 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+// registrarPrueba completa el registro y deja la llave en el usuario tal
+// como quedaría después de guardarla y leerla de MongoDB.
+func registrarPrueba(t *testing.T, rp *webauthn.WebAuthn, usuario *Usuario, a *autenticadorSoftware) {
+	t.Helper()
+	opciones, sesion, err := rp.BeginRegistration(usuarioWebAuthn{*usuario})
+	if err != nil {
+		t.Fatal(err)
+	}
+	credencial, err := completarRegistroPasskey(rp, *usuario, *sesion, a.crear(t, opciones, usuario.ID[:]))
+	if err != nil {
+		t.Fatalf("registro rechazado: %v", err)
+	}
+
+	var guardada credencialPasskey
+	crudo, err := bson.Marshal(nuevaCredencialPasskey(credencial, "Prueba", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bson.Unmarshal(crudo, &guardada); err != nil {
+		t.Fatal(err)
+	}
+	usuario.Passkeys = append(usuario.Passkeys, guardada)
+}
+
+// iniciarPrueba hace una ceremonia de inicio de sesión completa y, si pasa,
+// guarda el contador nuevo como lo haría completarSesionPasskey.
+func iniciarPrueba(t *testing.T, rp *webauthn.WebAuthn, usuario *Usuario, a *autenticadorSoftware, origen string) (Usuario, error) {
+	t.Helper()
+	opciones, sesion, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encontrado, credencial, err := completarInicioPasskey(rp, *sesion, a.firmar(t, opciones, origen), func(id primitive.ObjectID) (Usuario, error) {
+		if id != usuario.ID {
+			return Usuario{}, mongo.ErrNoDocuments
+		}
+		return *usuario, nil
+	})
+	if err == nil {
+		usuario.Passkeys[0].Contador = credencial.Authenticator.SignCount
+	}
+	return encontrado, err
+}
+
+func usuarioPrueba() Usuario {
+	return Usuario{ID: primitive.NewObjectID(), Cedula: "1000000001", Nombres: "Ana", Apellidos: "Pérez"}
+}
+
+func TestPasskeyRegistroEInicioDeSesion(t *testing.T) {
+	rp := relyingPartyPrueba(t)
+	usuario := usuarioPrueba()
+	a := nuevoAutenticador(t)
+	registrarPrueba(t, rp, &usuario, a)
+
+	for i := range 3 {
+		encontrado, err := iniciarPrueba(t, rp, &usuario, a, origenPrueba)
+		if err != nil {
+			t.Fatalf("inicio %d rechazado: %v", i+1, err)
+		}
+		if encontrado.ID != usuario.ID {
+			t.Fatalf("inicio %d: usuario %s, se esperaba %s", i+1, encontrado.ID.Hex(), usuario.ID.Hex())
+		}
+	}
+	if usuario.Passkeys[0].Contador != a.contador {
+		t.Errorf("contador guardado %d, se esperaba %d", usuario.Passkeys[0].Contador, a.contador)
+	}
+}
+
+func TestPasskeyRechazaContadorQueNoAvanza(t *testing.T) {
+	rp := relyingPartyPrueba(t)
+	usuario := usuarioPrueba()
+	a := nuevoAutenticador(t)
+	registrarPrueba(t, rp, &usuario, a)
+	if _, err := iniciarPrueba(t, rp, &usuario, a, origenPrueba); err != nil {
+		t.Fatal(err)
+	}
+
+	// Un clon de la llave firma con el mismo contador que el original
+	a.contador--
+	if _, err := iniciarPrueba(t, rp, &usuario, a, origenPrueba); !errors.Is(err, errContadorPasskey) {
+		t.Fatalf("contador repetido: err = %v, se esperaba errContadorPasskey", err)
+	}
+
+	a.contador = 0
+	if _, err := iniciarPrueba(t, rp, &usuario, a, origenPrueba); !errors.Is(err, errContadorPasskey) {
+		t.Fatalf("contador menor: err = %v, se esperaba errContadorPasskey", err)
+	}
+}
+
+func TestPasskeySinContadorSiempreEnCero(t *testing.T) {
+	rp := relyingPartyPrueba(t)
+	usuario := usuarioPrueba()
+	a := nuevoAutenticador(t)
+	a.sinContador = true
+	registrarPrueba(t, rp, &usuario, a)
+
+	for i := range 2 {
+		if _, err := iniciarPrueba(t, rp, &usuario, a, origenPrueba); err != nil {
+			t.Fatalf("inicio %d rechazado: %v", i+1, err)
+		}
+	}
+}
+
+func TestPasskeyRechazaAsercionesInvalidas(t *testing.T) {
+	rp := relyingPartyPrueba(t)
+	usuario := usuarioPrueba()
+	a := nuevoAutenticador(t)
+	registrarPrueba(t, rp, &usuario, a)
+
+	if _, err := iniciarPrueba(t, rp, &usuario, a, "https://sitio-ajeno.example"); err == nil {
+		t.Error("se aceptó una aserción de otro origen")
+	}
+
+	// Misma credencial, otra clave privada: la firma no corresponde
+	impostor := nuevoAutenticador(t)
+	impostor.id, impostor.identificador, impostor.contador = a.id, a.identificador, a.contador
+	if _, err := iniciarPrueba(t, rp, &usuario, impostor, origenPrueba); err == nil {
+		t.Error("se aceptó una firma de otra clave")
+	}
+
+	// Llave válida pero de un usuario que no existe
+	otro := usuarioPrueba()
+	if _, err := iniciarPrueba(t, rp, &otro, a, origenPrueba); err == nil {
+		t.Error("se aceptó una llave de un usuario desconocido")
+	}
+}
+
+func TestCeremoniaWebAuthnSobreviveBSON(t *testing.T) {
+	rp := relyingPartyPrueba(t)
+	usuario := usuarioPrueba()
+	_, sesion, err := rp.BeginRegistration(usuarioWebAuthn{usuario})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crudo, err := bson.Marshal(ceremoniaWebAuthn{Hash: "h", UsuarioID: usuario.ID, Sesion: *sesion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var leida ceremoniaWebAuthn
+	if err := bson.Unmarshal(crudo, &leida); err != nil {
+		t.Fatal(err)
+	}
+
+	// Una sesión leída de MongoDB debe seguir sirviendo para completar el registro
+	a := nuevoAutenticador(t)
+	opciones := &protocol.CredentialCreation{}
+	opciones.Response.RelyingParty.ID = "localhost"
+	opciones.Response.Challenge = protocol.URLEncodedBase64(mustDecodificar(t, leida.Sesion.Challenge))
+	if _, err := completarRegistroPasskey(rp, usuario, leida.Sesion, a.crear(t, opciones, usuario.ID[:])); err != nil {
+		t.Fatalf("registro con la sesión leída: %v", err)
+	}
+}
+
+func mustDecodificar(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -3,35 +3,57 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/tunombre/qrtixpro-backend/cifrado"
+	"github.com/tunombre/qrtixpro-backend/config"
+	"github.com/tunombre/qrtixpro-backend/fotos"
 )
 
 var (
-	client                *mongo.Client
-	clientLocal           *mongo.Client
-	collection            *mongo.Collection
-	collectionLocal       *mongo.Collection
-	logsCollection        *mongo.Collection
-	logsCollectionLocal   *mongo.Collection
-	ventasCollection      *mongo.Collection
-	ventasCollectionLocal *mongo.Collection
+	cfg                         *config.Config
+	client                      *mongo.Client
+	clientLocal                 *mongo.Client
+	collection                  *mongo.Collection
+	collectionLocal             *mongo.Collection
+	logsCollection              *mongo.Collection
+	logsCollectionLocal         *mongo.Collection
+	ventasCollection            *mongo.Collection
+	ventasCollectionLocal       *mongo.Collection
+	retosCollection             *mongo.Collection
+	restablecimientosCollection *mongo.Collection
+	confirmacionesCollection    *mongo.Collection
+	ceremoniasCollection        *mongo.Collection
+	organizadoresCollection     *mongo.Collection
+	eventosCollection           *mongo.Collection
+	auditoriaCollection         *mongo.Collection
+	sesionesCollection          *mongo.Collection
+	fotosAtlas                  *fotos.Almacen
+	fotosLocal                  *fotos.Almacen
 )
 
 type Usuario struct {
@@ -41,7 +63,69 @@ type Usuario struct {
 	Correo     string `json:"correo"`
 	Telefono   string `json:"telefono"`
 	Contrasena string `json:"contrasena"`
+	// Foto solo se usa para recibir la imagen en base64; la foto guardada vive
+	// en GridFS y se referencia con FotoID. Los documentos que aún no pasaron
+	// por la migración 2 la conservan embebida.
+	Foto   string             `json:"foto,omitempty"`
+	FotoID primitive.ObjectID `json:"-" bson:"foto_id,omitempty"`
+	// ClaveDatos es la clave con la que se cifran cédula, correo y teléfono.
+	ClaveDatos   *cifrado.ClaveCifrada `json:"-" bson:"clave_datos,omitempty"`
+	ID           primitive.ObjectID    `json:"-" bson:"_id,omitempty"`
+	UltimaSesion string                `json:"ultimaSesion,omitempty" bson:"ultimaSesion,omitempty"`
+	// Estado es estadoPendienteVerificacion hasta que el usuario confirma su
+	// correo. Se ignora al recibirlo del cliente.
+	Estado string `json:"estado,omitempty" bson:"estado,omitempty"`
+	// SegundoFactor es factorRostro o factorTOTP; vacío equivale a rostro.
+	SegundoFactor string             `json:"segundoFactor,omitempty" bson:"segundo_factor,omitempty"`
+	TOTP          *configuracionTOTP `json:"-" bson:"totp,omitempty"`
+	// Passkeys son las llaves de acceso con las que puede entrar sin
+	// contraseña ni rostro.
+	Passkeys []credencialPasskey `json:"-" bson:"passkeys,omitempty"`
+	// GoogleSub es el sujeto de la cuenta de Google vinculada.
+	GoogleSub string `json:"-" bson:"google_sub,omitempty"`
+	// Roles y Permisos solo los cambia un administrador con asignarRoles;
+	// nunca se toman del cuerpo de una solicitud.
+	Roles    []string `json:"-" bson:"roles,omitempty"`
+	Permisos []string `json:"-" bson:"permisos,omitempty"`
+	// OrganizadorID es el organizador para el que trabaja con los roles
+	// organizador o porteria.
+	OrganizadorID primitive.ObjectID `json:"-" bson:"organizador_id,omitempty"`
+}
+
+// datosUsuario es el usuario tal como se devuelve al cliente: sin contraseña
+// ni foto de referencia, que tiene su propio endpoint.
+type datosUsuario struct {
+	Nombres       string `json:"nombres"`
+	Apellidos     string `json:"apellidos"`
+	Cedula        string `json:"cedula"`
+	Correo        string `json:"correo"`
+	Telefono      string `json:"telefono"`
+	UltimaSesion  string `json:"ultimaSesion,omitempty"`
+	Estado        string `json:"estado,omitempty"`
+	SegundoFactor string `json:"segundoFactor,omitempty"`
+}
+
+// solicitudInicioSesion es el cuerpo de POST /login y POST /api/v1/sesiones.
+type solicitudInicioSesion struct {
+	Cedula     string `json:"cedula"`
+	Contrasena string `json:"contrasena"`
 	Foto       string `json:"foto"`
+	// Codigo reemplaza a Foto en las cuentas con TOTP como segundo factor.
+	Codigo string `json:"codigo,omitempty"`
+}
+
+// solicitudVerificarCorreo es el cuerpo de la verificación de correo.
+type solicitudVerificarCorreo struct {
+	Email string `json:"email"`
+}
+
+// solicitudVerificarRostro es el cuerpo de la verificación facial. Reto es
+// el que devolvió la verificación de correo.
+type solicitudVerificarRostro struct {
+	Reto string `json:"reto"`
+	Foto string `json:"foto"`
+	// Codigo reemplaza a Foto en las cuentas con TOTP como segundo factor.
+	Codigo string `json:"codigo,omitempty"`
 }
 
 type Venta struct {
@@ -55,90 +139,276 @@ type Venta struct {
 	Total     float64   `json:"total"`
 	Fecha     time.Time `json:"fecha"`
 	Estado    string    `json:"estado"`
+	// ClaveDatos es la clave con la que se cifran los datos personales del comprador.
+	ClaveDatos *cifrado.ClaveCifrada `json:"-" bson:"clave_datos,omitempty"`
+	// ID va en el código QR de cada boleta. Se ignora al recibirlo del cliente.
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// Ingresos son las boletas que ya pasaron por la portería.
+	Ingresos []ingreso `json:"ingresos,omitempty" bson:"ingresos,omitempty"`
+	// EventoID es el evento de la compra. Si llega, el total sale de sus
+	// precios y la venta queda del organizador del evento.
+	EventoID      primitive.ObjectID `json:"evento,omitempty" bson:"evento_id,omitempty"`
+	OrganizadorID primitive.ObjectID `json:"-" bson:"organizador_id,omitempty"`
 }
 
 func registrarVenta(c *gin.Context) {
 	var venta Venta
 
 	if err := c.ShouldBindJSON(&venta); err != nil {
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "Datos inválidos"})
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
 		return
 	}
 
-	// Validar campos obligatorios
+	// Validar campos obligatorios. Con evento el total lo calcula el servidor.
 	if venta.Nombre == "" || venta.Cedula == "" || venta.Correo == "" ||
 		venta.Telefono == "" || venta.Zona == "" || venta.Cantidad <= 0 ||
-		venta.Total <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "Todos los campos son obligatorios"})
+		(venta.Total <= 0 && venta.EventoID.IsZero()) {
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
 		return
 	}
 
-	// Preparar documento para inserción
-	ventaDoc := bson.M{
-		"nombre":    venta.Nombre,
+	// Cada cliente compra a su nombre
+	if !autorizarCedula(c, venta.Cedula) {
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	// Solo compran cuentas con el correo confirmado, porque a ese correo se
+	// envían las boletas
+	var comprador Usuario
+	err := collection.FindOne(ctx, filtroCedula(venta.Cedula)).Decode(&comprador)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			responderError(c, http.StatusNotFound, codigoUsuarioNoEncontrado)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al buscar el comprador", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+	if !comprador.correoVerificado() {
+		slog.WarnContext(c.Request.Context(), "Compra rechazada: correo sin confirmar", "cedula", venta.Cedula)
+		responderError(c, http.StatusForbidden, codigoCorreoNoVerificado)
+		return
+	}
+
+	if !venta.EventoID.IsZero() && !precioDeEvento(c, &venta) {
+		return
+	}
+
+	// Preparar documento para inserción con los datos personales cifrados
+	ventaDoc, err := cifrarCampos(map[string]string{
 		"cedula":    venta.Cedula,
 		"telefono":  venta.Telefono,
 		"direccion": venta.Direccion,
 		"correo":    venta.Correo,
-		"zona":      venta.Zona,
-		"cantidad":  venta.Cantidad,
-		"total":     venta.Total,
-		"fecha":     time.Now(),
-		"estado":    "completado",
+	}, nil)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron cifrar los datos de la venta", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	venta.ID = primitive.NewObjectID()
+	venta.Fecha = time.Now()
+	venta.Estado = estadoVentaCompletada
+	ventaDoc["_id"] = venta.ID
+	ventaDoc["nombre"] = venta.Nombre
+	ventaDoc["zona"] = venta.Zona
+	ventaDoc["cantidad"] = venta.Cantidad
+	ventaDoc["total"] = venta.Total
+	ventaDoc["fecha"] = venta.Fecha
+	ventaDoc["estado"] = venta.Estado
+	if !venta.EventoID.IsZero() {
+		ventaDoc["evento_id"] = venta.EventoID
+		ventaDoc["organizador_id"] = venta.OrganizadorID
 	}
 
 	// Insertar en MongoDB Atlas
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	_, err := ventasCollection.InsertOne(ctx, ventaDoc)
+	_, err = ventasCollection.InsertOne(ctx, ventaDoc)
 	if err != nil {
-		log.Println("❌ ERROR: No se pudo insertar en MongoDB Atlas:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error al registrar la venta"})
+		slog.ErrorContext(c.Request.Context(), "No se pudo insertar la venta en MongoDB Atlas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
+	escritoEnAtlas := time.Now()
+	observarVenta(venta)
 
 	// Insertar en MongoDB Local si está disponible
 	if ventasCollectionLocal != nil && clientLocal != nil {
-		ctxLocal, cancelLocal := context.WithTimeout(context.Background(), 5*time.Second)
+		ctxLocal, cancelLocal := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 		defer cancelLocal()
 
 		_, err = ventasCollectionLocal.InsertOne(ctxLocal, ventaDoc)
+		observarReplica("ventas", escritoEnAtlas, err)
 		if err != nil {
-			log.Println("⚠️ Advertencia: No se pudo insertar en MongoDB Local:", err)
+			slog.WarnContext(c.Request.Context(), "No se pudo insertar la venta en MongoDB Local", "error", err)
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success", "mensaje": "Venta registrada exitosamente"})
+	auditar(c, accionVentaCrear, objetivo(objetivoVenta, venta.ID, venta.Cedula), nil, venta)
+	responderOK(c, http.StatusOK, exitoVentaRegistrada, datosVentaRegistrada{ID: venta.ID})
 }
 
 func main() {
-	err := godotenv.Load()
+	var err error
+	cfg, err = config.Cargar()
+	if err != nil {
+		log.Fatal("❌ ERROR: Configuración inválida:\n", err)
+	}
+	configurarLogs(cfg.Logs.Nivel)
+	slog.Info("Configuración efectiva", "config", cfg.Redactada())
+
+	apagar, err := iniciarTrazas()
 	if err != nil {
-		log.Println("⚠️ Advertencia: No se pudo cargar el archivo .env:", err)
+		log.Fatal("❌ ERROR: No se pudo iniciar el exportador de trazas: ", err)
+	}
+	defer apagarTrazas(apagar)
+
+	cargarLlavero()
+	conectarBases()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			ejecutarMigraciones(os.Args[2:])
+			desconectarBases()
+			return
+		case "claves":
+			ejecutarRotacionClaves(os.Args[2:])
+			desconectarBases()
+			return
+		case "roles":
+			ejecutarAsignacionRoles(os.Args[2:])
+			desconectarBases()
+			return
+		}
+	}
+
+	// ctx se cancela con SIGINT o SIGTERM e inicia el apagado ordenado
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	iniciarRetencion(ctx)
+	iniciarLimites()
+	iniciarCorreo()
+	iniciarGoogle()
+	if err := iniciarWebAuthn(); err != nil {
+		log.Fatal("❌ ERROR: No se pudo configurar WebAuthn: ", err)
+	}
+
+	if cfg.Entorno == config.EntornoProduccion {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.New()
+	r.Use(middlewareIDSolicitud, otelgin.Middleware(nombreServicio, otelgin.WithGinFilter(rastrearRuta)))
+	r.Use(middlewareRegistro, gin.CustomRecovery(recuperarPanico), middlewareMetricas)
+	r.Use(cors.New(cors.Config{
+		AllowOrigins:     cfg.Servidor.OrigenesCORS,
+		AllowMethods:     []string{"POST", "GET", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", cabeceraIDSolicitud},
+		ExposeHeaders:    []string{"Content-Length", cabeceraIDSolicitud, "Deprecation", "Link", "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(rutaNoEncontrada)
+	r.NoMethod(metodoNoPermitido)
+
+	registrarRutasV1(r)
+	registrarRutasLegado(r)
+	r.GET("/healthz", healthz)
+	r.GET("/readyz", readyz)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	srv := &http.Server{
+		Addr:              cfg.Servidor.Direccion,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Servidor escuchando", "direccion", cfg.Servidor.Direccion)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("❌ ERROR: No se pudo iniciar el servidor HTTP:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	apagando.Store(true)
+	slog.Info("Señal de apagado recibida, esperando las solicitudes en curso")
+
+	ctxApagado, cancel := context.WithTimeout(context.Background(), cfg.Servidor.TimeoutApagado.Duration())
+	defer cancel()
+	if err := srv.Shutdown(ctxApagado); err != nil {
+		slog.Warn("El servidor no terminó a tiempo", "error", err)
 	}
 
-	// Configuración para MongoDB Atlas
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		log.Fatal("❌ ERROR: La variable de entorno MONGO_URI no está definida")
+	desconectarBases()
+	slog.Info("Servidor detenido")
+}
+
+// registrarRutasLegado monta las rutas anteriores a /api/v1. Siguen
+// funcionando para las pantallas actuales de React, con el sobre de
+// compatibilidad y los encabezados de ruta obsoleta.
+func registrarRutasLegado(r *gin.Engine) {
+	legado := r.Group("/", compatibilidadLegado)
+	legado.POST("/registro", obsoleta("/usuarios"), registrarUsuario)
+	legado.POST("/login", obsoleta("/sesiones"), limitarPorIP, iniciarSesion)
+	legado.POST("/ventas", obsoleta("/ventas"), exigirPermiso(permisoComprar), registrarVenta)
+	legado.POST("/obtener-usuario", obsoleta("/usuarios/{cedula}"), exigirPermiso(permisoDatosPropios), obtenerUsuario)
+	legado.PUT("/actualizar-usuario", obsoleta("/usuarios/{cedula}"), exigirPermiso(permisoDatosPropios), actualizarUsuario)
+	legado.DELETE("/eliminar-usuario", obsoleta("/usuarios/{cedula}"), exigirPermiso(permisoDatosPropios), eliminarUsuario)
+	legado.POST("/verificar-correo", obsoleta("/verificaciones/correo"), limitarPorIP, verificarCorreo)
+	legado.POST("/verificar-rostro", obsoleta("/verificaciones/rostro"), limitarPorIP, verificarRostro)
+	legado.PUT("/actualizar-ultima-sesion", obsoleta("/usuarios/{cedula}/ultima-sesion"), exigirPermiso(permisoDatosPropios), actualizarUltimaSesion)
+
+	// Rutas de datos personales publicadas antes de /api/v1, ya con el sobre nuevo
+	r.GET("/usuarios/:cedula/foto", obsoleta("/usuarios/{cedula}/foto"), exigirPermiso(permisoDatosPropios), obtenerMiniatura)
+	r.GET("/usuarios/:cedula/datos", obsoleta("/usuarios/{cedula}/datos"), exigirPermiso(permisoDatosPropios), exportarDatosPersonales)
+	r.DELETE("/usuarios/:cedula/datos", obsoleta("/usuarios/{cedula}/datos"), exigirPermiso(permisoDatosPropios), solicitarSupresion)
+}
+
+// desconectarBases cierra las conexiones a MongoDB Atlas y MongoDB Local.
+func desconectarBases() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if clientLocal != nil {
+		if err := clientLocal.Disconnect(ctx); err != nil {
+			slog.Warn("No se pudo cerrar la conexión a MongoDB Local", "error", err)
+		}
+	}
+	if client != nil {
+		if err := client.Disconnect(ctx); err != nil {
+			slog.Warn("No se pudo cerrar la conexión a MongoDB Atlas", "error", err)
+		}
 	}
+}
 
+// conectarBases abre las conexiones a MongoDB Atlas y, si está configurado,
+// a MongoDB Local, e inicializa las colecciones globales.
+func conectarBases() {
 	// Configuración para MongoDB Local
-	mongoURILocal := os.Getenv("MONGO_URI_LOCAL")
-	if mongoURILocal == "" {
-		log.Println("⚠️ Advertencia: La variable de entorno MONGO_URI_LOCAL no está definida, usando solo MongoDB Atlas")
+	if cfg.Mongo.URILocal == "" {
+		slog.Warn("MONGO_URI_LOCAL no está definida, usando solo MongoDB Atlas")
 	}
 
-	clientOptions := options.Client().ApplyURI(mongoURI).
-		SetTLSConfig(&tls.Config{
-			MinVersion:         tls.VersionTLS12,
-			InsecureSkipVerify: true,
-		}).SetServerSelectionTimeout(10 * time.Second).
-		SetConnectTimeout(10 * time.Second)
+	clientOptions := options.Client().ApplyURI(cfg.Mongo.URI).
+		SetServerSelectionTimeout(cfg.Mongo.TimeoutConexion.Duration()).
+		SetConnectTimeout(cfg.Mongo.TimeoutConexion.Duration()).
+		SetMonitor(monitorMongoCompleto("atlas"))
+
+	if err := configurarTLSAtlas(clientOptions); err != nil {
+		log.Fatal("❌ ERROR: Configuración TLS de MongoDB inválida: ", err)
+	}
 
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+	var err error
+	client, err = mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
 		log.Fatal("❌ ERROR: No se pudo conectar a MongoDB:", err)
 	}
@@ -148,16 +418,26 @@ func main() {
 		log.Fatal("❌ ERROR: No se pudo hacer ping a MongoDB:", err)
 	}
 
-	collection = client.Database("qrtixpro").Collection("usuarios")
-	logsCollection = client.Database("qrtixpro").Collection("logs")
-	ventasCollection = client.Database("qrtixpro").Collection("ventas")
-	log.Println("✅ Conexión exitosa a MongoDB Atlas")
+	collection = client.Database(cfg.Mongo.BaseDatos).Collection("usuarios")
+	logsCollection = client.Database(cfg.Mongo.BaseDatos).Collection("logs")
+	ventasCollection = client.Database(cfg.Mongo.BaseDatos).Collection("ventas")
+	retosCollection = client.Database(cfg.Mongo.BaseDatos).Collection("retos_login")
+	restablecimientosCollection = client.Database(cfg.Mongo.BaseDatos).Collection("restablecimientos")
+	confirmacionesCollection = client.Database(cfg.Mongo.BaseDatos).Collection("confirmaciones_correo")
+	ceremoniasCollection = client.Database(cfg.Mongo.BaseDatos).Collection("ceremonias_webauthn")
+	organizadoresCollection = client.Database(cfg.Mongo.BaseDatos).Collection("organizadores")
+	eventosCollection = client.Database(cfg.Mongo.BaseDatos).Collection("eventos")
+	auditoriaCollection = client.Database(cfg.Mongo.BaseDatos).Collection("auditoria")
+	sesionesCollection = client.Database(cfg.Mongo.BaseDatos).Collection("sesiones")
+	fotosAtlas = fotos.NuevoAlmacen(client.Database(cfg.Mongo.BaseDatos), llavero)
+	slog.Info("Conexión exitosa a MongoDB Atlas")
 
 	// Conectar a MongoDB Local si está configurado
-	if mongoURILocal != "" {
-		clientOptionsLocal := options.Client().ApplyURI(mongoURILocal).
-			SetServerSelectionTimeout(5 * time.Second).
-			SetConnectTimeout(5 * time.Second)
+	if cfg.Mongo.URILocal != "" {
+		clientOptionsLocal := options.Client().ApplyURI(cfg.Mongo.URILocal).
+			SetServerSelectionTimeout(cfg.Mongo.TimeoutConexionLocal.Duration()).
+			SetConnectTimeout(cfg.Mongo.TimeoutConexionLocal.Duration()).
+			SetMonitor(monitorMongoCompleto("local"))
 
 		var localErr error
 		clientLocal, localErr = mongo.Connect(context.TODO(), clientOptionsLocal)
@@ -170,124 +450,148 @@ func main() {
 				_ = clientLocal.Disconnect(context.TODO())
 			}
 			clientLocal = nil
-			log.Printf("ℹ️ MongoDB Local no disponible: %v", localErr)
+			slog.Warn("MongoDB Local no disponible", "error", localErr)
 		} else {
-			collectionLocal = clientLocal.Database("qrtixpro").Collection("usuarios")
-			logsCollectionLocal = clientLocal.Database("qrtixpro").Collection("logs")
-			ventasCollectionLocal = clientLocal.Database("qrtixpro").Collection("ventas")
-			log.Println("✅ Conexión exitosa a MongoDB Local")
+			collectionLocal = clientLocal.Database(cfg.Mongo.BaseDatos).Collection("usuarios")
+			logsCollectionLocal = clientLocal.Database(cfg.Mongo.BaseDatos).Collection("logs")
+			ventasCollectionLocal = clientLocal.Database(cfg.Mongo.BaseDatos).Collection("ventas")
+			fotosLocal = fotos.NuevoAlmacen(clientLocal.Database(cfg.Mongo.BaseDatos), llavero)
+			slog.Info("Conexión exitosa a MongoDB Local")
 		}
 	}
+}
 
-	r := gin.Default()
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"POST", "GET", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+// baseConectada es una base de datos con un nombre legible para los logs.
+type baseConectada struct {
+	nombre string
+	db     *mongo.Database
+}
 
-	r.POST("/registro", registrarUsuario)
-	r.POST("/login", iniciarSesion)
-	r.POST("/ventas", registrarVenta)
-	r.POST("/obtener-usuario", obtenerUsuario)
-	r.PUT("/actualizar-usuario", actualizarUsuario)
-	r.DELETE("/eliminar-usuario", eliminarUsuario)
-	r.POST("/verificar-correo", verificarCorreo)
-	r.POST("/verificar-rostro", verificarRostro)
-	r.PUT("/actualizar-ultima-sesion", actualizarUltimaSesion)
-
-	port := ":8080"
-	fmt.Println("🚀 Servidor corriendo en http://localhost" + port)
-	r.Run(port)
+// basesConectadas devuelve MongoDB Atlas y, si está disponible, MongoDB Local.
+func basesConectadas() []baseConectada {
+	bases := []baseConectada{{"MongoDB Atlas", client.Database(cfg.Mongo.BaseDatos)}}
+	if clientLocal != nil {
+		bases = append(bases, baseConectada{"MongoDB Local", clientLocal.Database(cfg.Mongo.BaseDatos)})
+	}
+	return bases
 }
 
 func registrarUsuario(c *gin.Context) {
 	var usuario Usuario
 
 	if err := c.ShouldBindJSON(&usuario); err != nil {
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "Datos inválidos"})
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
 		return
 	}
 
 	// Validar campos obligatorios
 	errores := validarCamposUsuario(usuario)
 	if len(errores) > 0 {
-		log.Println("❌ ERROR: Validación fallida:", errores)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "Datos inválidos", "errores": errores})
+		slog.WarnContext(c.Request.Context(), "Validación fallida", "errores", errores)
+		responderValidacion(c, errores)
 		return
 	}
 
 	// Verificar si ya existe un usuario con la misma cédula
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 	defer cancel()
 
 	var usuarioExistente Usuario
-	err := collection.FindOne(ctx, bson.M{"cedula": usuario.Cedula}).Decode(&usuarioExistente)
+	err := collection.FindOne(ctx, filtroCedula(usuario.Cedula)).Decode(&usuarioExistente)
 	if err == nil {
-		log.Printf("❌ ERROR: Ya existe un usuario con la cédula %s", usuario.Cedula)
-		c.JSON(http.StatusConflict, gin.H{"status": "error", "mensaje": "Ya existe un usuario con esta cédula"})
+		slog.WarnContext(c.Request.Context(), "Ya existe un usuario con la cédula", "cedula", usuario.Cedula)
+		responderError(c, http.StatusConflict, codigoCedulaDuplicada)
 		return
 	} else if err != mongo.ErrNoDocuments {
-		log.Println("❌ ERROR: Error al verificar usuario existente:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error al verificar usuario existente"})
+		slog.ErrorContext(c.Request.Context(), "Error al verificar usuario existente", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
 
 	// Verificar si ya existe un usuario con el mismo correo
-	err = collection.FindOne(ctx, bson.M{"correo": usuario.Correo}).Decode(&usuarioExistente)
+	err = collection.FindOne(ctx, filtroCorreo(usuario.Correo)).Decode(&usuarioExistente)
 	if err == nil {
-		log.Printf("❌ ERROR: Ya existe un usuario con el correo %s", usuario.Correo)
-		c.JSON(http.StatusConflict, gin.H{"status": "error", "mensaje": "Ya existe un usuario con este correo electrónico"})
+		slog.WarnContext(c.Request.Context(), "Ya existe un usuario con el correo", "correo", usuario.Correo)
+		responderError(c, http.StatusConflict, codigoCorreoDuplicado)
 		return
 	} else if err != mongo.ErrNoDocuments {
-		log.Println("❌ ERROR: Error al verificar correo existente:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error al verificar correo existente"})
+		slog.ErrorContext(c.Request.Context(), "Error al verificar correo existente", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
 
-	// Preparar documento para inserción
-	usuarioDoc := bson.M{
-		"nombres":    usuario.Nombres,
-		"apellidos":  usuario.Apellidos,
-		"cedula":     usuario.Cedula,
-		"correo":     usuario.Correo,
-		"telefono":   usuario.Telefono,
-		"contrasena": usuario.Contrasena,
-		"foto":       usuario.Foto,
+	// Guardar la foto en GridFS; el usuario solo guarda la referencia
+	fotoID := primitive.NewObjectID()
+	if err := fotosAtlas.Guardar(ctx, fotoID, usuario.Foto); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo guardar la foto en MongoDB Atlas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
 	}
 
+	// Preparar documento para inserción con los datos personales cifrados
+	usuarioDoc, err := cifrarCampos(map[string]string{
+		"cedula":   usuario.Cedula,
+		"correo":   usuario.Correo,
+		"telefono": usuario.Telefono,
+	}, nil)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron cifrar los datos del usuario", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	usuarioDoc["nombres"] = usuario.Nombres
+	usuarioDoc["apellidos"] = usuario.Apellidos
+	usuarioDoc["contrasena"] = usuario.Contrasena
+	usuarioDoc["foto_id"] = fotoID
+	usuarioDoc["estado"] = estadoPendienteVerificacion
+
 	// Insertar en MongoDB Atlas
-	_, err = collection.InsertOne(ctx, usuarioDoc)
+	insertado, err := collection.InsertOne(ctx, usuarioDoc)
 	if err != nil {
-		log.Println("❌ ERROR: No se pudo insertar en MongoDB Atlas:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error al registrar usuario"})
+		slog.ErrorContext(c.Request.Context(), "No se pudo insertar el usuario en MongoDB Atlas", "error", err)
+		if err := fotosAtlas.Eliminar(ctx, fotoID); err != nil {
+			slog.WarnContext(c.Request.Context(), "No se pudo eliminar la foto huérfana", "error", err)
+		}
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
+	escritoEnAtlas := time.Now()
+	usuarioID := insertado.InsertedID.(primitive.ObjectID)
 
 	// Insertar en MongoDB Local si está disponible
 	if collectionLocal != nil && clientLocal != nil {
-		ctxLocal, cancelLocal := context.WithTimeout(context.Background(), 5*time.Second)
+		ctxLocal, cancelLocal := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 		defer cancelLocal()
 
 		// Verificar la conexión local antes de intentar la operación
 		if err := clientLocal.Ping(ctxLocal, nil); err != nil {
-			log.Printf("ℹ️ MongoDB Local no disponible: %v", err)
+			observarReplica("usuarios", escritoEnAtlas, err)
+			slog.InfoContext(c.Request.Context(), "MongoDB Local no disponible", "error", err)
+		} else if err := fotosLocal.Guardar(ctxLocal, fotoID, usuario.Foto); err != nil {
+			observarReplica("usuarios", escritoEnAtlas, err)
+			slog.InfoContext(c.Request.Context(), "No se pudo guardar la foto en MongoDB Local", "error", err)
 		} else {
 			_, err = collectionLocal.InsertOne(ctxLocal, usuarioDoc)
+			observarReplica("usuarios", escritoEnAtlas, err)
 			if err != nil {
-				log.Printf("ℹ️ No se pudo registrar en MongoDB Local: %v", err)
+				slog.InfoContext(c.Request.Context(), "No se pudo registrar el usuario en MongoDB Local", "error", err)
 			} else {
-				log.Println("✅ Usuario registrado exitosamente en MongoDB Local")
+				slog.DebugContext(c.Request.Context(), "Usuario registrado en MongoDB Local")
 			}
 		}
 	}
 
-	log.Println("✅ Usuario registrado con éxito:", usuario.Cedula)
-	c.JSON(http.StatusOK, gin.H{"status": "success", "mensaje": "Usuario registrado con éxito"})
+	// Si falla, el usuario puede pedir otro enlace con el reenvío
+	if err := enviarConfirmacion(ctx, c, usuarioID, usuario.Correo); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo emitir el enlace de confirmación", "cedula", usuario.Cedula, "error", err)
+	}
+
+	usuario.Foto, usuario.FotoID, usuario.Estado = "", fotoID, estadoPendienteVerificacion
+	auditar(c, accionUsuarioCrear, objetivo(objetivoUsuario, usuarioID, usuario.Cedula), nil, usuario)
+
+	slog.InfoContext(c.Request.Context(), "Usuario registrado", "cedula", usuario.Cedula)
+	responderOK(c, http.StatusOK, exitoUsuarioRegistrado, nil)
 }
 
 // Función para validar los campos del usuario
@@ -296,143 +600,166 @@ func validarCamposUsuario(usuario Usuario) map[string]string {
 
 	// Validar nombres
 	if strings.TrimSpace(usuario.Nombres) == "" {
-		errores["nombres"] = "El nombre es obligatorio"
+		errores["nombres"] = "nombres.obligatorio"
 	} else if !regexp.MustCompile(`^[a-zA-ZáéíóúÁÉÍÓÚñÑ\s]+$`).MatchString(usuario.Nombres) {
-		errores["nombres"] = "El nombre solo debe contener letras"
+		errores["nombres"] = "nombres.letras"
 	} else if len(usuario.Nombres) < 2 {
-		errores["nombres"] = "El nombre debe tener al menos 2 caracteres"
+		errores["nombres"] = "nombres.longitud"
 	}
 
 	// Validar apellidos
 	if strings.TrimSpace(usuario.Apellidos) == "" {
-		errores["apellidos"] = "El apellido es obligatorio"
+		errores["apellidos"] = "apellidos.obligatorio"
 	} else if !regexp.MustCompile(`^[a-zA-ZáéíóúÁÉÍÓÚñÑ\s]+$`).MatchString(usuario.Apellidos) {
-		errores["apellidos"] = "El apellido solo debe contener letras"
+		errores["apellidos"] = "apellidos.letras"
 	} else if len(usuario.Apellidos) < 2 {
-		errores["apellidos"] = "El apellido debe tener al menos 2 caracteres"
+		errores["apellidos"] = "apellidos.longitud"
 	}
 
 	// Validar cédula
 	if strings.TrimSpace(usuario.Cedula) == "" {
-		errores["cedula"] = "La cédula es obligatoria"
+		errores["cedula"] = "cedula.obligatorio"
 	} else if !regexp.MustCompile(`^\d+$`).MatchString(usuario.Cedula) {
-		errores["cedula"] = "La cédula solo debe contener números"
+		errores["cedula"] = "cedula.numeros"
 	} else if len(usuario.Cedula) < 5 || len(usuario.Cedula) > 12 {
-		errores["cedula"] = "La cédula debe tener entre 5 y 12 dígitos"
+		errores["cedula"] = "cedula.longitud"
 	}
 
 	// Validar correo
 	if strings.TrimSpace(usuario.Correo) == "" {
-		errores["correo"] = "El correo electrónico es obligatorio"
+		errores["correo"] = "correo.obligatorio"
 	} else if !regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`).MatchString(usuario.Correo) {
-		errores["correo"] = "Ingrese un correo electrónico válido"
+		errores["correo"] = "correo.formato"
 	}
 
 	// Validar teléfono
 	if strings.TrimSpace(usuario.Telefono) == "" {
-		errores["telefono"] = "El teléfono es obligatorio"
+		errores["telefono"] = "telefono.obligatorio"
 	} else if !regexp.MustCompile(`^\d+$`).MatchString(usuario.Telefono) {
-		errores["telefono"] = "El teléfono solo debe contener números"
+		errores["telefono"] = "telefono.numeros"
 	} else if len(usuario.Telefono) < 7 || len(usuario.Telefono) > 15 {
-		errores["telefono"] = "El teléfono debe tener entre 7 y 15 dígitos"
+		errores["telefono"] = "telefono.longitud"
 	}
 
 	// Validar contraseña
-	if usuario.Contrasena == "" {
-		errores["contrasena"] = "La contraseña es obligatoria"
-	} else if len(usuario.Contrasena) < 8 {
-		errores["contrasena"] = "La contraseña debe tener al menos 8 caracteres"
-	} else {
-		tieneMinuscula := regexp.MustCompile(`[a-z]`).MatchString(usuario.Contrasena)
-		tieneMayuscula := regexp.MustCompile(`[A-Z]`).MatchString(usuario.Contrasena)
-		tieneNumero := regexp.MustCompile(`[0-9]`).MatchString(usuario.Contrasena)
-		tieneEspecial := regexp.MustCompile(`[!@#$%^&*(),.?":{}|<>]`).MatchString(usuario.Contrasena)
-
-		if !tieneMinuscula || !tieneMayuscula || !tieneNumero || !tieneEspecial {
-			errores["contrasena"] = "La contraseña debe contener al menos una letra minúscula, una mayúscula, un número y un carácter especial"
-		}
+	if clave := validarContrasena(usuario.Contrasena); clave != "" {
+		errores["contrasena"] = clave
 	}
 
 	// Validar foto
 	if strings.TrimSpace(usuario.Foto) == "" {
-		errores["foto"] = "La foto es obligatoria"
+		errores["foto"] = "foto.obligatorio"
+	} else if _, _, err := fotos.Decodificar(usuario.Foto); err != nil {
+		errores["foto"] = "foto.formato"
 	}
 
 	return errores
 }
 
-func iniciarSesion(c *gin.Context) {
-	var datosLogin struct {
-		Cedula     string `json:"cedula"`
-		Contrasena string `json:"contrasena"`
-		Foto       string `json:"foto"`
+// validarContrasena aplica las reglas de contraseña del registro y devuelve
+// la clave del error o "" si es válida.
+func validarContrasena(contrasena string) string {
+	if contrasena == "" {
+		return "contrasena.obligatorio"
 	}
+	if len(contrasena) < 8 {
+		return "contrasena.longitud"
+	}
+	tieneMinuscula := regexp.MustCompile(`[a-z]`).MatchString(contrasena)
+	tieneMayuscula := regexp.MustCompile(`[A-Z]`).MatchString(contrasena)
+	tieneNumero := regexp.MustCompile(`[0-9]`).MatchString(contrasena)
+	tieneEspecial := regexp.MustCompile(`[!@#$%^&*(),.?":{}|<>]`).MatchString(contrasena)
+
+	if !tieneMinuscula || !tieneMayuscula || !tieneNumero || !tieneEspecial {
+		return "contrasena.complejidad"
+	}
+	return ""
+}
+
+func iniciarSesion(c *gin.Context) {
+	var datosLogin solicitudInicioSesion
 
 	if err := c.ShouldBindJSON(&datosLogin); err != nil {
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Datos inválidos"})
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 	defer cancel()
 
+	if !limitarIdentificador(ctx, c, "cedula", datosLogin.Cedula) || cuentaBloqueada(ctx, c, datosLogin.Cedula) {
+		return
+	}
+
 	var usuario Usuario
-	err := collection.FindOne(ctx, bson.M{"cedula": datosLogin.Cedula}).Decode(&usuario)
+	err := collection.FindOne(ctx, filtroCedula(datosLogin.Cedula)).Decode(&usuario)
 	if err != nil {
-		log.Printf("❌ ERROR: Usuario no encontrado para cédula %s: %v", datosLogin.Cedula, err)
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Cédula o contraseña incorrecta"})
+		slog.WarnContext(c.Request.Context(), "Usuario no encontrado al iniciar sesión", "cedula", datosLogin.Cedula, "error", err)
+		registrarFallo(ctx, c, datosLogin.Cedula)
+		responderError(c, http.StatusUnauthorized, codigoCredencialesInvalidas)
 		return
 	}
 
 	if datosLogin.Contrasena != usuario.Contrasena {
-		log.Printf("❌ ERROR: Contraseña incorrecta para cédula %s", datosLogin.Cedula)
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Cédula o contraseña incorrecta"})
+		slog.WarnContext(c.Request.Context(), "Contraseña incorrecta", "cedula", datosLogin.Cedula)
+		registrarFallo(ctx, c, datosLogin.Cedula)
+		usuario.Cedula = datosLogin.Cedula
+		registrarInicioFallido(c, ctx, usuario, metodoContrasena, motivoContrasena)
+		responderError(c, http.StatusUnauthorized, codigoCredencialesInvalidas)
 		return
 	}
 
-	if !compararImagenes(usuario.Foto, datosLogin.Foto) {
-		log.Printf("❌ ERROR: Verificación facial fallida para cédula %s", datosLogin.Cedula)
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Verificación facial fallida"})
+	if err := descifrarUsuario(&usuario); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo descifrar el usuario", "cedula", datosLogin.Cedula, "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
+	if !verificarSegundoFactor(ctx, c, usuario, datosLogin.Foto, datosLogin.Codigo) {
+		registrarInicioFallido(c, ctx, usuario, metodoContrasena, motivoSegundoFactor)
+		return
+	}
+	reiniciarFallos(ctx, c, datosLogin.Cedula)
 
-	// Registrar el log de inicio de sesión
-	colombiaLoc, _ := time.LoadLocation("America/Bogota")
-	tiempoColombia := time.Now().In(colombiaLoc)
-	formatoFecha := tiempoColombia.Format("2006-01-02 15:04:05")
-
-	logData := bson.M{
-		"cedula":     datosLogin.Cedula,
-		"fecha_hora": formatoFecha,
+	sesion, ok := abrirSesion(c, ctx, usuario, metodoContrasena)
+	if !ok {
+		return
 	}
 
+	slog.InfoContext(c.Request.Context(), "Inicio de sesión exitoso", "cedula", datosLogin.Cedula)
+	responderOK(c, http.StatusOK, exitoInicioSesion, sesion)
+}
+
+// registrarInicioSesion guarda el intento de inicio de sesión en la colección
+// logs de Atlas y, si está disponible, de MongoDB Local. Un fallo solo se
+// registra.
+func registrarInicioSesion(c *gin.Context, ctx context.Context, logData inicioSesion) {
 	// Registrar en MongoDB Atlas
-	_, err = logsCollection.InsertOne(ctx, logData)
+	_, err := logsCollection.InsertOne(ctx, logData)
 	if err != nil {
-		log.Printf("⚠️ Advertencia: No se pudo registrar el log de inicio de sesión en Atlas: %v", err)
+		slog.WarnContext(c.Request.Context(), "No se pudo registrar el log de inicio de sesión en MongoDB Atlas", "error", err)
 	}
+	escritoEnAtlas := time.Now()
 
 	// Registrar en MongoDB Local si está disponible
 	if logsCollectionLocal != nil && clientLocal != nil {
-		ctxLocal, cancelLocal := context.WithTimeout(context.Background(), 5*time.Second)
+		ctxLocal, cancelLocal := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 		defer cancelLocal()
 
 		// Verificar la conexión local antes de intentar la operación
 		if err := clientLocal.Ping(ctxLocal, nil); err != nil {
-			log.Printf("ℹ️ MongoDB Local no disponible: %v", err)
+			observarReplica("logs", escritoEnAtlas, err)
+			slog.InfoContext(c.Request.Context(), "MongoDB Local no disponible", "error", err)
 		} else {
 			_, err = logsCollectionLocal.InsertOne(ctxLocal, logData)
+			observarReplica("logs", escritoEnAtlas, err)
 			if err != nil {
-				log.Printf("ℹ️ No se pudo registrar el log en MongoDB Local: %v", err)
+				slog.InfoContext(c.Request.Context(), "No se pudo registrar el log en MongoDB Local", "error", err)
 			} else {
-				log.Println("✅ Log registrado exitosamente en MongoDB Local")
+				slog.DebugContext(c.Request.Context(), "Log registrado en MongoDB Local")
 			}
 		}
 	}
-
-	log.Printf("✅ Inicio de sesión exitoso para cédula %s", datosLogin.Cedula)
-	c.JSON(http.StatusOK, gin.H{"success": true, "mensaje": "Inicio de sesión exitoso"})
 }
 
 func obtenerUsuario(c *gin.Context) {
@@ -440,74 +767,100 @@ func obtenerUsuario(c *gin.Context) {
 		Cedula string `json:"cedula"`
 	}
 
-	if err := c.ShouldBindJSON(&datos); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "Por favor, ingrese una cédula válida"})
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
+	if !cedulaDeSolicitud(c, &datos.Cedula, &datos) {
 		return
 	}
 
 	if datos.Cedula == "" {
-		log.Println("❌ ERROR: Cédula vacía")
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "La cédula no puede estar vacía"})
+		slog.WarnContext(c.Request.Context(), "Cédula vacía")
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
 		return
 	}
 
-	log.Printf("🔍 Buscando usuario con cédula: %s", datos.Cedula)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	slog.DebugContext(c.Request.Context(), "Buscando usuario", "cedula", datos.Cedula)
+	ctx, cancel := contextoSolicitud(c, 10*time.Second)
 	defer cancel()
 
 	var usuario Usuario
-	filter := bson.M{"cedula": datos.Cedula}
+	filter := filtroCedula(datos.Cedula)
 
 	err := collection.FindOne(ctx, filter).Decode(&usuario)
+	if err == nil {
+		err = descifrarUsuario(&usuario)
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			log.Printf("ℹ️ Usuario no encontrado para la cédula: %s", datos.Cedula)
-			c.JSON(http.StatusNotFound, gin.H{"status": "error", "mensaje": "No se encontró ningún usuario con esa cédula"})
+			slog.InfoContext(c.Request.Context(), "Usuario no encontrado", "cedula", datos.Cedula)
+			responderError(c, http.StatusNotFound, codigoUsuarioNoEncontrado)
 		} else if ctx.Err() == context.DeadlineExceeded {
-			log.Printf("❌ ERROR: Tiempo de espera agotado al buscar usuario: %v", err)
-			c.JSON(http.StatusGatewayTimeout, gin.H{"status": "error", "mensaje": "El servidor tardó demasiado en responder. Por favor, intente nuevamente"})
+			slog.ErrorContext(c.Request.Context(), "Tiempo de espera agotado al buscar usuario", "error", err)
+			responderError(c, http.StatusGatewayTimeout, codigoTiempoAgotado)
 		} else {
-			log.Printf("❌ ERROR: Error al buscar usuario en la base de datos: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error interno al buscar usuario. Por favor, intente más tarde"})
+			slog.ErrorContext(c.Request.Context(), "Error al buscar usuario en la base de datos", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		}
 		return
 	}
 
-	log.Printf("✅ Usuario encontrado exitosamente: %s", datos.Cedula)
-	c.JSON(http.StatusOK, gin.H{"status": "success", "data": usuario})
+	slog.InfoContext(c.Request.Context(), "Usuario encontrado", "cedula", datos.Cedula)
+	responderOK(c, http.StatusOK, "", datosUsuario{
+		Nombres:       usuario.Nombres,
+		Apellidos:     usuario.Apellidos,
+		Cedula:        usuario.Cedula,
+		Correo:        usuario.Correo,
+		Telefono:      usuario.Telefono,
+		UltimaSesion:  usuario.UltimaSesion,
+		Estado:        usuario.Estado,
+		SegundoFactor: usuario.SegundoFactor,
+	})
 }
 
 func actualizarUsuario(c *gin.Context) {
 	var usuario Usuario
 
 	if err := c.ShouldBindJSON(&usuario); err != nil {
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "Datos inválidos"})
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
 		return
 	}
 
-	// Validar campos obligatorios
+	// PATCH /api/v1/usuarios/:cedula: los campos que no llegan conservan su valor
+	if cedula := c.Param("cedula"); cedula != "" {
+		usuario.Cedula = cedula
+		if !completarConActual(c, &usuario) {
+			return
+		}
+	} else if !autorizarCedula(c, usuario.Cedula) {
+		return
+	}
+
+	// Validar campos obligatorios. Sin foto nueva se conserva la actual.
 	errores := validarCamposUsuario(usuario)
+	if usuario.Foto == "" {
+		delete(errores, "foto")
+	}
 	if len(errores) > 0 {
-		log.Println("❌ ERROR: Validación fallida:", errores)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "Datos inválidos", "errores": errores})
+		slog.WarnContext(c.Request.Context(), "Validación fallida", "errores", errores)
+		responderValidacion(c, errores)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 	defer cancel()
 
 	// Verificar si existe el usuario
 	var usuarioExistente Usuario
-	err := collection.FindOne(ctx, bson.M{"cedula": usuario.Cedula}).Decode(&usuarioExistente)
+	err := collection.FindOne(ctx, filtroCedula(usuario.Cedula)).Decode(&usuarioExistente)
+	if err == nil {
+		err = descifrarUsuario(&usuarioExistente)
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			log.Printf("❌ ERROR: No existe un usuario con la cédula %s", usuario.Cedula)
-			c.JSON(http.StatusNotFound, gin.H{"status": "error", "mensaje": "Usuario no encontrado"})
+			slog.WarnContext(c.Request.Context(), "No existe un usuario con la cédula", "cedula", usuario.Cedula)
+			responderError(c, http.StatusNotFound, codigoUsuarioNoEncontrado)
 		} else {
-			log.Println("❌ ERROR: Error al buscar usuario:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error al buscar usuario"})
+			slog.ErrorContext(c.Request.Context(), "Error al buscar usuario", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		}
 		return
 	}
@@ -515,43 +868,72 @@ func actualizarUsuario(c *gin.Context) {
 	// Verificar si el correo ya está en uso por otro usuario
 	if usuario.Correo != usuarioExistente.Correo {
 		var usuarioCorreo Usuario
-		err = collection.FindOne(ctx, bson.M{"correo": usuario.Correo}).Decode(&usuarioCorreo)
-		if err == nil && usuarioCorreo.Cedula != usuario.Cedula {
-			log.Printf("❌ ERROR: El correo %s ya está en uso por otro usuario", usuario.Correo)
-			c.JSON(http.StatusConflict, gin.H{"status": "error", "mensaje": "El correo electrónico ya está en uso por otro usuario"})
+		err = collection.FindOne(ctx, filtroCorreo(usuario.Correo)).Decode(&usuarioCorreo)
+		if err == nil && usuarioCorreo.ID != usuarioExistente.ID {
+			slog.WarnContext(c.Request.Context(), "El correo ya está en uso por otro usuario", "correo", usuario.Correo)
+			responderError(c, http.StatusConflict, codigoCorreoDuplicado)
 			return
 		} else if err != nil && err != mongo.ErrNoDocuments {
-			log.Println("❌ ERROR: Error al verificar correo existente:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error al verificar correo existente"})
+			slog.ErrorContext(c.Request.Context(), "Error al verificar correo existente", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+			return
+		}
+	}
+
+	campos, err := cifrarCampos(map[string]string{
+		"cedula":   usuario.Cedula,
+		"correo":   usuario.Correo,
+		"telefono": usuario.Telefono,
+	}, usuarioExistente.ClaveDatos)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron cifrar los datos del usuario", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	campos["nombres"] = usuario.Nombres
+	campos["apellidos"] = usuario.Apellidos
+	campos["contrasena"] = usuario.Contrasena
+	correoCambiado := usuario.Correo != usuarioExistente.Correo
+	if correoCambiado {
+		// El correo nuevo también hay que confirmarlo
+		campos["estado"] = estadoPendienteVerificacion
+	}
+	cambios := bson.M{"$set": campos}
+
+	// Si llega una foto nueva se sube a GridFS y reemplaza la referencia
+	var fotoID primitive.ObjectID
+	if usuario.Foto != "" {
+		fotoID = primitive.NewObjectID()
+		if err := fotosAtlas.Guardar(ctx, fotoID, usuario.Foto); err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudo guardar la foto en MongoDB Atlas", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 			return
 		}
+		campos["foto_id"] = fotoID
+		cambios["$unset"] = bson.M{"foto": ""}
 	}
 
 	// Actualizar en MongoDB Atlas
-	resultado, err := collection.UpdateOne(
-		ctx,
-		bson.M{"cedula": usuario.Cedula},
-		bson.M{"$set": bson.M{
-			"nombres":    usuario.Nombres,
-			"apellidos":  usuario.Apellidos,
-			"correo":     usuario.Correo,
-			"telefono":   usuario.Telefono,
-			"contrasena": usuario.Contrasena,
-			"foto":       usuario.Foto,
-		}},
-	)
+	resultado, err := collection.UpdateOne(ctx, bson.M{"_id": usuarioExistente.ID}, cambios)
 
 	if err != nil {
-		log.Println("❌ ERROR: No se pudo actualizar en MongoDB Atlas:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error al actualizar usuario"})
+		slog.ErrorContext(c.Request.Context(), "No se pudo actualizar el usuario en MongoDB Atlas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
 
 	if resultado.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "mensaje": "Usuario no encontrado"})
+		responderError(c, http.StatusNotFound, codigoUsuarioNoEncontrado)
 		return
 	}
 
+	if !fotoID.IsZero() && !usuarioExistente.FotoID.IsZero() {
+		if err := fotosAtlas.Eliminar(ctx, usuarioExistente.FotoID); err != nil {
+			slog.WarnContext(c.Request.Context(), "No se pudo eliminar la foto anterior en MongoDB Atlas", "error", err)
+		}
+	}
+	escritoEnAtlas := time.Now()
+
 	// Actualizar en MongoDB Local si está disponible
 	if collectionLocal != nil && clientLocal != nil {
 		maxRetries := 3
@@ -562,42 +944,124 @@ func actualizarUsuario(c *gin.Context) {
 				time.Sleep(time.Second * 2)
 			}
 
-			ctxLocal, cancelLocal := context.WithTimeout(context.Background(), 2*time.Second)
+			ctxLocal, cancelLocal := contextoSolicitud(c, 2*time.Second)
 			defer cancelLocal()
 
 			if err := clientLocal.Ping(ctxLocal, nil); err != nil {
-				log.Printf("ℹ️ Reintento %d: MongoDB Local no responde", i+1)
+				slog.InfoContext(c.Request.Context(), "MongoDB Local no responde", "intento", i+1)
 				continue
 			}
 
-			_, err = collectionLocal.UpdateOne(
-				ctx,
-				bson.M{"cedula": usuario.Cedula},
-				bson.M{"$set": bson.M{
-					"nombres":    usuario.Nombres,
-					"apellidos":  usuario.Apellidos,
-					"correo":     usuario.Correo,
-					"telefono":   usuario.Telefono,
-					"contrasena": usuario.Contrasena,
-					"foto":       usuario.Foto,
-				}},
-			)
+			if !fotoID.IsZero() {
+				err = fotosLocal.Eliminar(ctx, fotoID)
+				if err == nil {
+					err = fotosLocal.Guardar(ctx, fotoID, usuario.Foto)
+				}
+				if err != nil {
+					slog.WarnContext(c.Request.Context(), "No se pudo guardar la foto en MongoDB Local", "intento", i+1, "max_intentos", maxRetries, "error", err)
+					continue
+				}
+			}
+
+			_, err = collectionLocal.UpdateOne(ctx, filtroCedula(usuario.Cedula), cambios)
 			if err != nil {
-				log.Printf("⚠️ Advertencia: No se pudo actualizar en MongoDB Local (intento %d de %d): %v", i+1, maxRetries, err)
+				slog.WarnContext(c.Request.Context(), "No se pudo actualizar el usuario en MongoDB Local", "intento", i+1, "max_intentos", maxRetries, "error", err)
 			} else {
-				log.Println("✅ Usuario actualizado exitosamente en MongoDB Local")
+				if !fotoID.IsZero() && !usuarioExistente.FotoID.IsZero() {
+					_ = fotosLocal.Eliminar(ctx, usuarioExistente.FotoID)
+				}
+				slog.DebugContext(c.Request.Context(), "Usuario actualizado en MongoDB Local")
 				localSuccess = true
 				break
 			}
 		}
 
 		if !localSuccess {
-			log.Println("ℹ️ No se pudo actualizar en MongoDB Local después de varios intentos")
+			observarReplica("usuarios", escritoEnAtlas, errors.New("reintentos agotados"))
+			slog.InfoContext(c.Request.Context(), "No se pudo actualizar en MongoDB Local después de varios intentos")
+		} else {
+			observarReplica("usuarios", escritoEnAtlas, nil)
 		}
 	}
 
-	log.Println("✅ Usuario actualizado con éxito:", usuario.Cedula)
-	c.JSON(http.StatusOK, gin.H{"status": "success", "mensaje": "Usuario actualizado con éxito"})
+	// Con la contraseña nueva se cierran las sesiones abiertas con la anterior
+	if usuario.Contrasena != usuarioExistente.Contrasena {
+		if err := revocarSesiones(ctx, usuarioExistente.ID); err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudieron revocar las sesiones", "cedula", usuario.Cedula, "error", err)
+		}
+	}
+
+	if correoCambiado {
+		if err := enviarConfirmacion(ctx, c, usuarioExistente.ID, usuario.Correo); err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudo emitir el enlace de confirmación", "cedula", usuario.Cedula, "error", err)
+		}
+	}
+
+	despues := usuarioExistente
+	despues.Nombres, despues.Apellidos = usuario.Nombres, usuario.Apellidos
+	despues.Correo, despues.Telefono, despues.Contrasena = usuario.Correo, usuario.Telefono, usuario.Contrasena
+	if correoCambiado {
+		despues.Estado = estadoPendienteVerificacion
+	}
+	if !fotoID.IsZero() {
+		despues.Foto, despues.FotoID = "", fotoID
+	}
+	auditar(c, accionUsuarioActualizar, objetivo(objetivoUsuario, usuarioExistente.ID, usuario.Cedula), usuarioExistente, despues)
+
+	slog.InfoContext(c.Request.Context(), "Usuario actualizado", "cedula", usuario.Cedula)
+	responderOK(c, http.StatusOK, exitoUsuarioActualizado, nil)
+}
+
+// cedulaDeSolicitud toma la cédula de la ruta en /api/v1 o, en las rutas
+// antiguas, del cuerpo JSON decodificado en cuerpo. Si el cuerpo no es válido
+// responde 400, y si la cédula no es de quien llama, 403; en ambos casos
+// devuelve false.
+func cedulaDeSolicitud(c *gin.Context, cedula *string, cuerpo any) bool {
+	if p := c.Param("cedula"); p != "" {
+		*cedula = p
+		return true
+	}
+	if err := c.ShouldBindJSON(cuerpo); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return false
+	}
+	return autorizarCedula(c, *cedula)
+}
+
+// completarConActual rellena los campos vacíos de usuario con los guardados,
+// para que una actualización parcial pase la misma validación que una
+// completa. Si el usuario no existe responde 404 y devuelve false.
+func completarConActual(c *gin.Context, usuario *Usuario) bool {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	var actual Usuario
+	err := collection.FindOne(ctx, filtroCedula(usuario.Cedula)).Decode(&actual)
+	if err == nil {
+		err = descifrarUsuario(&actual)
+	}
+	if err == mongo.ErrNoDocuments {
+		responderError(c, http.StatusNotFound, codigoUsuarioNoEncontrado)
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error al buscar usuario", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return false
+	}
+
+	rellenar := func(campo *string, valor string) {
+		if *campo == "" {
+			*campo = valor
+		}
+	}
+	rellenar(&usuario.Nombres, actual.Nombres)
+	rellenar(&usuario.Apellidos, actual.Apellidos)
+	rellenar(&usuario.Correo, actual.Correo)
+	rellenar(&usuario.Telefono, actual.Telefono)
+	rellenar(&usuario.Contrasena, actual.Contrasena)
+	return true
 }
 
 func eliminarUsuario(c *gin.Context) {
@@ -605,61 +1069,52 @@ func eliminarUsuario(c *gin.Context) {
 		Cedula string `json:"cedula"`
 	}
 
-	if err := c.ShouldBindJSON(&datos); err != nil {
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "mensaje": "Cédula inválida"})
+	if !cedulaDeSolicitud(c, &datos.Cedula, &datos) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := contextoSolicitud(c, 15*time.Second)
 	defer cancel()
 
-	// Eliminar en MongoDB Atlas
-	resultado, err := collection.DeleteOne(ctx, bson.M{"cedula": datos.Cedula})
+	var usuario Usuario
+	err := collection.FindOne(ctx, filtroCedula(datos.Cedula)).Decode(&usuario)
 
-	if err != nil {
-		log.Println("❌ ERROR: No se pudo eliminar en MongoDB Atlas:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "mensaje": "Error al eliminar usuario"})
+	if err == mongo.ErrNoDocuments {
+		responderError(c, http.StatusNotFound, codigoUsuarioNoEncontrado)
 		return
 	}
 
-	if resultado.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "mensaje": "Usuario no encontrado"})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error al buscar usuario", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
 
-	// Eliminar en MongoDB Local si está disponible
-	if collectionLocal != nil && clientLocal != nil {
-		ctxLocal, cancelLocal := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancelLocal()
-
-		// Verificar la conexión local antes de intentar la operación
-		if err := clientLocal.Ping(ctxLocal, nil); err != nil {
-			log.Printf("ℹ️ MongoDB Local no disponible: %v", err)
-		} else {
-			_, err = collectionLocal.DeleteOne(ctxLocal, bson.M{"cedula": datos.Cedula})
-			if err != nil {
-				log.Printf("ℹ️ No se pudo eliminar en MongoDB Local: %v", err)
-			} else {
-				log.Println("✅ Usuario eliminado exitosamente en MongoDB Local")
-			}
-		}
+	// Eliminar el usuario junto con sus demás datos personales en ambas bases
+	if _, err := suprimirDatosPersonales(ctx, usuario, datos.Cedula); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo eliminar el usuario en MongoDB Atlas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
 	}
 
-	log.Println("✅ Usuario eliminado con éxito:", datos.Cedula)
-	c.JSON(http.StatusOK, gin.H{"status": "success", "mensaje": "Usuario eliminado con éxito"})
+	auditar(c, accionUsuarioEliminar, objetivo(objetivoUsuario, usuario.ID, datos.Cedula), nil, nil)
+	slog.InfoContext(c.Request.Context(), "Usuario eliminado", "cedula", datos.Cedula)
+	responderOK(c, http.StatusOK, exitoUsuarioEliminado, nil)
 }
 
-func compararImagenes(imgDB, imgCapturada string) bool {
-	url := "https://api-us.faceplusplus.com/facepp/v3/compare"
-	apiKey := "rTogCX8PP4oEPuGPnBDGP53P-t6FnAhS"
-	apiSecret := "UOXvVHFq4bxKeE7uEiknmGRIUJKLPxQl"
+func compararImagenes(ctx context.Context, imgDB, imgCapturada string) bool {
+	url := cfg.FacePP.URL
+	apiKey := cfg.FacePP.APIKey
+	apiSecret := cfg.FacePP.APISecret
 
 	if apiKey == "" || apiSecret == "" {
-		log.Println("❌ ERROR: API Key o Secret están vacíos")
+		slog.ErrorContext(ctx, "API Key o Secret de Face++ están vacíos")
 		return false
 	}
 
+	ctx, span := tracer.Start(ctx, "facepp.compare")
+	defer span.End()
+
 	var buf bytes.Buffer
 	writer := multipart.NewWriter(&buf)
 
@@ -669,170 +1124,220 @@ func compararImagenes(imgDB, imgCapturada string) bool {
 	_ = writer.WriteField("image_base64_2", imgCapturada)
 	writer.Close()
 
-	req, err := http.NewRequest("POST", url, &buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &buf)
 	if err != nil {
-		log.Println("❌ ERROR: No se pudo crear la solicitud:", err)
+		slog.ErrorContext(ctx, "No se pudo crear la solicitud a Face++", "error", err)
 		return false
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	client := &http.Client{}
+	inicio := time.Now()
+	resultado := "error"
+	defer func() {
+		metricaDuracionFacePP.WithLabelValues(resultado).Observe(time.Since(inicio).Seconds())
+		span.SetAttributes(attribute.String("facepp.resultado", resultado))
+		if resultado == "error" {
+			span.SetStatus(codes.Error, "Face++ no devolvió una comparación")
+		}
+	}()
+
+	client := &http.Client{
+		Timeout:   cfg.FacePP.Timeout.Duration(),
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("❌ ERROR: No se pudo conectar con Face++ API:", err)
+		slog.ErrorContext(ctx, "No se pudo conectar con Face++", "error", err)
 		return false
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
-	log.Println("📢 Respuesta de Face++ API:", string(body))
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(body, &result); err != nil {
-		log.Println("❌ ERROR: No se pudo analizar la respuesta JSON:", err)
+		slog.ErrorContext(ctx, "No se pudo analizar la respuesta de Face++", "error", err)
 		return false
 	}
 
 	if errorMsg, ok := result["error_message"]; ok {
-		log.Println("❌ ERROR en Face++ API:", errorMsg)
+		slog.ErrorContext(ctx, "Face++ devolvió un error", "error_message", errorMsg)
 		return false
 	}
 
 	if confidence, ok := result["confidence"].(float64); ok {
-		log.Printf("✅ Nivel de confianza: %.2f", confidence)
-		return confidence > 70.0
+		slog.DebugContext(ctx, "Nivel de confianza de Face++", "confianza", confidence, "request_id_facepp", result["request_id"], "time_used_ms", result["time_used"])
+		metricaConfianzaFacePP.Observe(confidence)
+		span.SetAttributes(attribute.Float64("facepp.confianza", confidence))
+		resultado = "no_match"
+		if confidence > cfg.FacePP.UmbralConfianza {
+			resultado = "match"
+		}
+		return confidence > cfg.FacePP.UmbralConfianza
 	}
 
-	log.Println("❌ ERROR: No se recibió confianza en la respuesta")
+	slog.ErrorContext(ctx, "Face++ no devolvió nivel de confianza")
 	return false
 }
 
+// verificarCorreo inicia el inicio de sesión por correo. Responde siempre lo
+// mismo, esté o no registrado el correo, con un reto opaco que se canjea en
+// verificarRostro; así la ruta no revela qué correos existen ni a qué cédula
+// pertenecen.
 func verificarCorreo(c *gin.Context) {
-	var datos struct {
-		Email string `json:"email"`
-	}
+	var datos solicitudVerificarCorreo
 
 	if err := c.ShouldBindJSON(&datos); err != nil {
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Datos inválidos"})
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
 		return
 	}
 
 	if datos.Email == "" {
-		log.Println("❌ ERROR: Email vacío")
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "El email no puede estar vacío"})
+		slog.WarnContext(c.Request.Context(), "Email vacío")
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
 		return
 	}
 
-	log.Printf("🔍 Verificando correo: %s", datos.Email)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	slog.DebugContext(c.Request.Context(), "Verificando correo", "correo", datos.Email)
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 	defer cancel()
 
+	if !limitarIdentificador(ctx, c, "correo", datos.Email) {
+		return
+	}
+
 	var usuario Usuario
-	filter := bson.M{"correo": datos.Email}
+	err := collection.FindOne(ctx, filtroCorreo(datos.Email)).Decode(&usuario)
+	if err != nil && err != mongo.ErrNoDocuments {
+		slog.ErrorContext(c.Request.Context(), "Error al buscar usuario en la base de datos", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
 
-	err := collection.FindOne(ctx, filter).Decode(&usuario)
+	// Con un correo desconocido usuario.ID queda vacío y el reto no sirve
+	reto, expira, err := emitirToken(ctx, retosCollection, usuario.ID, vigenciaReto, false)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("ℹ️ Usuario no encontrado para el correo: %s", datos.Email)
-			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "No se encontró ningún usuario con ese correo"})
-		} else {
-			log.Printf("❌ ERROR: Error al buscar usuario en la base de datos: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Error interno al buscar usuario"})
-		}
+		slog.ErrorContext(c.Request.Context(), "No se pudo emitir el reto de inicio de sesión", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
 
-	log.Printf("✅ Correo verificado exitosamente: %s", datos.Email)
-	c.JSON(http.StatusOK, gin.H{"success": true, "cedula": usuario.Cedula})
+	slog.InfoContext(c.Request.Context(), "Reto de inicio de sesión emitido", "correo", datos.Email, "registrado", !usuario.ID.IsZero())
+	camposLegado(c, gin.H{"reto": reto})
+	responderOK(c, http.StatusOK, exitoRetoEmitido, datosReto{Reto: reto, ExpiraEn: expira})
 }
 
+// verificarRostro canjea el reto de verificarCorreo y compara la foto con la
+// del usuario. Solo al acertar devuelve la cédula.
 func verificarRostro(c *gin.Context) {
-	var datos struct {
-		Cedula string `json:"cedula"`
-		Foto   string `json:"foto"`
-	}
+	var datos solicitudVerificarRostro
 
 	if err := c.ShouldBindJSON(&datos); err != nil {
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Datos inválidos"})
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
 		return
 	}
 
-	if datos.Cedula == "" || datos.Foto == "" {
-		log.Println("❌ ERROR: Cédula o foto vacía")
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "La cédula y la foto no pueden estar vacías"})
+	if datos.Reto == "" || (datos.Foto == "" && datos.Codigo == "") {
+		slog.WarnContext(c.Request.Context(), "Reto vacío o sin foto ni código")
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
 		return
 	}
 
-	log.Printf("🔍 Verificando rostro para cédula: %s", datos.Cedula)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 	defer cancel()
 
-	var usuario Usuario
-	filter := bson.M{"cedula": datos.Cedula}
+	usuarioID, err := canjearToken(ctx, retosCollection, datos.Reto)
+	if err != nil {
+		if errors.Is(err, errTokenInvalido) {
+			slog.WarnContext(c.Request.Context(), "Reto de inicio de sesión inválido")
+			responderError(c, http.StatusUnauthorized, codigoRetoInvalido)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al canjear el reto de inicio de sesión", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
 
-	err := collection.FindOne(ctx, filter).Decode(&usuario)
+	var usuario Usuario
+	err = collection.FindOne(ctx, bson.M{"_id": usuarioID}).Decode(&usuario)
+	if err == nil {
+		err = descifrarUsuario(&usuario)
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			log.Printf("ℹ️ Usuario no encontrado para la cédula: %s", datos.Cedula)
-			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "No se encontró ningún usuario con esa cédula"})
+			// El usuario se eliminó después de emitir el reto
+			slog.InfoContext(c.Request.Context(), "Usuario del reto no encontrado")
+			responderError(c, http.StatusUnauthorized, codigoRetoInvalido)
 		} else {
-			log.Printf("❌ ERROR: Error al buscar usuario en la base de datos: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Error interno al buscar usuario"})
+			slog.ErrorContext(c.Request.Context(), "Error al buscar usuario en la base de datos", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		}
 		return
 	}
 
-	if !compararImagenes(usuario.Foto, datos.Foto) {
-		log.Printf("❌ ERROR: Verificación facial fallida para cédula %s", datos.Cedula)
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Verificación facial fallida"})
+	slog.DebugContext(c.Request.Context(), "Verificando rostro", "cedula", usuario.Cedula)
+	if !limitarIdentificador(ctx, c, "cedula", usuario.Cedula) || cuentaBloqueada(ctx, c, usuario.Cedula) {
+		return
+	}
+
+	if !verificarSegundoFactor(ctx, c, usuario, datos.Foto, datos.Codigo) {
+		registrarInicioFallido(c, ctx, usuario, metodoCorreo, motivoSegundoFactor)
 		return
 	}
+	reiniciarFallos(ctx, c, usuario.Cedula)
 
-	log.Printf("✅ Verificación facial exitosa para cédula %s", datos.Cedula)
-	c.JSON(http.StatusOK, gin.H{"success": true, "mensaje": "Verificación facial exitosa"})
+	sesion, ok := abrirSesion(c, ctx, usuario, metodoCorreo)
+	if !ok {
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Segundo factor verificado", "cedula", usuario.Cedula)
+	camposLegado(c, gin.H{"cedula": usuario.Cedula})
+	responderOK(c, http.StatusOK, exitoVerificacionFacial, sesion)
 }
 
+// actualizarUltimaSesion fija la última sesión del usuario con la hora del
+// servidor. Los inicios de sesión ya la fijan; la ruta queda para los
+// clientes que la siguen llamando, y la fecha que envíen se ignora.
 func actualizarUltimaSesion(c *gin.Context) {
 	var datos struct {
-		Cedula       string `json:"cedula"`
-		UltimaSesion string `json:"ultimaSesion"`
+		Cedula string `json:"cedula"`
 	}
 
-	if err := c.ShouldBindJSON(&datos); err != nil {
-		log.Println("❌ ERROR: Datos JSON inválidos:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Datos inválidos"})
+	if !cedulaDeSolicitud(c, &datos.Cedula, &datos) {
 		return
 	}
-
-	if datos.Cedula == "" || datos.UltimaSesion == "" {
-		log.Println("❌ ERROR: Cédula o fecha de última sesión vacía")
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "La cédula y la fecha de última sesión no pueden estar vacías"})
+	if datos.Cedula == "" {
+		slog.WarnContext(c.Request.Context(), "Cédula vacía")
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
 		return
 	}
+	ultimaSesion := time.Now().Format(time.RFC3339)
 
-	log.Printf("🔄 Actualizando última sesión para cédula: %s", datos.Cedula)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	slog.DebugContext(c.Request.Context(), "Actualizando última sesión", "cedula", datos.Cedula)
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
 	defer cancel()
 
 	// Actualizar en MongoDB Atlas
 	resultado, err := collection.UpdateOne(
 		ctx,
-		bson.M{"cedula": datos.Cedula},
-		bson.M{"$set": bson.M{"ultimaSesion": datos.UltimaSesion}},
+		filtroCedula(datos.Cedula),
+		bson.M{"$set": bson.M{"ultimaSesion": ultimaSesion}},
 	)
 
 	if err != nil {
-		log.Println("❌ ERROR: No se pudo actualizar en MongoDB Atlas:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Error al actualizar última sesión"})
+		slog.ErrorContext(c.Request.Context(), "No se pudo actualizar la última sesión en MongoDB Atlas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
 		return
 	}
 
 	if resultado.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Usuario no encontrado"})
+		responderError(c, http.StatusNotFound, codigoUsuarioNoEncontrado)
 		return
 	}
+	escritoEnAtlas := time.Now()
 
 	// Actualizar en MongoDB Local si está disponible
 	if collectionLocal != nil {
@@ -846,25 +1351,34 @@ func actualizarUltimaSesion(c *gin.Context) {
 
 			// Verificar la conexión antes de intentar la operación
 			if err := clientLocal.Ping(ctx, nil); err != nil {
-				log.Printf("ℹ️ Reintento %d: MongoDB Local no responde", i+1)
+				slog.InfoContext(c.Request.Context(), "MongoDB Local no responde", "intento", i+1)
 				continue
 			}
 
 			_, err = collectionLocal.UpdateOne(
 				ctx,
-				bson.M{"cedula": datos.Cedula},
-				bson.M{"$set": bson.M{"ultimaSesion": datos.UltimaSesion}},
+				filtroCedula(datos.Cedula),
+				bson.M{"$set": bson.M{"ultimaSesion": ultimaSesion}},
 			)
 			if err != nil {
-				log.Printf("⚠️ Advertencia: No se pudo actualizar en MongoDB Local (intento %d de %d): %v", i+1, maxRetries, err)
+				slog.WarnContext(c.Request.Context(), "No se pudo actualizar la última sesión en MongoDB Local", "intento", i+1, "max_intentos", maxRetries, "error", err)
 				time.Sleep(time.Second * 2) // Esperar antes de reintentar
 			} else {
-				log.Println("✅ Última sesión actualizada exitosamente en MongoDB Local")
+				slog.DebugContext(c.Request.Context(), "Última sesión actualizada en MongoDB Local")
+				localSuccess = true
 				break
 			}
 		}
+
+		if localSuccess {
+			observarReplica("usuarios", escritoEnAtlas, nil)
+		} else {
+			observarReplica("usuarios", escritoEnAtlas, errors.New("reintentos agotados"))
+		}
 	}
 
-	log.Printf("✅ Última sesión actualizada con éxito para cédula %s", datos.Cedula)
-	c.JSON(http.StatusOK, gin.H{"success": true, "mensaje": "Última sesión actualizada con éxito"})
+	auditar(c, accionUltimaSesion, objetivo(objetivoUsuario, primitive.NilObjectID, datos.Cedula), nil, bson.M{"ultimaSesion": ultimaSesion})
+
+	slog.InfoContext(c.Request.Context(), "Última sesión actualizada", "cedula", datos.Cedula)
+	responderOK(c, http.StatusOK, exitoUltimaSesionActualizada, nil)
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tunombre/qrtixpro-backend/mensajes"
+)
+
+// Códigos de error estables de la API. El frontend y los integradores deben
+// decidir con el código, nunca con el mensaje, que puede cambiar.
+const (
+	codigoDatosInvalidos            = "DATOS_INVALIDOS"
+	codigoValidacionFallida         = "VALIDACION_FALLIDA"
+	codigoCamposObligatorios        = "CAMPOS_OBLIGATORIOS"
+	codigoCedulaDuplicada           = "CEDULA_DUPLICADA"
+	codigoCorreoDuplicado           = "CORREO_DUPLICADO"
+	codigoUsuarioNoEncontrado       = "USUARIO_NO_ENCONTRADO"
+	codigoCredencialesInvalidas     = "CREDENCIALES_INVALIDAS"
+	codigoAutenticacionRequerida    = "AUTENTICACION_REQUERIDA"
+	codigoVerificacionFacialFallida = "VERIFICACION_FACIAL_FALLIDA"
+	codigoFotoNoDisponible          = "FOTO_NO_DISPONIBLE"
+	codigoTamanoInvalido            = "TAMANO_INVALIDO"
+	codigoTiempoAgotado             = "TIEMPO_AGOTADO"
+	codigoLimiteExcedido            = "LIMITE_EXCEDIDO"
+	codigoCuentaBloqueada           = "CUENTA_BLOQUEADA"
+	codigoRetoInvalido              = "RETO_INVALIDO"
+	codigoTokenInvalido             = "TOKEN_INVALIDO"
+	codigoCorreoNoVerificado        = "CORREO_NO_VERIFICADO"
+	codigoCodigoRequerido           = "CODIGO_REQUERIDO"
+	codigoCodigoInvalido            = "CODIGO_INVALIDO"
+	codigoTOTPYaActivo              = "TOTP_YA_ACTIVO"
+	codigoTOTPSinInscripcion        = "TOTP_SIN_INSCRIPCION"
+	codigoPasskeyInvalida           = "PASSKEY_INVALIDA"
+	codigoPasskeyNoEncontrada       = "PASSKEY_NO_ENCONTRADA"
+	codigoLimitePasskeys            = "LIMITE_PASSKEYS"
+	codigoTokenGoogleInvalido       = "TOKEN_GOOGLE_INVALIDO"
+	codigoCorreoGoogleNoVerificado  = "CORREO_GOOGLE_NO_VERIFICADO"
+	codigoGoogleYaVinculada         = "GOOGLE_YA_VINCULADA"
+	codigoPermisoDenegado           = "PERMISO_DENEGADO"
+	codigoVentaNoEncontrada         = "VENTA_NO_ENCONTRADA"
+	codigoBoletaInvalida            = "BOLETA_INVALIDA"
+	codigoBoletaYaUsada             = "BOLETA_YA_USADA"
+	codigoOrganizadorNoEncontrado   = "ORGANIZADOR_NO_ENCONTRADO"
+	codigoEventoNoEncontrado        = "EVENTO_NO_ENCONTRADO"
+	codigoSesionInvalida            = "SESION_INVALIDA"
+	codigoSesionNoEncontrada        = "SESION_NO_ENCONTRADA"
+	codigoSegundoFactorRequerido    = "SEGUNDO_FACTOR_REQUERIDO"
+	codigoPerfilCompleto            = "PERFIL_COMPLETO"
+	codigoServicioNoDisponible      = "SERVICIO_NO_DISPONIBLE"
+	codigoRutaNoEncontrada          = "RUTA_NO_ENCONTRADA"
+	codigoMetodoNoPermitido         = "METODO_NO_PERMITIDO"
+	codigoErrorInterno              = "ERROR_INTERNO"
+)
+
+// codigosDeError lista los códigos de error para el esquema Error de OpenAPI. Al
+// agregar un código hay que sumarlo aquí y traducirlo en el paquete mensajes.
+func codigosDeError() []string {
+	return []string{
+		codigoDatosInvalidos, codigoValidacionFallida, codigoCamposObligatorios,
+		codigoTamanoInvalido, codigoCedulaDuplicada, codigoCorreoDuplicado,
+		codigoUsuarioNoEncontrado, codigoCredencialesInvalidas, codigoAutenticacionRequerida,
+		codigoVerificacionFacialFallida, codigoFotoNoDisponible, codigoTiempoAgotado,
+		codigoLimiteExcedido, codigoCuentaBloqueada, codigoRetoInvalido,
+		codigoTokenInvalido, codigoCorreoNoVerificado, codigoCodigoRequerido,
+		codigoCodigoInvalido, codigoTOTPYaActivo, codigoTOTPSinInscripcion,
+		codigoPasskeyInvalida, codigoPasskeyNoEncontrada, codigoLimitePasskeys,
+		codigoTokenGoogleInvalido, codigoCorreoGoogleNoVerificado, codigoGoogleYaVinculada,
+		codigoPermisoDenegado, codigoVentaNoEncontrada, codigoBoletaInvalida,
+		codigoBoletaYaUsada, codigoOrganizadorNoEncontrado, codigoEventoNoEncontrado,
+		codigoSesionInvalida, codigoSesionNoEncontrada, codigoSegundoFactorRequerido, codigoPerfilCompleto,
+		codigoServicioNoDisponible, codigoRutaNoEncontrada, codigoMetodoNoPermitido,
+		codigoErrorInterno,
+	}
+}
+
+// Claves de los mensajes de éxito en el catálogo de mensajes.
+const (
+	exitoVentaRegistrada            = "VENTA_REGISTRADA"
+	exitoUsuarioRegistrado          = "USUARIO_REGISTRADO"
+	exitoUsuarioActualizado         = "USUARIO_ACTUALIZADO"
+	exitoUsuarioEliminado           = "USUARIO_ELIMINADO"
+	exitoInicioSesion               = "INICIO_SESION_EXITOSO"
+	exitoVerificacionFacial         = "VERIFICACION_FACIAL_EXITOSA"
+	exitoRetoEmitido                = "RETO_EMITIDO"
+	exitoRestablecimientoSolicitado = "RESTABLECIMIENTO_SOLICITADO"
+	exitoContrasenaRestablecida     = "CONTRASENA_RESTABLECIDA"
+	exitoCorreoConfirmado           = "CORREO_CONFIRMADO"
+	exitoConfirmacionReenviada      = "CONFIRMACION_REENVIADA"
+	exitoTOTPActivado               = "TOTP_ACTIVADO"
+	exitoTOTPDesactivado            = "TOTP_DESACTIVADO"
+	exitoPasskeyRegistrada          = "PASSKEY_REGISTRADA"
+	exitoPasskeyEliminada           = "PASSKEY_ELIMINADA"
+	exitoCuentaGoogleCreada         = "CUENTA_GOOGLE_CREADA"
+	exitoPerfilCompletado           = "PERFIL_COMPLETADO"
+	exitoRolesActualizados          = "ROLES_ACTUALIZADOS"
+	exitoIngresoRegistrado          = "INGRESO_REGISTRADO"
+	exitoOrganizadorCreado          = "ORGANIZADOR_CREADO"
+	exitoOrganizadorActualizado     = "ORGANIZADOR_ACTUALIZADO"
+	exitoEventoCreado               = "EVENTO_CREADO"
+	exitoEventoActualizado          = "EVENTO_ACTUALIZADO"
+	exitoSesionRevocada             = "SESION_REVOCADA"
+	exitoUltimaSesionActualizada    = "ULTIMA_SESION_ACTUALIZADA"
+	exitoDatosSuprimidos            = "DATOS_SUPRIMIDOS"
+)
+
+// respuesta es el sobre común de todas las respuestas JSON de la API.
+//
+//	{"ok": true, "mensaje": "...", "data": {...}, "request_id": "..."}
+//	{"ok": false, "codigo": "CEDULA_DUPLICADA", "mensaje": "...", "errores": {"cedula": "..."}, "request_id": "..."}
+type respuesta struct {
+	OK        bool              `json:"ok"`
+	Codigo    string            `json:"codigo,omitempty"`
+	Mensaje   string            `json:"mensaje,omitempty"`
+	Errores   map[string]string `json:"errores,omitempty"`
+	Data      any               `json:"data,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+const (
+	claveSobreLegado  = "sobre_legado"
+	claveCamposLegado = "campos_legado"
+	claveIdioma       = "idioma"
+)
+
+// responderOK responde con éxito. clave es la del mensaje en el catálogo y
+// puede ir vacía, igual que data.
+func responderOK(c *gin.Context, estado int, clave string, data any) {
+	r := respuesta{OK: true, Data: data}
+	if clave != "" {
+		r.Mensaje = texto(c, clave)
+	}
+	responder(c, estado, r)
+}
+
+// responderError responde con un error identificado por codigo y el mensaje
+// de ese código en el idioma del cliente.
+func responderError(c *gin.Context, estado int, codigo string) {
+	responder(c, estado, respuesta{Codigo: codigo, Mensaje: texto(c, codigo)})
+}
+
+// responderValidacion responde 400 con los errores de cada campo. errores
+// lleva, por campo, la clave del mensaje en el catálogo.
+func responderValidacion(c *gin.Context, errores map[string]string) {
+	traducidos := make(map[string]string, len(errores))
+	for campo, clave := range errores {
+		traducidos[campo] = texto(c, clave)
+	}
+	responder(c, http.StatusBadRequest, respuesta{
+		Codigo:  codigoValidacionFallida,
+		Mensaje: texto(c, codigoValidacionFallida),
+		Errores: traducidos,
+	})
+}
+
+// idioma resuelve una sola vez por solicitud el idioma de Accept-Language.
+func idioma(c *gin.Context) string {
+	if i := c.GetString(claveIdioma); i != "" {
+		return i
+	}
+	i := mensajes.Resolver(c.GetHeader("Accept-Language"))
+	c.Set(claveIdioma, i)
+	return i
+}
+
+func texto(c *gin.Context, clave string) string {
+	return mensajes.Texto(idioma(c), clave)
+}
+
+func responder(c *gin.Context, estado int, r respuesta) {
+	r.RequestID = idSolicitud(c.Request.Context())
+	c.Header("Content-Language", idioma(c))
+	c.Header("Vary", "Accept-Language")
+	if !c.GetBool(claveSobreLegado) {
+		c.AbortWithStatusJSON(estado, r)
+		return
+	}
+	c.AbortWithStatusJSON(estado, sobreLegado(c, r))
+}
+
+// compatibilidadLegado marca las rutas que usan las pantallas actuales de
+// React. Sus respuestas llevan, además del sobre nuevo, los campos que esas
+// pantallas leen: "status" y "success", y "error" como texto.
+func compatibilidadLegado(c *gin.Context) {
+	c.Set(claveSobreLegado, true)
+	c.Next()
+}
+
+// camposLegado agrega campos sueltos que una ruta antigua devolvía en la raíz
+// de la respuesta. Solo se envían por las rutas con compatibilidadLegado.
+func camposLegado(c *gin.Context, campos gin.H) {
+	c.Set(claveCamposLegado, campos)
+}
+
+func sobreLegado(c *gin.Context, r respuesta) gin.H {
+	var h gin.H
+	b, _ := json.Marshal(r)
+	_ = json.Unmarshal(b, &h)
+
+	if r.OK {
+		h["status"] = "success"
+		h["success"] = true
+	} else {
+		h["status"] = "error"
+		h["success"] = false
+		h["error"] = r.Mensaje
+	}
+	if extra, ok := c.Get(claveCamposLegado); ok {
+		for k, v := range extra.(gin.H) {
+			if _, existe := h[k]; !existe {
+				h[k] = v
+			}
+		}
+	}
+	return h
+}
+
+// rutaNoEncontrada y metodoNoPermitido responden con el sobre común en lugar
+// del texto plano de Gin.
+func rutaNoEncontrada(c *gin.Context) {
+	responderError(c, http.StatusNotFound, codigoRutaNoEncontrada)
+}
+
+func metodoNoPermitido(c *gin.Context) {
+	responderError(c, http.StatusMethodNotAllowed, codigoMetodoNoPermitido)
+}
+
+// recuperarPanico responde 500 con el sobre común cuando un handler entra en pánico.
+func recuperarPanico(c *gin.Context, _ any) {
+	responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+}
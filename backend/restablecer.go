@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/tunombre/qrtixpro-backend/correo"
+	"github.com/tunombre/qrtixpro-backend/mensajes"
+)
+
+// solicitudOlvidoContrasena es el cuerpo de POST /api/v1/password/olvido.
+type solicitudOlvidoContrasena struct {
+	Correo string `json:"correo"`
+}
+
+// solicitudRestablecerContrasena es el cuerpo de POST /api/v1/password/restablecer.
+type solicitudRestablecerContrasena struct {
+	Token      string `json:"token"`
+	Contrasena string `json:"contrasena"`
+}
+
+// olvidoContrasena envía al correo del usuario un enlace para restablecer la
+// contraseña. Responde lo mismo exista o no el correo, y el envío ocurre en
+// segundo plano para que el tiempo de respuesta tampoco lo delate.
+func olvidoContrasena(c *gin.Context) {
+	var datos solicitudOlvidoContrasena
+
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	if datos.Correo == "" {
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	if !limitarIdentificador(ctx, c, "correo", datos.Correo) {
+		return
+	}
+
+	var usuario Usuario
+	err := collection.FindOne(ctx, filtroCorreo(datos.Correo)).Decode(&usuario)
+	if err == nil {
+		err = descifrarUsuario(&usuario)
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		slog.ErrorContext(c.Request.Context(), "Error al buscar usuario en la base de datos", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	token, _, err := emitirToken(ctx, restablecimientosCollection, usuario.ID, cfg.Correo.VigenciaRestablecer.Duration(), true)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo emitir el token de restablecimiento", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	if !usuario.ID.IsZero() {
+		enviarCorreo(c.Request.Context(), correoRestablecimiento(idioma(c), usuario.Correo, token))
+	}
+	slog.InfoContext(c.Request.Context(), "Restablecimiento de contraseña solicitado", "correo", datos.Correo, "registrado", !usuario.ID.IsZero())
+	responderOK(c, http.StatusOK, exitoRestablecimientoSolicitado, nil)
+}
+
+// correoRestablecimiento arma el correo con el enlace al frontend.
+func correoRestablecimiento(idioma, para, token string) correo.Mensaje {
+	minutos := int(cfg.Correo.VigenciaRestablecer.Duration().Minutes())
+	return correo.Mensaje{
+		Para:   para,
+		Asunto: mensajes.Texto(idioma, "correo.restablecer.asunto"),
+		Texto:  fmt.Sprintf(mensajes.Texto(idioma, "correo.restablecer.texto"), enlaceConToken(cfg.Correo.URLRestablecer, token), minutos),
+	}
+}
+
+// restablecerContrasena canjea el token del correo y fija la contraseña
+// nueva, que debe cumplir las mismas reglas que en el registro. Después
+// revoca las sesiones abiertas del usuario.
+func restablecerContrasena(c *gin.Context) {
+	var datos solicitudRestablecerContrasena
+
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	if datos.Token == "" {
+		responderError(c, http.StatusBadRequest, codigoCamposObligatorios)
+		return
+	}
+	// Se valida antes de canjear para no gastar el token en una contraseña rechazada
+	if clave := validarContrasena(datos.Contrasena); clave != "" {
+		responderValidacion(c, map[string]string{"contrasena": clave})
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuarioID, err := canjearToken(ctx, restablecimientosCollection, datos.Token)
+	if err != nil {
+		if errors.Is(err, errTokenInvalido) {
+			slog.WarnContext(c.Request.Context(), "Token de restablecimiento inválido")
+			responderError(c, http.StatusBadRequest, codigoTokenInvalido)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Error al canjear el token de restablecimiento", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+
+	var usuario Usuario
+	err = collection.FindOneAndUpdate(ctx, bson.M{"_id": usuarioID},
+		bson.M{"$set": bson.M{"contrasena": datos.Contrasena}}).Decode(&usuario)
+	if err == nil {
+		err = descifrarUsuario(&usuario)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			responderError(c, http.StatusBadRequest, codigoTokenInvalido)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "No se pudo cambiar la contraseña en MongoDB Atlas", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+	escritoEnAtlas := time.Now()
+
+	// La réplica local tiene otro _id, así que se busca por cédula
+	if collectionLocal != nil && clientLocal != nil {
+		ctxLocal, cancelLocal := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+		defer cancelLocal()
+
+		_, err = collectionLocal.UpdateOne(ctxLocal, filtroCedula(usuario.Cedula),
+			bson.M{"$set": bson.M{"contrasena": datos.Contrasena}})
+		observarReplica("usuarios", escritoEnAtlas, err)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "No se pudo cambiar la contraseña en MongoDB Local", "error", err)
+		}
+	}
+
+	if err := revocarSesiones(ctx, usuarioID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron revocar las sesiones", "cedula", usuario.Cedula, "error", err)
+	}
+	reiniciarFallos(ctx, c, usuario.Cedula)
+
+	auditar(c, accionContrasenaRestablecer, objetivo(objetivoUsuario, usuarioID, usuario.Cedula),
+		bson.M{"contrasena": usuario.Contrasena}, bson.M{"contrasena": datos.Contrasena})
+
+	slog.InfoContext(c.Request.Context(), "Contraseña restablecida", "cedula", usuario.Cedula)
+	responderOK(c, http.StatusOK, exitoContrasenaRestablecida, nil)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/tunombre/qrtixpro-backend/config"
+)
+
+// politicaRetencion fija cuánto tiempo se conservan los documentos de una
+// colección. Sin Filtro se aplica con un índice TTL sobre CampoFecha; con
+// Filtro la aplica periódicamente limpiarRetencion, porque el borrado depende
+// del estado del documento.
+type politicaRetencion struct {
+	Nombre     string
+	Coleccion  string
+	CampoFecha string
+	Duracion   time.Duration
+	Filtro     bson.M
+	// Vigencia es cuánto vale lo que guarda la colección, contado desde
+	// CampoFecha. La retención no puede ser menor: el índice TTL borraría
+	// enlaces o desafíos aún vigentes.
+	Vigencia func(c *config.Config) time.Duration
+}
+
+// politicasRetencion son las políticas por defecto. Cada duración se puede
+// cambiar en retencion.politicas de la configuración o con la variable
+// RETENCION, por ejemplo "logs=180d,retos_login=30m".
+//
+// reservas y ventas_pendientes aún no borran nada: ninguna ruta crea
+// reservas ni ventas sin pagar. Quedan para cuando el pago las cree.
+var politicasRetencion = []politicaRetencion{
+	{Nombre: "logs", Coleccion: "logs", CampoFecha: "fecha_hora", Duracion: 365 * 24 * time.Hour},
+	{Nombre: "reservas", Coleccion: "reservas", CampoFecha: "expira_en", Duracion: 24 * time.Hour},
+	{
+		Nombre: "retos_login", Coleccion: "retos_login", CampoFecha: "creado_en", Duracion: time.Hour,
+		Vigencia: func(*config.Config) time.Duration { return vigenciaReto },
+	},
+	{
+		Nombre: "restablecimientos", Coleccion: "restablecimientos", CampoFecha: "creado_en", Duracion: 24 * time.Hour,
+		Vigencia: func(c *config.Config) time.Duration { return c.Correo.VigenciaRestablecer.Duration() },
+	},
+	{
+		Nombre: "confirmaciones_correo", Coleccion: "confirmaciones_correo", CampoFecha: "creado_en", Duracion: 7 * 24 * time.Hour,
+		Vigencia: func(c *config.Config) time.Duration { return c.Correo.VigenciaConfirmacion.Duration() },
+	},
+	{
+		Nombre: "ceremonias_webauthn", Coleccion: "ceremonias_webauthn", CampoFecha: "creado_en", Duracion: time.Hour,
+		Vigencia: func(c *config.Config) time.Duration { return c.WebAuthn.VigenciaCeremonia.Duration() },
+	},
+	{Nombre: "sesiones", Coleccion: "sesiones", CampoFecha: "expira_en", Duracion: 24 * time.Hour},
+	{Nombre: "ventas_pendientes", Coleccion: "ventas", CampoFecha: "fecha", Duracion: 48 * time.Hour, Filtro: bson.M{"estado": "pendiente"}},
+}
+
+// cargarRetencion aplica a las políticas por defecto las duraciones
+// configuradas. Las que no se configuran y guardan algo con vigencia se
+// alargan hasta ella; una configurada por debajo de la vigencia es un error.
+func cargarRetencion(c *config.Config) ([]politicaRetencion, error) {
+	politicas := make([]politicaRetencion, len(politicasRetencion))
+	copy(politicas, politicasRetencion)
+
+	for nombre := range c.Retencion.Politicas {
+		if !slices.ContainsFunc(politicas, func(p politicaRetencion) bool { return p.Nombre == nombre }) {
+			return nil, fmt.Errorf("política de retención desconocida %q", nombre)
+		}
+	}
+
+	for i := range politicas {
+		p := &politicas[i]
+		duracion, configurada := c.Retencion.Politicas[p.Nombre]
+		if configurada {
+			p.Duracion = duracion.Duration()
+		}
+		if p.Vigencia == nil {
+			continue
+		}
+		if vigencia := p.Vigencia(c); p.Duracion < vigencia {
+			if configurada {
+				return nil, fmt.Errorf("la retención de %s (%v) es menor que la vigencia de lo que guarda (%v)", p.Nombre, p.Duracion, vigencia)
+			}
+			p.Duracion = vigencia
+		}
+	}
+	return politicas, nil
+}
+
+// iniciarRetencion crea o ajusta los índices TTL en ambas bases y lanza la
+// limpieza periódica de las políticas condicionales hasta que ctx termine.
+func iniciarRetencion(ctx context.Context) {
+	politicas, err := cargarRetencion(cfg)
+	if err != nil {
+		log.Fatal("❌ ERROR: Retención inválida: ", err)
+	}
+	intervalo := cfg.Retencion.Intervalo.Duration()
+
+	ctxIndices, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	for _, b := range basesConectadas() {
+		for _, p := range politicas {
+			if p.Filtro != nil {
+				continue
+			}
+			if err := asegurarIndiceTTL(ctxIndices, b.db.Collection(p.Coleccion), p); err != nil {
+				slog.Warn("No se pudo aplicar la retención", "base", b.nombre, "politica", p.Nombre, "error", err)
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+		for {
+			limpiarRetencion(ctx, politicas)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// asegurarIndiceTTL crea el índice TTL de la política o, si ya existe con otra
+// duración, la actualiza con collMod.
+func asegurarIndiceTTL(ctx context.Context, coleccion *mongo.Collection, p politicaRetencion) error {
+	segundos := int32(p.Duracion / time.Second)
+
+	cursor, err := coleccion.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var indices []struct {
+		Nombre   string `bson:"name"`
+		Claves   bson.D `bson:"key"`
+		Segundos *int32 `bson:"expireAfterSeconds"`
+	}
+	if err := cursor.All(ctx, &indices); err != nil {
+		return err
+	}
+
+	for _, idx := range indices {
+		if len(idx.Claves) != 1 || idx.Claves[0].Key != p.CampoFecha {
+			continue
+		}
+		if idx.Segundos == nil {
+			return fmt.Errorf("ya existe el índice %s sobre %s sin TTL", idx.Nombre, p.CampoFecha)
+		}
+		if *idx.Segundos == segundos {
+			return nil
+		}
+		return coleccion.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: coleccion.Name()},
+			{Key: "index", Value: bson.M{"name": idx.Nombre, "expireAfterSeconds": segundos}},
+		}).Err()
+	}
+
+	_, err = coleccion.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: p.CampoFecha, Value: 1}},
+		Options: options.Index().SetName("ttl_" + p.CampoFecha).SetExpireAfterSeconds(segundos),
+	})
+	return err
+}
+
+// limpiarRetencion borra en ambas bases los documentos vencidos de las políticas condicionales.
+func limpiarRetencion(ctx context.Context, politicas []politicaRetencion) {
+	for _, p := range politicas {
+		if p.Filtro == nil {
+			continue
+		}
+
+		filtro := bson.M{p.CampoFecha: bson.M{"$lt": time.Now().Add(-p.Duracion)}}
+		for campo, valor := range p.Filtro {
+			filtro[campo] = valor
+		}
+
+		for _, b := range basesConectadas() {
+			ctxOp, cancel := context.WithTimeout(ctx, time.Minute)
+			res, err := b.db.Collection(p.Coleccion).DeleteMany(ctxOp, filtro)
+			cancel()
+			if err != nil {
+				slog.Warn("No se pudo limpiar la retención", "base", b.nombre, "politica", p.Nombre, "error", err)
+				continue
+			}
+			if res.DeletedCount > 0 {
+				slog.Info("Documentos eliminados por la retención", "base", b.nombre, "politica", p.Nombre, "eliminados", res.DeletedCount)
+			}
+		}
+	}
+}
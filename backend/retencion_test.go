@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tunombre/qrtixpro-backend/config"
+)
+
+func duracionPolitica(t *testing.T, politicas []politicaRetencion, nombre string) time.Duration {
+	t.Helper()
+	for _, p := range politicas {
+		if p.Nombre == nombre {
+			return p.Duracion
+		}
+	}
+	t.Fatalf("no existe la política %s", nombre)
+	return 0
+}
+
+func TestRetencionNoBorraEnlacesVigentes(t *testing.T) {
+	c := config.PorDefecto()
+	politicas, err := cargarRetencion(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := duracionPolitica(t, politicas, "confirmaciones_correo"); got != 7*24*time.Hour {
+		t.Errorf("confirmaciones_correo = %v, se esperaba el valor por defecto", got)
+	}
+
+	// Sin retención configurada se alarga hasta la vigencia
+	c.Correo.VigenciaConfirmacion = config.Duracion(10 * 24 * time.Hour)
+	c.WebAuthn.VigenciaCeremonia = config.Duracion(2 * time.Hour)
+	politicas, err = cargarRetencion(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := duracionPolitica(t, politicas, "confirmaciones_correo"); got != 10*24*time.Hour {
+		t.Errorf("confirmaciones_correo = %v, se esperaba 240h", got)
+	}
+	if got := duracionPolitica(t, politicas, "ceremonias_webauthn"); got != 2*time.Hour {
+		t.Errorf("ceremonias_webauthn = %v, se esperaba 2h", got)
+	}
+
+	// Configurada por debajo de la vigencia es un error
+	c.Retencion.Politicas = map[string]config.Duracion{"confirmaciones_correo": config.Duracion(7 * 24 * time.Hour)}
+	if _, err := cargarRetencion(&c); err == nil {
+		t.Error("se aceptó una retención menor que la vigencia de las confirmaciones")
+	}
+	c.Retencion.Politicas = map[string]config.Duracion{"confirmaciones_correo": config.Duracion(30 * 24 * time.Hour), "logs": config.Duracion(180 * 24 * time.Hour)}
+	politicas, err = cargarRetencion(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := duracionPolitica(t, politicas, "logs"); got != 180*24*time.Hour {
+		t.Errorf("logs = %v, se esperaba 4320h", got)
+	}
+
+	c.Retencion.Politicas = map[string]config.Duracion{"desconocida": config.Duracion(time.Hour)}
+	if _, err := cargarRetencion(&c); err == nil {
+		t.Error("se aceptó una política desconocida")
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// vigenciaReto es cuánto tiempo se puede canjear un reto de inicio de sesión.
+const vigenciaReto = 5 * time.Minute
+
+// datosReto es la respuesta de verificarCorreo.
+type datosReto struct {
+	Reto     string    `json:"reto"`
+	ExpiraEn time.Time `json:"expira_en"`
+}
+
+// revocarSesiones anula todo lo que permite al usuario entrar sin volver a
+// presentar sus credenciales: las sesiones abiertas y los retos de inicio de
+// sesión sin canjear. Como las rutas autenticadas solo aceptan sesiones, no
+// queda ninguna credencial vigente.
+func revocarSesiones(ctx context.Context, usuarioID primitive.ObjectID) error {
+	if _, err := sesionesCollection.DeleteMany(ctx, bson.M{"usuario_id": usuarioID}); err != nil {
+		return err
+	}
+	_, err := retosCollection.DeleteMany(ctx, bson.M{"usuario_id": usuarioID})
+	return err
+}
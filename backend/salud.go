@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apagando se activa al recibir la señal de apagado para que /readyz saque
+// la instancia del balanceador mientras terminan las solicitudes en curso.
+var apagando atomic.Bool
+
+// Estados de un componente en /readyz.
+const (
+	estadoOK            = "ok"
+	estadoCaido         = "caido"
+	estadoNoConfigurado = "no_configurado"
+)
+
+// estadoFacePP guarda el último chequeo de Face++ para no consultarlo en cada
+// sondeo de readiness.
+var estadoFacePP struct {
+	sync.Mutex
+	estado     string
+	detalle    string
+	revisadoEn time.Time
+}
+
+// healthz indica que el proceso está vivo. No revisa dependencias.
+func healthz(c *gin.Context) {
+	responderOK(c, http.StatusOK, "", gin.H{"status": "ok"})
+}
+
+// readyz informa por separado el estado de MongoDB Atlas, MongoDB Local y
+// Face++. Solo MongoDB Atlas es indispensable: si falla, o si la instancia se
+// está apagando, responde 503. Los demás componentes solo degradan el servicio.
+func readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	componentes := gin.H{}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	revisar := func(nombre string, chequeo func(context.Context) (string, string)) {
+		defer wg.Done()
+		estado, detalle := chequeo(ctx)
+		componente := gin.H{"estado": estado}
+		if detalle != "" {
+			componente["detalle"] = detalle
+		}
+		mu.Lock()
+		componentes[nombre] = componente
+		mu.Unlock()
+	}
+
+	wg.Add(3)
+	go revisar("mongo_atlas", func(ctx context.Context) (string, string) {
+		if err := client.Ping(ctx, nil); err != nil {
+			return estadoCaido, err.Error()
+		}
+		return estadoOK, ""
+	})
+	go revisar("mongo_local", func(ctx context.Context) (string, string) {
+		if cfg.Mongo.URILocal == "" {
+			return estadoNoConfigurado, ""
+		}
+		if clientLocal == nil {
+			return estadoCaido, "no se pudo conectar al iniciar"
+		}
+		if err := clientLocal.Ping(ctx, nil); err != nil {
+			return estadoCaido, err.Error()
+		}
+		return estadoOK, ""
+	})
+	go revisar("facepp", revisarFacePP)
+	wg.Wait()
+
+	estado, codigo := "listo", http.StatusOK
+	switch {
+	case apagando.Load():
+		estado, codigo = "apagando", http.StatusServiceUnavailable
+	case componentes["mongo_atlas"].(gin.H)["estado"] != estadoOK:
+		estado, codigo = "no_listo", http.StatusServiceUnavailable
+	case componentes["mongo_local"].(gin.H)["estado"] == estadoCaido,
+		componentes["facepp"].(gin.H)["estado"] != estadoOK:
+		estado = "degradado"
+	}
+
+	r := respuesta{OK: codigo == http.StatusOK, Data: gin.H{"status": estado, "componentes": componentes}}
+	if !r.OK {
+		r.Codigo = codigoServicioNoDisponible
+		r.Mensaje = texto(c, codigoServicioNoDisponible)
+	}
+	responder(c, codigo, r)
+}
+
+// revisarFacePP comprueba que la API de Face++ responda. Cualquier respuesta
+// HTTP cuenta como disponible; no se envían credenciales para no consumir
+// cuota. El resultado se reutiliza durante 30 segundos.
+func revisarFacePP(ctx context.Context) (string, string) {
+	estadoFacePP.Lock()
+	defer estadoFacePP.Unlock()
+
+	if time.Since(estadoFacePP.revisadoEn) < 30*time.Second {
+		return estadoFacePP.estado, estadoFacePP.detalle
+	}
+
+	estado, detalle := estadoOK, ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, cfg.FacePP.URL, nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	if err != nil {
+		estado, detalle = estadoCaido, err.Error()
+	}
+
+	estadoFacePP.estado, estadoFacePP.detalle, estadoFacePP.revisadoEn = estado, detalle, time.Now()
+	return estado, detalle
+}
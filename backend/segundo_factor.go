@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/tunombre/qrtixpro-backend/totp"
+)
+
+// Segundos factores de inicio de sesión. Los usuarios sin segundo_factor
+// usan el rostro.
+const (
+	factorRostro = "rostro"
+	factorTOTP   = "totp"
+)
+
+// emisorTOTP es el nombre con el que aparece la cuenta en la aplicación de
+// autenticación.
+const emisorTOTP = "QR-TixPro"
+
+// cantidadCodigosRecuperacion son los códigos que se entregan al activar TOTP.
+const cantidadCodigosRecuperacion = 10
+
+var formatoCodigoTOTP = regexp.MustCompile(`^\d{6}$`)
+
+// configuracionTOTP es el subdocumento totp del usuario. Secreto y Pendiente
+// se cifran con la clave de datos del usuario; de los códigos de
+// recuperación solo se guarda el hash.
+type configuracionTOTP struct {
+	Secreto             string   `bson:"secreto,omitempty"`
+	Pendiente           string   `bson:"pendiente,omitempty"`
+	UltimoPaso          int64    `bson:"ultimo_paso,omitempty"`
+	CodigosRecuperacion []string `bson:"codigos_recuperacion,omitempty"`
+}
+
+// usaTOTP indica si el usuario eligió TOTP como segundo factor.
+func (u Usuario) usaTOTP() bool {
+	return u.SegundoFactor == factorTOTP && u.TOTP != nil && u.TOTP.Secreto != ""
+}
+
+// factorActual devuelve el segundo factor con el que entra hoy el usuario.
+func (u Usuario) factorActual() string {
+	if u.usaTOTP() {
+		return factorTOTP
+	}
+	return factorRostro
+}
+
+// exigirSegundoFactor deja cambiar cómo se entra a la cuenta (TOTP, llaves
+// de acceso) solo con una sesión abierta pasando el segundo factor actual.
+// Así la contraseña sola, o una sesión de Google o de una llave, no sirven
+// para cambiarlo. Si no, responde 403 y devuelve false.
+func exigirSegundoFactor(c *gin.Context, usuario Usuario) bool {
+	if sesionActual(c).SegundoFactor == usuario.factorActual() {
+		return true
+	}
+	slog.WarnContext(c.Request.Context(), "Sesión sin el segundo factor actual", "cedula", usuario.Cedula)
+	responderError(c, http.StatusForbidden, codigoSegundoFactorRequerido)
+	return false
+}
+
+// solicitudCodigoTOTP es el cuerpo de la activación y la desactivación.
+type solicitudCodigoTOTP struct {
+	// Codigo es el de la aplicación o, para desactivar, uno de recuperación.
+	Codigo string `json:"codigo"`
+}
+
+// datosInscripcionTOTP es la respuesta al iniciar la inscripción.
+type datosInscripcionTOTP struct {
+	Secreto string `json:"secreto"`
+	URI     string `json:"uri"`
+	// QR es el URI otpauth como imagen PNG en un data URI.
+	QR string `json:"qr"`
+}
+
+// datosCodigosRecuperacion es la respuesta al activar TOTP. Es la única vez
+// que se muestran los códigos.
+type datosCodigosRecuperacion struct {
+	CodigosRecuperacion []string `json:"codigos_recuperacion"`
+}
+
+// iniciarTOTP genera un secreto y lo deja pendiente hasta que el titular
+// demuestre con un código que lo cargó en su aplicación.
+func iniciarTOTP(c *gin.Context) {
+	cedula := c.Param("cedula")
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, cedula)
+	if !ok || !exigirSegundoFactor(c, usuario) {
+		return
+	}
+	if usuario.usaTOTP() {
+		responderError(c, http.StatusConflict, codigoTOTPYaActivo)
+		return
+	}
+
+	secreto, err := totp.NuevoSecreto()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo generar el secreto TOTP", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	uri := totp.URI(emisorTOTP, cedula, secreto)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo generar el código QR", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	campos, err := cifrarCampos(map[string]string{"totp.pendiente": secreto}, usuario.ClaveDatos)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo cifrar el secreto TOTP", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	if !actualizarUsuarioReplicado(c, ctx, usuario, bson.M{"$set": campos}) {
+		return
+	}
+
+	auditar(c, accionTOTPIniciar, objetivo(objetivoUsuario, usuario.ID, cedula), nil, nil)
+	slog.InfoContext(c.Request.Context(), "Inscripción TOTP iniciada", "cedula", cedula)
+	responderOK(c, http.StatusOK, "", datosInscripcionTOTP{
+		Secreto: secreto,
+		URI:     uri,
+		QR:      "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// activarTOTP confirma la inscripción con el primer código, elige TOTP como
+// segundo factor y entrega los códigos de recuperación.
+func activarTOTP(c *gin.Context) {
+	var datos solicitudCodigoTOTP
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+
+	cedula := c.Param("cedula")
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, cedula)
+	if !ok || !exigirSegundoFactor(c, usuario) {
+		return
+	}
+	if usuario.usaTOTP() {
+		responderError(c, http.StatusConflict, codigoTOTPYaActivo)
+		return
+	}
+	if usuario.TOTP == nil || usuario.TOTP.Pendiente == "" {
+		responderError(c, http.StatusConflict, codigoTOTPSinInscripcion)
+		return
+	}
+	pendiente := usuario.TOTP.Pendiente
+	if err := descifrarCampos(usuario.ClaveDatos, &pendiente); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo descifrar el secreto TOTP", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	paso, ok := totp.Verificar(pendiente, datos.Codigo, time.Now())
+	if !ok {
+		slog.WarnContext(c.Request.Context(), "Código TOTP inválido al activar", "cedula", cedula)
+		responderError(c, http.StatusUnauthorized, codigoCodigoInvalido)
+		return
+	}
+
+	codigos, hashes, err := generarCodigosRecuperacion()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron generar los códigos de recuperación", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	// El secreto ya cifrado pasa tal cual de pendiente a activo
+	cambios := bson.M{
+		"$set": bson.M{
+			"segundo_factor":            factorTOTP,
+			"totp.secreto":              usuario.TOTP.Pendiente,
+			"totp.ultimo_paso":          paso,
+			"totp.codigos_recuperacion": hashes,
+		},
+		"$unset": bson.M{"totp.pendiente": ""},
+	}
+	if !actualizarUsuarioReplicado(c, ctx, usuario, cambios) {
+		return
+	}
+
+	auditar(c, accionTOTPActivar, objetivo(objetivoUsuario, usuario.ID, cedula),
+		bson.M{"segundo_factor": usuario.SegundoFactor}, bson.M{"segundo_factor": factorTOTP})
+	slog.InfoContext(c.Request.Context(), "TOTP activado", "cedula", cedula)
+	responderOK(c, http.StatusOK, exitoTOTPActivado, datosCodigosRecuperacion{CodigosRecuperacion: codigos})
+}
+
+// desactivarTOTP vuelve al rostro como segundo factor. Pide un código
+// vigente o de recuperación además de la sesión, para que una sesión sola,
+// aunque sea de una llave de acceso o de Google, no baste para quitar el
+// segundo factor.
+func desactivarTOTP(c *gin.Context) {
+	var datos solicitudCodigoTOTP
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+
+	cedula := c.Param("cedula")
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, cedula)
+	if !ok {
+		return
+	}
+	if !usuario.usaTOTP() {
+		responderError(c, http.StatusConflict, codigoTOTPSinInscripcion)
+		return
+	}
+	if cuentaBloqueada(ctx, c, cedula) || !verificarSegundoFactor(ctx, c, usuario, "", datos.Codigo) {
+		return
+	}
+
+	cambios := bson.M{
+		"$set":   bson.M{"segundo_factor": factorRostro},
+		"$unset": bson.M{"totp": ""},
+	}
+	if !actualizarUsuarioReplicado(c, ctx, usuario, cambios) {
+		return
+	}
+
+	auditar(c, accionTOTPDesactivar, objetivo(objetivoUsuario, usuario.ID, cedula),
+		bson.M{"segundo_factor": factorTOTP}, bson.M{"segundo_factor": factorRostro})
+	slog.InfoContext(c.Request.Context(), "TOTP desactivado", "cedula", cedula)
+	responderOK(c, http.StatusOK, exitoTOTPDesactivado, nil)
+}
+
+// verificarSegundoFactor comprueba el segundo factor que eligió el usuario:
+// la foto contra la suya o el código TOTP, que también puede ser uno de
+// recuperación. Los fallos cuentan para el bloqueo de la cuenta. Si no pasa
+// responde y devuelve false.
+func verificarSegundoFactor(ctx context.Context, c *gin.Context, usuario Usuario, foto, codigo string) bool {
+	if !usuario.usaTOTP() {
+		fotoReferencia, err := fotoDeUsuario(ctx, usuario)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudo leer la foto del usuario", "cedula", usuario.Cedula, "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+			return false
+		}
+		if !compararImagenes(c.Request.Context(), fotoReferencia, foto) {
+			slog.WarnContext(c.Request.Context(), "Verificación facial fallida", "cedula", usuario.Cedula)
+			registrarFallo(ctx, c, usuario.Cedula)
+			responderError(c, http.StatusUnauthorized, codigoVerificacionFacialFallida)
+			return false
+		}
+		return true
+	}
+
+	if strings.TrimSpace(codigo) == "" {
+		responderError(c, http.StatusUnauthorized, codigoCodigoRequerido)
+		return false
+	}
+	valido, err := comprobarCodigo(ctx, c, usuario, codigo)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo comprobar el código TOTP", "cedula", usuario.Cedula, "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return false
+	}
+	if !valido {
+		slog.WarnContext(c.Request.Context(), "Código TOTP inválido", "cedula", usuario.Cedula)
+		registrarFallo(ctx, c, usuario.Cedula)
+		responderError(c, http.StatusUnauthorized, codigoCodigoInvalido)
+		return false
+	}
+	return true
+}
+
+// comprobarCodigo acepta un código TOTP de la ventana actual que sea
+// posterior al último usado, o un código de recuperación, que se gasta. Las
+// dos comprobaciones son actualizaciones condicionales, así que dos
+// solicitudes simultáneas no pueden usar el mismo código.
+func comprobarCodigo(ctx context.Context, c *gin.Context, usuario Usuario, codigo string) (bool, error) {
+	codigo = strings.ReplaceAll(codigo, " ", "")
+
+	var secreto string
+	if formatoCodigoTOTP.MatchString(codigo) {
+		secreto = usuario.TOTP.Secreto
+		if err := descifrarCampos(usuario.ClaveDatos, &secreto); err != nil {
+			return false, err
+		}
+	}
+	filtro, cambios, ok := condicionCodigo(usuario.ID, secreto, codigo, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	resultado, err := collection.UpdateOne(ctx, filtro, cambios)
+	if err != nil {
+		return false, err
+	}
+	if resultado.ModifiedCount == 0 {
+		return false, nil
+	}
+	replicarUsuario(c, usuario.Cedula, time.Now(), cambios)
+	return true, nil
+}
+
+// condicionCodigo arma la actualización condicional que gasta codigo: un
+// código TOTP solo pasa si su paso es posterior a totp.ultimo_paso, y uno de
+// recuperación solo si su hash sigue en la lista, de la que se quita. Si el
+// código TOTP no es de la ventana actual devuelve false.
+func condicionCodigo(id primitive.ObjectID, secreto, codigo string, ahora time.Time) (filtro, cambios bson.M, ok bool) {
+	if formatoCodigoTOTP.MatchString(codigo) {
+		paso, ok := totp.Verificar(secreto, codigo, ahora)
+		if !ok {
+			return nil, nil, false
+		}
+		filtro = bson.M{"_id": id, "totp.ultimo_paso": bson.M{"$lt": paso}}
+		cambios = bson.M{"$set": bson.M{"totp.ultimo_paso": paso}}
+		return filtro, cambios, true
+	}
+	hash := hashSecreto(normalizarCodigoRecuperacion(codigo))
+	filtro = bson.M{"_id": id, "totp.codigos_recuperacion": hash}
+	cambios = bson.M{"$pull": bson.M{"totp.codigos_recuperacion": hash}}
+	return filtro, cambios, true
+}
+
+// generarCodigosRecuperacion devuelve los códigos para mostrar, con la forma
+// xxxxx-xxxxx, y sus hashes para guardar.
+func generarCodigosRecuperacion() (codigos, hashes []string, err error) {
+	const alfabeto = "abcdefghjkmnpqrstuvwxyz23456789"
+	for range cantidadCodigosRecuperacion {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for i := range b {
+			b[i] = alfabeto[int(b[i])%len(alfabeto)]
+		}
+		codigo := string(b[:5]) + "-" + string(b[5:])
+		codigos = append(codigos, codigo)
+		hashes = append(hashes, hashSecreto(normalizarCodigoRecuperacion(codigo)))
+	}
+	return codigos, hashes, nil
+}
+
+func normalizarCodigoRecuperacion(codigo string) string {
+	return strings.ToLower(strings.ReplaceAll(codigo, "-", ""))
+}
+
+// actualizarUsuarioReplicado aplica cambios al usuario en MongoDB Atlas y,
+// si está disponible, en MongoDB Local. Si falla en Atlas responde y
+// devuelve false.
+func actualizarUsuarioReplicado(c *gin.Context, ctx context.Context, usuario Usuario, cambios bson.M) bool {
+	resultado, err := collection.UpdateOne(ctx, bson.M{"_id": usuario.ID}, cambios)
+	if err == nil && resultado.MatchedCount == 0 {
+		err = errors.New("el usuario ya no existe")
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo actualizar el usuario en MongoDB Atlas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return false
+	}
+	replicarUsuario(c, usuario.Cedula, time.Now(), cambios)
+	return true
+}
+
+// replicarUsuario copia a MongoDB Local un cambio ya hecho en Atlas. La
+// réplica tiene otro _id, así que se busca por cédula. Es de mejor esfuerzo:
+// un fallo solo se registra.
+func replicarUsuario(c *gin.Context, cedula string, escritoEnAtlas time.Time, cambios bson.M) {
+	if collectionLocal == nil || clientLocal == nil {
+		return
+	}
+	ctxLocal, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	_, err := collectionLocal.UpdateOne(ctxLocal, filtroCedula(cedula), cambios)
+	observarReplica("usuarios", escritoEnAtlas, err)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo actualizar el usuario en MongoDB Local", "error", err)
+	}
+}
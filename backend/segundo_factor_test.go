@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/tunombre/qrtixpro-backend/totp"
+)
+
+// aplicarCondicion hace en memoria lo que hace MongoDB con la actualización
+// de condicionCodigo: si el filtro coincide con config aplica los cambios y
+// devuelve true.
+func aplicarCondicion(t *testing.T, config *configuracionTOTP, filtro, cambios bson.M) bool {
+	t.Helper()
+	if cond, ok := filtro["totp.ultimo_paso"].(bson.M); ok {
+		paso := cond["$lt"].(int64)
+		if config.UltimoPaso >= paso {
+			return false
+		}
+		config.UltimoPaso = cambios["$set"].(bson.M)["totp.ultimo_paso"].(int64)
+		return true
+	}
+	hash := filtro["totp.codigos_recuperacion"].(string)
+	i := slices.Index(config.CodigosRecuperacion, hash)
+	if i < 0 {
+		return false
+	}
+	if cambios["$pull"].(bson.M)["totp.codigos_recuperacion"] != hash {
+		t.Fatalf("el $pull no quita el código del filtro: %v", cambios)
+	}
+	config.CodigosRecuperacion = slices.Delete(config.CodigosRecuperacion, i, i+1)
+	return true
+}
+
+func gastarCodigo(t *testing.T, config *configuracionTOTP, secreto, codigo string, ahora time.Time) bool {
+	t.Helper()
+	filtro, cambios, ok := condicionCodigo(primitive.NewObjectID(), secreto, codigo, ahora)
+	return ok && aplicarCondicion(t, config, filtro, cambios)
+}
+
+func TestCodigosRecuperacionSeUsanUnaVez(t *testing.T) {
+	codigos, hashes, err := generarCodigosRecuperacion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codigos) != cantidadCodigosRecuperacion || len(hashes) != cantidadCodigosRecuperacion {
+		t.Fatalf("%d códigos y %d hashes, se esperaban %d", len(codigos), len(hashes), cantidadCodigosRecuperacion)
+	}
+	for i, codigo := range codigos {
+		if slices.Contains(hashes, codigo) {
+			t.Fatal("se guardaría el código en claro")
+		}
+		if slices.Index(codigos, codigo) != i {
+			t.Fatalf("código repetido: %s", codigo)
+		}
+	}
+
+	config := &configuracionTOTP{CodigosRecuperacion: slices.Clone(hashes)}
+	ahora := time.Now()
+	if !gastarCodigo(t, config, "", codigos[0], ahora) {
+		t.Fatal("se rechazó un código de recuperación válido")
+	}
+	if gastarCodigo(t, config, "", codigos[0], ahora) {
+		t.Fatal("se aceptó dos veces el mismo código de recuperación")
+	}
+	if len(config.CodigosRecuperacion) != cantidadCodigosRecuperacion-1 {
+		t.Errorf("quedan %d códigos, se esperaban %d", len(config.CodigosRecuperacion), cantidadCodigosRecuperacion-1)
+	}
+
+	// Se aceptan sin guion y en mayúsculas, como los copia el usuario
+	otro := codigos[1]
+	if !gastarCodigo(t, config, "", otro[:5]+otro[6:], ahora) {
+		t.Error("se rechazó un código sin guion")
+	}
+	if !gastarCodigo(t, config, "", strings.ToUpper(codigos[2]), ahora) {
+		t.Error("se rechazó un código en mayúsculas")
+	}
+	if gastarCodigo(t, config, "", "aaaaa-aaaaa", ahora) {
+		t.Error("se aceptó un código que no se generó")
+	}
+}
+
+func TestCodigoTOTPNoSeReutiliza(t *testing.T) {
+	secreto, err := totp.NuevoSecreto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ahora := time.Now()
+	config := &configuracionTOTP{UltimoPaso: totp.Paso(ahora) - 5}
+
+	codigo, _ := totp.Codigo(secreto, totp.Paso(ahora))
+	if !gastarCodigo(t, config, secreto, codigo, ahora) {
+		t.Fatal("se rechazó el código vigente")
+	}
+	if gastarCodigo(t, config, secreto, codigo, ahora.Add(totp.Periodo)) {
+		t.Fatal("se aceptó dos veces el mismo código")
+	}
+
+	// Tampoco uno anterior de la ventana, aunque no se haya usado
+	anterior, _ := totp.Codigo(secreto, totp.Paso(ahora)-1)
+	if gastarCodigo(t, config, secreto, anterior, ahora) {
+		t.Error("se aceptó un código anterior al último usado")
+	}
+
+	siguiente, _ := totp.Codigo(secreto, totp.Paso(ahora)+1)
+	if !gastarCodigo(t, config, secreto, siguiente, ahora.Add(totp.Periodo)) {
+		t.Error("se rechazó el código del paso siguiente")
+	}
+}
+
+func TestExigirSegundoFactorPideElFactorActual(t *testing.T) {
+	conTOTP := Usuario{Cedula: "1020304050", SegundoFactor: factorTOTP, TOTP: &configuracionTOTP{Secreto: "GEZDGNBVGY3TQOJQ"}}
+	conRostro := Usuario{Cedula: "1020304050", SegundoFactor: factorRostro}
+	casos := []struct {
+		nombre  string
+		usuario Usuario
+		factor  string
+		permite bool
+	}{
+		{"rostro con sesión de rostro", conRostro, factorRostro, true},
+		{"TOTP con sesión de TOTP", conTOTP, factorTOTP, true},
+		{"TOTP con sesión de rostro", conTOTP, factorRostro, false},
+		{"rostro con sesión de llave o de Google", conRostro, "", false},
+		{"TOTP con sesión de llave o de Google", conTOTP, "", false},
+	}
+	for _, caso := range casos {
+		c, w := contextoPrueba()
+		c.Set(claveSesionActual, sesion{SegundoFactor: caso.factor})
+		if got := exigirSegundoFactor(c, caso.usuario); got != caso.permite {
+			t.Errorf("%s: exigirSegundoFactor = %v", caso.nombre, got)
+		}
+		if !caso.permite && w.Code != http.StatusForbidden {
+			t.Errorf("%s: estado = %d, se esperaba 403", caso.nombre, w.Code)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/tunombre/qrtixpro-backend/googleid"
+)
+
+// verificadorGoogle es nil si no hay ID de cliente configurado.
+var verificadorGoogle *googleid.Verificador
+
+// iniciarGoogle prepara la verificación de ID tokens de Google.
+func iniciarGoogle() {
+	if cfg.Google.ClienteID == "" {
+		slog.Warn("Sin google.cliente_id: el inicio de sesión con Google está desactivado")
+		return
+	}
+	verificadorGoogle = googleid.Nuevo(cfg.Google.ClienteID)
+	verificadorGoogle.URLClaves = cfg.Google.URLClaves
+}
+
+// solicitudSesionGoogle es el cuerpo de POST /auth/google.
+type solicitudSesionGoogle struct {
+	// Token es el ID token de Google (la credencial de Google Identity
+	// Services o el idToken de Firebase), no el access token.
+	Token string `json:"token"`
+}
+
+// datosSesionGoogle es la respuesta de un inicio de sesión con Google.
+type datosSesionGoogle struct {
+	Cedula string `json:"cedula,omitempty"`
+	// PerfilIncompleto indica una cuenta creada con Google a la que aún le
+	// faltan cédula, teléfono y foto para comprar. Se completan con
+	// PUT /perfil.
+	PerfilIncompleto bool `json:"perfil_incompleto"`
+	// Sesion es el token de la sesión abierta, como en datosSesion.
+	Sesion   string    `json:"sesion"`
+	ExpiraEn time.Time `json:"expira_en"`
+}
+
+// iniciarSesionGoogle verifica el ID token de Google y entra con la cuenta
+// vinculada a él. Si no hay ninguna, vincula la cuenta con ese correo o, si
+// tampoco existe, la crea. El correo tiene que estar verificado por Google.
+func iniciarSesionGoogle(c *gin.Context) {
+	var datos solicitudSesionGoogle
+	if err := c.ShouldBindJSON(&datos); err != nil || datos.Token == "" {
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	if verificadorGoogle == nil {
+		responderError(c, http.StatusServiceUnavailable, codigoServicioNoDisponible)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	identidad, err := verificadorGoogle.Verificar(ctx, datos.Token)
+	if err != nil {
+		if errors.Is(err, googleid.ErrClavesNoDisponibles) {
+			slog.ErrorContext(c.Request.Context(), "No se pudieron obtener las claves de Google", "error", err)
+			responderError(c, http.StatusServiceUnavailable, codigoServicioNoDisponible)
+		} else {
+			slog.WarnContext(c.Request.Context(), "ID token de Google rechazado", "error", err)
+			responderError(c, http.StatusUnauthorized, codigoTokenGoogleInvalido)
+		}
+		return
+	}
+	if !identidad.CorreoVerificado || identidad.Correo == "" {
+		slog.WarnContext(c.Request.Context(), "Cuenta de Google sin correo verificado", "correo", identidad.Correo)
+		responderError(c, http.StatusUnauthorized, codigoCorreoGoogleNoVerificado)
+		return
+	}
+
+	usuario, creado, err := usuarioDeGoogle(ctx, c, identidad)
+	if err != nil {
+		if errors.Is(err, errGoogleYaVinculada) {
+			slog.WarnContext(c.Request.Context(), "El correo ya está vinculado a otra cuenta de Google", "correo", identidad.Correo)
+			responderError(c, http.StatusConflict, codigoGoogleYaVinculada)
+		} else {
+			slog.ErrorContext(c.Request.Context(), "No se pudo obtener el usuario de Google", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+
+	if !creado && usuario.Cedula != "" {
+		if cuentaBloqueada(ctx, c, usuario.Cedula) {
+			return
+		}
+		reiniciarFallos(ctx, c, usuario.Cedula)
+	}
+	sesion, ok := abrirSesion(c, ctx, usuario, metodoGoogle)
+	if !ok {
+		return
+	}
+
+	respuesta := datosSesionGoogle{
+		Cedula:           usuario.Cedula,
+		PerfilIncompleto: usuario.Cedula == "",
+		Sesion:           sesion.Sesion,
+		ExpiraEn:         sesion.ExpiraEn,
+	}
+	if creado {
+		slog.InfoContext(c.Request.Context(), "Usuario creado con Google", "correo", identidad.Correo)
+		responderOK(c, http.StatusCreated, exitoCuentaGoogleCreada, respuesta)
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Inicio de sesión con Google", "correo", identidad.Correo)
+	responderOK(c, http.StatusOK, exitoInicioSesion, respuesta)
+}
+
+// errGoogleYaVinculada indica que el usuario con ese correo ya está
+// vinculado a otra cuenta de Google.
+var errGoogleYaVinculada = errors.New("el usuario ya está vinculado a otra cuenta de Google")
+
+// usuarioDeGoogle busca el usuario por la cuenta de Google y después por el
+// correo, y lo vincula; si no existe lo crea. Devuelve el usuario descifrado
+// e indica si se creó.
+func usuarioDeGoogle(ctx context.Context, c *gin.Context, identidad googleid.Identidad) (Usuario, bool, error) {
+	var usuario Usuario
+	err := collection.FindOne(ctx, bson.M{"google_sub": identidad.Sujeto}).Decode(&usuario)
+	if err == nil {
+		return usuario, false, descifrarUsuario(&usuario)
+	}
+	if err != mongo.ErrNoDocuments {
+		return usuario, false, err
+	}
+
+	err = collection.FindOne(ctx, filtroCorreo(identidad.Correo)).Decode(&usuario)
+	if err == mongo.ErrNoDocuments {
+		return crearUsuarioGoogle(ctx, c, identidad)
+	}
+	if err != nil {
+		return usuario, false, err
+	}
+	if err := descifrarUsuario(&usuario); err != nil {
+		return usuario, false, err
+	}
+	if usuario.GoogleSub != "" {
+		return usuario, false, errGoogleYaVinculada
+	}
+
+	// Google ya verificó el correo, así que también queda confirmado
+	cambios := bson.M{"$set": bson.M{"google_sub": identidad.Sujeto, "estado": estadoActivo}}
+	resultado, err := collection.UpdateOne(ctx, bson.M{"_id": usuario.ID, "google_sub": bson.M{"$exists": false}}, cambios)
+	if err != nil {
+		return usuario, false, err
+	}
+	if resultado.MatchedCount == 0 {
+		return usuario, false, errGoogleYaVinculada
+	}
+	replicarUsuario(c, usuario.Cedula, time.Now(), cambios)
+	slog.InfoContext(c.Request.Context(), "Cuenta de Google vinculada", "cedula", usuario.Cedula)
+
+	antes := usuario
+	usuario.GoogleSub = identidad.Sujeto
+	usuario.Estado = estadoActivo
+	auditar(c, accionGoogleVincular, objetivo(objetivoUsuario, usuario.ID, usuario.Cedula), antes, usuario)
+	return usuario, false, nil
+}
+
+// crearUsuarioGoogle registra un usuario con los datos de Google. Queda
+// activo, porque el correo está verificado, pero sin cédula ni foto.
+func crearUsuarioGoogle(ctx context.Context, c *gin.Context, identidad googleid.Identidad) (Usuario, bool, error) {
+	doc, err := cifrarCampos(map[string]string{"correo": identidad.Correo}, nil)
+	if err != nil {
+		return Usuario{}, false, err
+	}
+	usuario := Usuario{
+		ID:        primitive.NewObjectID(),
+		Nombres:   identidad.NombrePila,
+		Apellidos: identidad.Apellido,
+		Correo:    identidad.Correo,
+		GoogleSub: identidad.Sujeto,
+		Estado:    estadoActivo,
+	}
+	if usuario.Nombres == "" {
+		usuario.Nombres = strings.TrimSpace(identidad.Nombre)
+	}
+	doc["_id"] = usuario.ID
+	doc["nombres"] = usuario.Nombres
+	doc["apellidos"] = usuario.Apellidos
+	doc["google_sub"] = usuario.GoogleSub
+	doc["estado"] = usuario.Estado
+
+	if _, err := collection.InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// Otra solicitud con el mismo token o correo lo creó primero
+			return usuarioDeGoogle(ctx, c, identidad)
+		}
+		return Usuario{}, false, err
+	}
+	escritoEnAtlas := time.Now()
+
+	if collectionLocal != nil && clientLocal != nil {
+		ctxLocal, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+		defer cancel()
+		_, err := collectionLocal.InsertOne(ctxLocal, doc)
+		observarReplica("usuarios", escritoEnAtlas, err)
+		if err != nil {
+			slog.InfoContext(c.Request.Context(), "No se pudo registrar el usuario en MongoDB Local", "error", err)
+		}
+	}
+	auditar(c, accionUsuarioCrear, objetivo(objetivoUsuario, usuario.ID, ""), nil, usuario)
+	return usuario, true, nil
+}
+
+// solicitudPerfil es el cuerpo de PUT /perfil: lo que le falta a una cuenta
+// creada con Google para comprar y para entrar con el rostro.
+type solicitudPerfil struct {
+	Cedula   string `json:"cedula"`
+	Telefono string `json:"telefono"`
+	Foto     string `json:"foto"`
+}
+
+// completarPerfil agrega cédula, teléfono y foto a la cuenta de la sesión.
+// Las cuentas creadas con Google no tienen cédula y por eso no pueden usar
+// las rutas de /usuarios/:cedula; esta va por la sesión y sirve una sola
+// vez. Después la cuenta se actualiza como cualquier otra.
+func completarPerfil(c *gin.Context) {
+	var datos solicitudPerfil
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+
+	usuario := usuarioAutenticado(c)
+	if usuario.Cedula != "" {
+		responderError(c, http.StatusConflict, codigoPerfilCompleto)
+		return
+	}
+
+	errores := validarCamposUsuario(Usuario{Cedula: datos.Cedula, Telefono: datos.Telefono, Foto: datos.Foto})
+	maps.DeleteFunc(errores, func(campo, _ string) bool {
+		return campo != "cedula" && campo != "telefono" && campo != "foto"
+	})
+	if len(errores) > 0 {
+		slog.WarnContext(c.Request.Context(), "Validación fallida", "errores", errores)
+		responderValidacion(c, errores)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	err := collection.FindOne(ctx, filtroCedula(datos.Cedula)).Err()
+	if err == nil {
+		slog.WarnContext(c.Request.Context(), "Ya existe un usuario con la cédula", "cedula", datos.Cedula)
+		responderError(c, http.StatusConflict, codigoCedulaDuplicada)
+		return
+	} else if err != mongo.ErrNoDocuments {
+		slog.ErrorContext(c.Request.Context(), "Error al verificar usuario existente", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	fotoID := primitive.NewObjectID()
+	if err := fotosAtlas.Guardar(ctx, fotoID, datos.Foto); err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo guardar la foto en MongoDB Atlas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+
+	campos, err := cifrarCampos(map[string]string{"cedula": datos.Cedula, "telefono": datos.Telefono}, usuario.ClaveDatos)
+	var resultado *mongo.UpdateResult
+	if err == nil {
+		campos["foto_id"] = fotoID
+		// La condición sobre cedula_hash evita completar dos veces en carrera
+		resultado, err = collection.UpdateOne(ctx,
+			bson.M{"_id": usuario.ID, "cedula_hash": bson.M{"$exists": false}},
+			bson.M{"$set": campos})
+	}
+	if err != nil || resultado.MatchedCount == 0 {
+		if err := fotosAtlas.Eliminar(ctx, fotoID); err != nil {
+			slog.WarnContext(c.Request.Context(), "No se pudo eliminar la foto huérfana", "error", err)
+		}
+		switch {
+		case err == nil:
+			responderError(c, http.StatusConflict, codigoPerfilCompleto)
+		case mongo.IsDuplicateKeyError(err):
+			responderError(c, http.StatusConflict, codigoCedulaDuplicada)
+		default:
+			slog.ErrorContext(c.Request.Context(), "No se pudo completar el perfil en MongoDB Atlas", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		}
+		return
+	}
+	escritoEnAtlas := time.Now()
+
+	// La réplica local aún no tiene cédula, así que se busca por correo
+	if collectionLocal != nil && clientLocal != nil {
+		ctxLocal, cancelLocal := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+		defer cancelLocal()
+		err := fotosLocal.Guardar(ctxLocal, fotoID, datos.Foto)
+		if err == nil {
+			_, err = collectionLocal.UpdateOne(ctxLocal, filtroCorreo(usuario.Correo), bson.M{"$set": campos})
+		}
+		observarReplica("usuarios", escritoEnAtlas, err)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "No se pudo completar el perfil en MongoDB Local", "error", err)
+		}
+	}
+
+	despues := usuario
+	despues.Cedula, despues.Telefono, despues.FotoID = datos.Cedula, datos.Telefono, fotoID
+	auditar(c, accionUsuarioActualizar, objetivo(objetivoUsuario, usuario.ID, datos.Cedula), usuario, despues)
+
+	slog.InfoContext(c.Request.Context(), "Perfil completado", "cedula", datos.Cedula)
+	responderOK(c, http.StatusOK, exitoPerfilCompletado, nil)
+}
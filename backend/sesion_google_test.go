@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompletarPerfilSoloSinCedula(t *testing.T) {
+	sesiones := prepararSesiones(t)
+	r := gin.New()
+	r.Use(gin.CustomRecovery(recuperarPanico))
+	registrarRutasV1(r)
+
+	google := sesiones.abrir(Usuario{Correo: "ana@example.com"})
+	conCedula := sesiones.abrir(Usuario{Cedula: "1000000001", Correo: "luis@example.com"})
+	porteria := sesiones.abrir(Usuario{Correo: "porteria@example.com", Roles: []string{rolPorteria}})
+	valida := solicitudPerfil{Cedula: "1000000003", Telefono: "3001234567", Foto: "iVBORw0KGgo="}
+
+	casos := []struct {
+		nombre string
+		token  string
+		cuerpo solicitudPerfil
+		estado int
+		codigo string
+	}{
+		{"sin sesión", "", valida, http.StatusUnauthorized, codigoAutenticacionRequerida},
+		{"portería", porteria, valida, http.StatusForbidden, codigoPermisoDenegado},
+		{"cuenta que ya tiene cédula", conCedula, valida, http.StatusConflict, codigoPerfilCompleto},
+		{"sin cédula ni teléfono", google, solicitudPerfil{Foto: valida.Foto}, http.StatusBadRequest, codigoValidacionFallida},
+		{"cédula con letras", google, solicitudPerfil{Cedula: "10A", Telefono: valida.Telefono, Foto: valida.Foto}, http.StatusBadRequest, codigoValidacionFallida},
+		{"sin foto", google, solicitudPerfil{Cedula: valida.Cedula, Telefono: valida.Telefono}, http.StatusBadRequest, codigoValidacionFallida},
+	}
+	for _, caso := range casos {
+		estado, codigo := solicitar(r, http.MethodPut, prefijoV1+"/perfil", caso.token, caso.cuerpo)
+		if estado != caso.estado || codigo != caso.codigo {
+			t.Errorf("%s: %d %s, se esperaba %d %s", caso.nombre, estado, codigo, caso.estado, caso.codigo)
+		}
+	}
+}
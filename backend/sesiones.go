@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Métodos de inicio de sesión.
+const (
+	// metodoContrasena es cédula, contraseña y segundo factor.
+	metodoContrasena = "contrasena"
+	// metodoCorreo es el reto enviado al correo y el segundo factor.
+	metodoCorreo  = "correo"
+	metodoPasskey = "passkey"
+	metodoGoogle  = "google"
+)
+
+// Resultados de un intento de inicio de sesión y, en los fallidos, qué
+// credencial no pasó.
+const (
+	resultadoExitoso    = "exitoso"
+	resultadoFallido    = "fallido"
+	motivoContrasena    = "contrasena"
+	motivoSegundoFactor = "segundo_factor"
+	motivoPasskey       = "passkey"
+)
+
+// vigenciaSesion es cuánto dura una sesión desde que se abre. Usarla no la
+// extiende.
+const vigenciaSesion = 7 * 24 * time.Hour
+
+// maxIniciosListados limita cuántos inicios de sesión devuelve la consulta.
+const maxIniciosListados = 50
+
+// claveSesionActual guarda en el contexto de Gin la sesión con la que se
+// autenticó quien llama.
+const claveSesionActual = "sesion_actual"
+
+// sesion es una sesión abierta por un inicio de sesión exitoso. El cliente
+// presenta el token como Authorization: Bearer en lugar de la cédula y la
+// contraseña. Como los tokens, se guarda solo el hash.
+type sesion struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Hash      string             `json:"-" bson:"hash"`
+	UsuarioID primitive.ObjectID `json:"-" bson:"usuario_id"`
+	Metodo    string             `json:"metodo" bson:"metodo"`
+	// SegundoFactor es el que se verificó al abrirla, factorRostro o
+	// factorTOTP. Las sesiones de llave de acceso o de Google no tienen.
+	SegundoFactor string    `json:"segundo_factor,omitempty" bson:"segundo_factor,omitempty"`
+	IP            string    `json:"ip" bson:"ip"`
+	UserAgent     string    `json:"user_agent" bson:"user_agent"`
+	CreadaEn      time.Time `json:"creada_en" bson:"creada_en"`
+	UltimoUso     time.Time `json:"ultimo_uso" bson:"ultimo_uso"`
+	ExpiraEn      time.Time `json:"expira_en" bson:"expira_en"`
+	// Actual marca, al listarlas, la sesión con la que se hizo la consulta.
+	Actual bool `json:"actual" bson:"-"`
+}
+
+// datosSesion es la respuesta de un inicio de sesión exitoso. Sesion es el
+// token; es la única vez que se entrega.
+type datosSesion struct {
+	Cedula   string    `json:"cedula"`
+	Sesion   string    `json:"sesion"`
+	ExpiraEn time.Time `json:"expira_en"`
+}
+
+// inicioSesion es un intento de inicio de sesión en la colección logs. Los
+// registros anteriores a estos campos solo tienen la fecha y el índice ciego
+// de la cédula, que la migración 3 puso en lugar de la cédula en claro.
+type inicioSesion struct {
+	UsuarioID primitive.ObjectID  `json:"-" bson:"usuario_id,omitempty"`
+	FechaHora time.Time           `json:"fecha_hora" bson:"fecha_hora"`
+	Metodo    string              `json:"metodo,omitempty" bson:"metodo,omitempty"`
+	Resultado string              `json:"resultado,omitempty" bson:"resultado,omitempty"`
+	Motivo    string              `json:"motivo,omitempty" bson:"motivo,omitempty"`
+	IP        string              `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string              `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	SesionID  *primitive.ObjectID `json:"sesion,omitempty" bson:"sesion_id,omitempty"`
+}
+
+// nuevoInicioSesion arma el registro de un intento de usuario con los datos
+// de la solicitud.
+func nuevoInicioSesion(c *gin.Context, usuario Usuario, metodo, resultado string) inicioSesion {
+	return inicioSesion{
+		UsuarioID: usuario.ID,
+		FechaHora: time.Now(),
+		Metodo:    metodo,
+		Resultado: resultado,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// abrirSesion crea la sesión del usuario que acaba de autenticarse, anota
+// el inicio de sesión y fija su última sesión con la hora del servidor. Si
+// no puede crear la sesión responde 500 y devuelve false.
+func abrirSesion(c *gin.Context, ctx context.Context, usuario Usuario, metodo string) (datosSesion, bool) {
+	token, hash, err := generarSecreto()
+	ahora := time.Now()
+	s := sesion{
+		ID:        primitive.NewObjectID(),
+		Hash:      hash,
+		UsuarioID: usuario.ID,
+		Metodo:    metodo,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		CreadaEn:  ahora,
+		UltimoUso: ahora,
+		ExpiraEn:  ahora.Add(vigenciaSesion),
+	}
+	if metodo == metodoContrasena || metodo == metodoCorreo {
+		s.SegundoFactor = usuario.factorActual()
+	}
+	if err == nil {
+		_, err = sesionesCollection.InsertOne(ctx, s)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo abrir la sesión", "cedula", usuario.Cedula, "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return datosSesion{}, false
+	}
+
+	inicio := nuevoInicioSesion(c, usuario, metodo, resultadoExitoso)
+	inicio.SesionID = &s.ID
+	registrarInicioSesion(c, ctx, inicio)
+
+	cambios := bson.M{"$set": bson.M{"ultimaSesion": ahora.Format(time.RFC3339)}}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": usuario.ID}, cambios); err != nil {
+		slog.WarnContext(c.Request.Context(), "No se pudo actualizar la última sesión en MongoDB Atlas", "error", err)
+	} else if usuario.Cedula != "" {
+		replicarUsuario(c, usuario.Cedula, time.Now(), cambios)
+	}
+
+	return datosSesion{Cedula: usuario.Cedula, Sesion: token, ExpiraEn: s.ExpiraEn}, true
+}
+
+// registrarInicioFallido anota un intento fallido de un usuario conocido.
+// Los de cédulas o llaves que no existen no se anotan: no hay a quién
+// mostrárselos.
+func registrarInicioFallido(c *gin.Context, ctx context.Context, usuario Usuario, metodo, motivo string) {
+	inicio := nuevoInicioSesion(c, usuario, metodo, resultadoFallido)
+	inicio.Motivo = motivo
+	registrarInicioSesion(c, ctx, inicio)
+}
+
+// tokenSesion devuelve el token de Authorization: Bearer, si viene.
+func tokenSesion(c *gin.Context) (string, bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// buscarSesion devuelve la sesión vigente con ese hash, anota su uso y trae
+// a su usuario ya descifrado. Si no hay sesión vigente o el usuario ya no
+// existe, devuelve mongo.ErrNoDocuments. Es una variable para que las
+// pruebas de autorización no necesiten MongoDB.
+var buscarSesion = func(ctx context.Context, hash string) (sesion, Usuario, error) {
+	var usuario Usuario
+	var s sesion
+	err := sesionesCollection.FindOneAndUpdate(ctx,
+		bson.M{"hash": hash, "expira_en": bson.M{"$gt": time.Now()}},
+		bson.M{"$set": bson.M{"ultimo_uso": time.Now()}},
+	).Decode(&s)
+	if err == nil {
+		err = collection.FindOne(ctx, bson.M{"_id": s.UsuarioID}).Decode(&usuario)
+	}
+	if err == nil {
+		err = descifrarUsuario(&usuario)
+	}
+	return s, usuario, err
+}
+
+// autenticarSesion identifica a quien llama por el token de su sesión. Si la
+// sesión no existe, venció o se revocó, responde 401 y devuelve false.
+func autenticarSesion(c *gin.Context, ctx context.Context, token string) (Usuario, bool) {
+	s, usuario, err := buscarSesion(ctx, hashSecreto(token))
+	if err == mongo.ErrNoDocuments {
+		responderError(c, http.StatusUnauthorized, codigoSesionInvalida)
+		return Usuario{}, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error al validar la sesión", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return Usuario{}, false
+	}
+
+	c.Set(claveSesionActual, s)
+	c.Set(claveUsuarioAutenticado, usuario)
+	return usuario, true
+}
+
+// sesionActual devuelve la sesión que dejó autenticarSesion.
+func sesionActual(c *gin.Context) sesion {
+	s, _ := c.MustGet(claveSesionActual).(sesion)
+	return s
+}
+
+// listarSesiones devuelve las sesiones vigentes del titular, de la usada más
+// recientemente a la menos.
+func listarSesiones(c *gin.Context) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, c.Param("cedula"))
+	if !ok {
+		return
+	}
+
+	sesiones := []sesion{}
+	filtro := bson.M{"usuario_id": usuario.ID, "expira_en": bson.M{"$gt": time.Now()}}
+	cursor, err := sesionesCollection.Find(ctx, filtro, options.Find().SetSort(bson.D{{Key: "ultimo_uso", Value: -1}}))
+	if err == nil {
+		err = cursor.All(ctx, &sesiones)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron leer las sesiones", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	actual := sesionActual(c)
+	for i := range sesiones {
+		sesiones[i].Actual = sesiones[i].ID == actual.ID
+	}
+	responderOK(c, http.StatusOK, "", sesiones)
+}
+
+// revocarSesion cierra una sesión del titular; el token deja de servir de
+// inmediato. Puede ser la misma con la que llama.
+func revocarSesion(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		responderError(c, http.StatusNotFound, codigoSesionNoEncontrada)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, c.Param("cedula"))
+	if !ok {
+		return
+	}
+	resultado, err := sesionesCollection.DeleteOne(ctx, bson.M{"_id": id, "usuario_id": usuario.ID})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo revocar la sesión", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	if resultado.DeletedCount == 0 {
+		responderError(c, http.StatusNotFound, codigoSesionNoEncontrada)
+		return
+	}
+
+	auditar(c, accionSesionRevocar, objetivo(objetivoUsuario, usuario.ID, usuario.Cedula), bson.M{"sesion": id}, nil)
+
+	slog.InfoContext(c.Request.Context(), "Sesión revocada", "cedula", usuario.Cedula, "sesion", id.Hex())
+	responderOK(c, http.StatusOK, exitoSesionRevocada, nil)
+}
+
+// filtroIniciosSesion selecciona los inicios de sesión del usuario en logs.
+// Los registros anteriores solo tienen el índice ciego de la cédula.
+func filtroIniciosSesion(usuario Usuario) bson.M {
+	if usuario.Cedula == "" {
+		return bson.M{"usuario_id": usuario.ID}
+	}
+	return bson.M{"$or": bson.A{bson.M{"usuario_id": usuario.ID}, bson.M{"cedula_hash": llavero.IndiceCiego("cedula", usuario.Cedula)}}}
+}
+
+// listarIniciosSesion devuelve los intentos de inicio de sesión más
+// recientes del titular, exitosos y fallidos.
+func listarIniciosSesion(c *gin.Context) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario, ok := autorizarTitular(c, c.Param("cedula"))
+	if !ok {
+		return
+	}
+
+	opciones := options.Find().SetSort(bson.D{{Key: "fecha_hora", Value: -1}}).SetLimit(maxIniciosListados)
+	inicios := []inicioSesion{}
+	cursor, err := logsCollection.Find(ctx, filtroIniciosSesion(usuario), opciones)
+	if err == nil {
+		err = cursor.All(ctx, &inicios)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron leer los inicios de sesión", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	responderOK(c, http.StatusOK, "", inicios)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errTokenInvalido indica un token desconocido, vencido, ya usado o emitido
+// para un correo que no está registrado. No se distinguen entre sí.
+var errTokenInvalido = errors.New("token inválido")
+
+// tokenUsuario es un token de un solo uso: los retos de inicio de sesión, los
+// enlaces para restablecer la contraseña y los de confirmación de correo.
+// Solo se guarda el hash, así que una copia de la colección no sirve para
+// canjearlos. UsuarioID va vacío en los tokens de correos no registrados, que
+// existen para que la respuesta y el trabajo hecho sean iguales en ambos casos.
+type tokenUsuario struct {
+	Hash      string             `bson:"_id"`
+	UsuarioID primitive.ObjectID `bson:"usuario_id,omitempty"`
+	CreadoEn  time.Time          `bson:"creado_en"`
+	ExpiraEn  time.Time          `bson:"expira_en"`
+}
+
+// generarSecreto devuelve un valor aleatorio de 256 bits para entregar al
+// cliente y el hash con el que se guarda.
+func generarSecreto() (secreto, hash string, err error) {
+	aleatorio := make([]byte, 32)
+	if _, err := rand.Read(aleatorio); err != nil {
+		return "", "", err
+	}
+	secreto = base64.RawURLEncoding.EncodeToString(aleatorio)
+	return secreto, hashSecreto(secreto), nil
+}
+
+// hashSecreto devuelve la clave con la que se guarda un secreto.
+func hashSecreto(secreto string) string {
+	suma := sha256.Sum256([]byte(secreto))
+	return hex.EncodeToString(suma[:])
+}
+
+// emitirToken guarda en coleccion un token nuevo para usuarioID, que puede
+// ser el ObjectID vacío, y devuelve el valor que se entrega al cliente. Con
+// unico se anulan antes los tokens anteriores del usuario, de modo que solo
+// vale el último correo recibido.
+func emitirToken(ctx context.Context, coleccion *mongo.Collection, usuarioID primitive.ObjectID, vigencia time.Duration, unico bool) (string, time.Time, error) {
+	token, hash, err := generarSecreto()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if unico && !usuarioID.IsZero() {
+		if _, err := coleccion.DeleteMany(ctx, bson.M{"usuario_id": usuarioID}); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	ahora := time.Now()
+	doc := tokenUsuario{Hash: hash, UsuarioID: usuarioID, CreadoEn: ahora, ExpiraEn: ahora.Add(vigencia)}
+	if _, err := coleccion.InsertOne(ctx, doc); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, doc.ExpiraEn, nil
+}
+
+// canjearToken consume el token y devuelve el usuario para el que se emitió.
+// Se borra al canjearlo aunque lo que venga después falle, así que cada
+// token permite un solo intento.
+func canjearToken(ctx context.Context, coleccion *mongo.Collection, token string) (primitive.ObjectID, error) {
+	var doc tokenUsuario
+	err := coleccion.FindOneAndDelete(ctx, bson.M{
+		"_id":       hashSecreto(token),
+		"expira_en": bson.M{"$gt": time.Now()},
+	}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return primitive.NilObjectID, errTokenInvalido
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if doc.UsuarioID.IsZero() {
+		return primitive.NilObjectID, errTokenInvalido
+	}
+	return doc.UsuarioID, nil
+}
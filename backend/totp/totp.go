@@ -0,0 +1,95 @@
+// Package totp implementa contraseñas de un solo uso basadas en tiempo (RFC
+// 6238) con los parámetros que aceptan todas las aplicaciones de
+// autenticación: HMAC-SHA1, 6 dígitos y pasos de 30 segundos.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digitos es la longitud de los códigos.
+	Digitos = 6
+	// Periodo es la duración de cada paso.
+	Periodo = 30 * time.Second
+	// Ventana es cuántos pasos antes y después del actual se aceptan para
+	// tolerar relojes desfasados.
+	Ventana = 1
+)
+
+var codificacion = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NuevoSecreto devuelve un secreto aleatorio de 160 bits en base32, el
+// formato que se muestra al usuario y va en el URI otpauth.
+func NuevoSecreto() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return codificacion.EncodeToString(b), nil
+}
+
+// URI arma el otpauth:// que las aplicaciones leen del código QR.
+func URI(emisor, cuenta, secreto string) string {
+	v := url.Values{}
+	v.Set("secret", secreto)
+	v.Set("issuer", emisor)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digitos))
+	v.Set("period", fmt.Sprint(int(Periodo.Seconds())))
+	etiqueta := url.PathEscape(emisor) + ":" + url.PathEscape(cuenta)
+	return "otpauth://totp/" + etiqueta + "?" + v.Encode()
+}
+
+// Paso devuelve el número de paso de t.
+func Paso(t time.Time) int64 {
+	return t.Unix() / int64(Periodo.Seconds())
+}
+
+// Codigo calcula el código de un paso (RFC 4226, sección 5.3).
+func Codigo(secreto string, paso int64) (string, error) {
+	clave, err := codificacion.DecodeString(strings.ToUpper(secreto))
+	if err != nil {
+		return "", fmt.Errorf("secreto TOTP inválido: %w", err)
+	}
+	var contador [8]byte
+	binary.BigEndian.PutUint64(contador[:], uint64(paso))
+	mac := hmac.New(sha1.New, clave)
+	mac.Write(contador[:])
+	suma := mac.Sum(nil)
+
+	desplazamiento := suma[len(suma)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(suma[desplazamiento:desplazamiento+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digitos, valor%1_000_000), nil
+}
+
+// Verificar comprueba codigo contra los pasos de la ventana alrededor de
+// ahora y devuelve el paso que coincidió. Quien llama debe rechazar pasos
+// iguales o anteriores al último aceptado para que un código no se pueda
+// reutilizar.
+func Verificar(secreto, codigo string, ahora time.Time) (int64, bool) {
+	codigo = strings.ReplaceAll(codigo, " ", "")
+	if len(codigo) != Digitos {
+		return 0, false
+	}
+	actual := Paso(ahora)
+	for paso := actual - Ventana; paso <= actual+Ventana; paso++ {
+		esperado, err := Codigo(secreto, paso)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(esperado), []byte(codigo)) == 1 {
+			return paso, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,136 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secretoRFC es la clave de prueba de SHA1 del RFC 6238, "12345678901234567890"
+// en ASCII, codificada en base32.
+const secretoRFC = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vectores de prueba del apéndice B del RFC 6238 para SHA1. El RFC da
+// códigos de 8 dígitos; los de 6 son sus últimos seis.
+var vectoresRFC = []struct {
+	segundos int64
+	codigo   string
+}{
+	{59, "287082"},          // 94287082
+	{1111111109, "081804"},  // 07081804
+	{1111111111, "050471"},  // 14050471
+	{1234567890, "005924"},  // 89005924
+	{2000000000, "279037"},  // 69279037
+	{20000000000, "353130"}, // 65353130
+}
+
+func TestCodigoVectoresRFC6238(t *testing.T) {
+	for _, v := range vectoresRFC {
+		codigo, err := Codigo(secretoRFC, Paso(time.Unix(v.segundos, 0)))
+		if err != nil {
+			t.Fatalf("Codigo(%d): %v", v.segundos, err)
+		}
+		if codigo != v.codigo {
+			t.Errorf("T=%d: código = %s, se esperaba %s", v.segundos, codigo, v.codigo)
+		}
+	}
+}
+
+func TestCodigoSecretoEnMinusculas(t *testing.T) {
+	codigo, err := Codigo(strings.ToLower(secretoRFC), Paso(time.Unix(59, 0)))
+	if err != nil || codigo != "287082" {
+		t.Errorf("Codigo = %q, %v; se esperaba 287082", codigo, err)
+	}
+	if _, err := Codigo("no-es-base32!", 1); err == nil {
+		t.Error("se esperaba un error con un secreto inválido")
+	}
+}
+
+func TestVerificarVectoresRFC6238(t *testing.T) {
+	for _, v := range vectoresRFC {
+		ahora := time.Unix(v.segundos, 0)
+		paso, ok := Verificar(secretoRFC, v.codigo, ahora)
+		if !ok || paso != Paso(ahora) {
+			t.Errorf("T=%d: Verificar = %d, %v; se esperaba %d, true", v.segundos, paso, ok, Paso(ahora))
+		}
+	}
+}
+
+func TestVerificarToleraUnPasoDeDesfase(t *testing.T) {
+	ahora := time.Unix(1234567890, 0)
+	actual := Paso(ahora)
+
+	for desfase := int64(-Ventana); desfase <= Ventana; desfase++ {
+		codigo, _ := Codigo(secretoRFC, actual+desfase)
+		paso, ok := Verificar(secretoRFC, codigo, ahora)
+		if !ok || paso != actual+desfase {
+			t.Errorf("desfase %d: Verificar = %d, %v", desfase, paso, ok)
+		}
+	}
+	for _, desfase := range []int64{-Ventana - 1, Ventana + 1, -10, 10} {
+		codigo, _ := Codigo(secretoRFC, actual+desfase)
+		if _, ok := Verificar(secretoRFC, codigo, ahora); ok {
+			t.Errorf("desfase %d: se aceptó un código fuera de la ventana", desfase)
+		}
+	}
+
+	// El mismo código sigue valiendo hasta el final del paso siguiente
+	codigo, _ := Codigo(secretoRFC, actual)
+	inicio := time.Unix(actual*int64(Periodo.Seconds()), 0)
+	if _, ok := Verificar(secretoRFC, codigo, inicio.Add(2*Periodo-time.Second)); !ok {
+		t.Error("se rechazó el código un paso después")
+	}
+	if _, ok := Verificar(secretoRFC, codigo, inicio.Add(2*Periodo)); ok {
+		t.Error("se aceptó el código dos pasos después")
+	}
+}
+
+func TestVerificarRechazaCodigosMalFormados(t *testing.T) {
+	ahora := time.Unix(59, 0)
+	if _, ok := Verificar(secretoRFC, "287 082", ahora); !ok {
+		t.Error("se rechazó el código con un espacio")
+	}
+	for _, codigo := range []string{"", "28708", "2870821", "94287082", "abcdef", "287083"} {
+		if _, ok := Verificar(secretoRFC, codigo, ahora); ok {
+			t.Errorf("se aceptó %q", codigo)
+		}
+	}
+	if _, ok := Verificar("no-es-base32!", "287082", ahora); ok {
+		t.Error("se aceptó un código con un secreto inválido")
+	}
+}
+
+func TestNuevoSecreto(t *testing.T) {
+	a, err := NuevoSecreto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NuevoSecreto()
+	if a == b {
+		t.Error("dos secretos iguales")
+	}
+	if len(a) != 32 {
+		t.Errorf("len(secreto) = %d, se esperaba 32 (160 bits en base32)", len(a))
+	}
+	if _, err := Codigo(a, 1); err != nil {
+		t.Errorf("el secreto generado no sirve: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("QR-TixPro", "1020304050", secretoRFC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/QR-TixPro:1020304050" {
+		t.Errorf("URI = %s", u)
+	}
+	q := u.Query()
+	esperados := map[string]string{"secret": secretoRFC, "issuer": "QR-TixPro", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for clave, valor := range esperados {
+		if q.Get(clave) != valor {
+			t.Errorf("%s = %q, se esperaba %q", clave, q.Get(clave), valor)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const nombreServicio = "qrtixpro-backend"
+
+var tracer = otel.Tracer(nombreServicio)
+
+// iniciarTrazas instala el TracerProvider global según cfg.Trazas y devuelve
+// la función que vacía y cierra el exportador. Con el exportador "ninguno" no
+// se registra nada y las trazas no cuestan.
+func iniciarTrazas() (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exportador sdktrace.SpanExporter
+	var err error
+	switch cfg.Trazas.Exportador {
+	case "otlp":
+		var opciones []otlptracehttp.Option
+		if cfg.Trazas.Endpoint != "" {
+			opciones = append(opciones, otlptracehttp.WithEndpointURL(cfg.Trazas.Endpoint))
+		}
+		exportador, err = otlptracehttp.New(context.Background(), opciones...)
+	case "stdout":
+		exportador, err = stdouttrace.New()
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recurso, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(nombreServicio),
+		semconv.DeploymentEnvironment(cfg.Entorno),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	proveedor := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exportador),
+		sdktrace.WithResource(recurso),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Trazas.Muestreo))),
+	)
+	otel.SetTracerProvider(proveedor)
+	return proveedor.Shutdown, nil
+}
+
+// apagarTrazas envía las trazas pendientes antes de salir.
+func apagarTrazas(apagar func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := apagar(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		slog.Warn("No se pudieron enviar las trazas pendientes", "error", err)
+	}
+}
+
+// monitorMongoCompleto junta las métricas de monitorMongo con los spans de
+// otelmongo. El texto de los comandos no se adjunta a los spans porque lleva
+// datos personales.
+func monitorMongoCompleto(base string) *event.CommandMonitor {
+	return combinarMonitores(monitorMongo(base), otelmongo.NewMonitor(otelmongo.WithCommandAttributeDisabled(true)))
+}
+
+// combinarMonitores reparte cada evento de comando entre varios monitores.
+func combinarMonitores(monitores ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitores {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitores {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitores {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// spanActual devuelve los identificadores de traza de ctx para los logs.
+func spanActual(ctx context.Context) (traceID, spanID string, ok bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", "", false
+	}
+	return sc.TraceID().String(), sc.SpanID().String(), true
+}
+
+// contextoSolicitud devuelve un contexto con plazo para las operaciones de un
+// handler. Conserva los valores de la solicitud (span y request_id) pero no su
+// cancelación: si el cliente se desconecta, la escritura en Atlas y en la
+// réplica local termina igual.
+func contextoSolicitud(c *gin.Context, plazo time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(c.Request.Context()), plazo)
+}
+
+// rastrearRuta deja fuera de las trazas las sondas y el scraping de métricas.
+func rastrearRuta(c *gin.Context) bool {
+	switch c.FullPath() {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// estadoVentaCompletada es el estado de una venta pagada, la única cuyas
+// boletas dan ingreso.
+const estadoVentaCompletada = "completado"
+
+// maxVentasListadas limita cuántas ventas devuelve una consulta.
+const maxVentasListadas = 200
+
+// ingreso registra el paso de una boleta por la portería.
+type ingreso struct {
+	Boleta     int                `json:"boleta" bson:"boleta"`
+	Fecha      time.Time          `json:"fecha" bson:"fecha"`
+	PorteriaID primitive.ObjectID `json:"-" bson:"porteria_id"`
+}
+
+// datosVentaRegistrada es la respuesta de registrarVenta. El ID va en el
+// código QR de cada boleta.
+type datosVentaRegistrada struct {
+	ID primitive.ObjectID `json:"id"`
+}
+
+// solicitudIngreso es el cuerpo de POST /ventas/:id/ingresos. Boleta es el
+// número de la boleta dentro de la venta, desde 1.
+type solicitudIngreso struct {
+	Boleta int `json:"boleta"`
+}
+
+// datosIngreso es lo que la portería necesita ver al dar paso.
+type datosIngreso struct {
+	Venta  primitive.ObjectID `json:"venta"`
+	Boleta int                `json:"boleta"`
+	Nombre string             `json:"nombre"`
+	Zona   string             `json:"zona"`
+}
+
+// alcanceVentas filtra las ventas que puede ver el usuario: todas con
+// permisoTodasLasVentas; si no, las que compró y, si es organizador, las de
+// los eventos de su organizador. Nunca las de otro organizador.
+func alcanceVentas(usuario Usuario) bson.M {
+	if usuario.tienePermiso(permisoTodasLasVentas) {
+		return bson.M{}
+	}
+	alcance := bson.A{filtroCedula(usuario.Cedula)}
+	if usuario.tieneRol(rolOrganizador) && !usuario.OrganizadorID.IsZero() {
+		alcance = append(alcance, bson.M{"organizador_id": usuario.OrganizadorID})
+	}
+	return bson.M{"$or": alcance}
+}
+
+// alcancePorteria filtra las ventas cuyas boletas puede validar el usuario:
+// las de los eventos de su organizador o, con permisoTodasLasVentas, todas.
+// Una portería sin organizador no valida ninguna.
+func alcancePorteria(usuario Usuario) bson.M {
+	if usuario.tienePermiso(permisoTodasLasVentas) {
+		return bson.M{}
+	}
+	if usuario.OrganizadorID.IsZero() {
+		return bson.M{"_id": bson.M{"$exists": false}}
+	}
+	return bson.M{"organizador_id": usuario.OrganizadorID}
+}
+
+// listarVentas devuelve las ventas más recientes al alcance de quien llama.
+func listarVentas(c *gin.Context) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	usuario := usuarioAutenticado(c)
+	opciones := options.Find().SetSort(bson.D{{Key: "fecha", Value: -1}}).SetLimit(maxVentasListadas)
+	ventas := []Venta{}
+	cursor, err := ventasCollection.Find(ctx, alcanceVentas(usuario), opciones)
+	if err == nil {
+		err = cursor.All(ctx, &ventas)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudieron leer las ventas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	for i := range ventas {
+		if err := descifrarVenta(&ventas[i]); err != nil {
+			slog.ErrorContext(c.Request.Context(), "No se pudo descifrar una venta", "error", err)
+			responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+			return
+		}
+	}
+
+	responderOK(c, http.StatusOK, "", ventas)
+}
+
+// registrarIngreso marca como usada una boleta de una venta de los eventos
+// del organizador de la portería. La condición va en el mismo update, así
+// que dos porterías que leen la misma boleta a la vez no la dejan pasar dos
+// veces.
+func registrarIngreso(c *gin.Context) {
+	var datos solicitudIngreso
+	if err := c.ShouldBindJSON(&datos); err != nil {
+		slog.WarnContext(c.Request.Context(), "Datos JSON inválidos", "error", err)
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+	ventaID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		responderError(c, http.StatusNotFound, codigoVentaNoEncontrada)
+		return
+	}
+	if datos.Boleta < 1 {
+		responderError(c, http.StatusBadRequest, codigoDatosInvalidos)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	porteria := usuarioAutenticado(c)
+	nuevo := ingreso{Boleta: datos.Boleta, Fecha: time.Now(), PorteriaID: porteria.ID}
+	var venta Venta
+	filtro := alcancePorteria(porteria)
+	filtro["_id"] = ventaID
+	filtro["estado"] = estadoVentaCompletada
+	filtro["cantidad"] = bson.M{"$gte": datos.Boleta}
+	filtro["ingresos.boleta"] = bson.M{"$ne": datos.Boleta}
+	err = ventasCollection.FindOneAndUpdate(ctx, filtro, bson.M{"$push": bson.M{"ingresos": nuevo}}).Decode(&venta)
+	if err == mongo.ErrNoDocuments {
+		rechazarIngreso(c, porteria, ventaID, datos.Boleta)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo registrar el ingreso", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	escritoEnAtlas := time.Now()
+
+	if ventasCollectionLocal != nil && clientLocal != nil {
+		_, err := ventasCollectionLocal.UpdateOne(ctx, bson.M{"_id": ventaID}, bson.M{"$push": bson.M{"ingresos": nuevo}})
+		observarReplica("ventas", escritoEnAtlas, err)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "No se pudo registrar el ingreso en MongoDB Local", "error", err)
+		}
+	}
+
+	auditar(c, accionIngresoRegistrar, objetivo(objetivoVenta, ventaID, ""), nil, bson.M{"ingreso": nuevo})
+
+	slog.InfoContext(c.Request.Context(), "Ingreso registrado", "venta", ventaID.Hex(), "boleta", datos.Boleta, "porteria", porteria.Cedula)
+	responderOK(c, http.StatusOK, exitoIngresoRegistrado, datosIngreso{
+		Venta:  ventaID,
+		Boleta: datos.Boleta,
+		Nombre: venta.Nombre,
+		Zona:   venta.Zona,
+	})
+}
+
+// rechazarIngreso averigua por qué no se pudo marcar la boleta y responde
+// con el error que corresponde. Las ventas de otro organizador se tratan
+// como inexistentes.
+func rechazarIngreso(c *gin.Context, porteria Usuario, ventaID primitive.ObjectID, boleta int) {
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	filtro := alcancePorteria(porteria)
+	filtro["_id"] = ventaID
+	var venta Venta
+	err := ventasCollection.FindOne(ctx, filtro).Decode(&venta)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		responderError(c, http.StatusNotFound, codigoVentaNoEncontrada)
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Error al buscar la venta", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+	case venta.Estado != estadoVentaCompletada || boleta > venta.Cantidad:
+		slog.WarnContext(c.Request.Context(), "Boleta inválida en portería", "venta", ventaID.Hex(), "boleta", boleta, "estado", venta.Estado)
+		responderError(c, http.StatusConflict, codigoBoletaInvalida)
+	default:
+		slog.WarnContext(c.Request.Context(), "Boleta ya usada", "venta", ventaID.Hex(), "boleta", boleta)
+		responderError(c, http.StatusConflict, codigoBoletaYaUsada)
+	}
+}
+
+// filaReporte resume las ventas de una zona de un evento.
+type filaReporte struct {
+	Evento   primitive.ObjectID `json:"evento" bson:"evento"`
+	Zona     string             `json:"zona" bson:"zona"`
+	Ventas   int                `json:"ventas" bson:"ventas"`
+	Boletas  int                `json:"boletas" bson:"boletas"`
+	Ingresos int                `json:"ingresos" bson:"ingresos"`
+	Recaudo  float64            `json:"recaudo" bson:"recaudo"`
+}
+
+// reporteVentas resume por evento y zona las ventas completadas del
+// organizador de la ruta: boletas vendidas, boletas que ya ingresaron y
+// recaudo. Solo agrega ventas de ese organizador.
+func reporteVentas(c *gin.Context) {
+	organizadorID, err := primitive.ObjectIDFromHex(c.Param("organizador"))
+	if err != nil {
+		responderError(c, http.StatusNotFound, codigoOrganizadorNoEncontrado)
+		return
+	}
+
+	ctx, cancel := contextoSolicitud(c, cfg.Mongo.TimeoutConsulta.Duration())
+	defer cancel()
+
+	filas := []filaReporte{}
+	cursor, err := ventasCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"organizador_id": organizadorID, "estado": estadoVentaCompletada}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"evento": "$evento_id", "zona": "$zona"},
+			"ventas":   bson.M{"$sum": 1},
+			"boletas":  bson.M{"$sum": "$cantidad"},
+			"ingresos": bson.M{"$sum": bson.M{"$size": bson.M{"$ifNull": bson.A{"$ingresos", bson.A{}}}}},
+			"recaudo":  bson.M{"$sum": "$total"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id": 0, "evento": "$_id.evento", "zona": "$_id.zona",
+			"ventas": 1, "boletas": 1, "ingresos": 1, "recaudo": 1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "evento", Value: 1}, {Key: "zona", Value: 1}}}},
+	})
+	if err == nil {
+		err = cursor.All(ctx, &filas)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "No se pudo generar el reporte de ventas", "error", err)
+		responderError(c, http.StatusInternalServerError, codigoErrorInterno)
+		return
+	}
+	responderOK(c, http.StatusOK, "", filas)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// coincide evalúa en memoria los filtros que arman alcanceVentas y
+// alcancePorteria: igualdad de campos, $or y {$exists: false}.
+func coincide(filtro, venta bson.M) bool {
+	for campo, condicion := range filtro {
+		if campo == "$or" {
+			if !slices.ContainsFunc(condicion.(bson.A), func(f any) bool { return coincide(f.(bson.M), venta) }) {
+				return false
+			}
+			continue
+		}
+		valor, existe := venta[campo]
+		if c, ok := condicion.(bson.M); ok {
+			if c["$exists"] == false && existe {
+				return false
+			}
+			continue
+		}
+		if !existe || !reflect.DeepEqual(valor, condicion) {
+			return false
+		}
+	}
+	return true
+}
+
+// ventasAlAlcance devuelve los nombres de las ventas que cumplen el filtro.
+func ventasAlAlcance(filtro bson.M, ventas map[string]bson.M) []string {
+	var nombres []string
+	for nombre, venta := range ventas {
+		if coincide(filtro, venta) {
+			nombres = append(nombres, nombre)
+		}
+	}
+	slices.Sort(nombres)
+	return nombres
+}
+
+func TestAlcanceVentasYPorteria(t *testing.T) {
+	prepararSesiones(t)
+	orgX, orgY := primitive.NewObjectID(), primitive.NewObjectID()
+	ventas := map[string]bson.M{
+		"compra del cliente en Y":       {"_id": primitive.NewObjectID(), "cedula_hash": llavero.IndiceCiego("cedula", "1000000001"), "organizador_id": orgY},
+		"compra del organizador X en Y": {"_id": primitive.NewObjectID(), "cedula_hash": llavero.IndiceCiego("cedula", "1000000003"), "organizador_id": orgY},
+		"venta de X":                    {"_id": primitive.NewObjectID(), "cedula_hash": llavero.IndiceCiego("cedula", "1000000009"), "organizador_id": orgX},
+		"venta de Y":                    {"_id": primitive.NewObjectID(), "cedula_hash": llavero.IndiceCiego("cedula", "1000000009"), "organizador_id": orgY},
+		"venta sin evento":              {"_id": primitive.NewObjectID(), "cedula_hash": llavero.IndiceCiego("cedula", "1000000009")},
+	}
+	todas := ventasAlAlcance(bson.M{}, ventas)
+
+	cliente := Usuario{Cedula: "1000000001"}
+	organizadorX := Usuario{Cedula: "1000000003", Roles: []string{rolOrganizador}, OrganizadorID: orgX}
+	sinOrganizador := Usuario{Cedula: "1000000003", Roles: []string{rolOrganizador}}
+	clienteConOrganizador := Usuario{Cedula: "1000000001", OrganizadorID: orgY}
+	porteriaX := Usuario{Cedula: "1000000002", Roles: []string{rolPorteria}, OrganizadorID: orgX}
+	porteriaSinOrganizador := Usuario{Cedula: "1000000002", Roles: []string{rolPorteria}}
+	admin := Usuario{Roles: []string{rolAdmin}}
+	auditor := Usuario{Permisos: []string{permisoTodasLasVentas}}
+
+	casos := []struct {
+		nombre  string
+		alcance func(Usuario) bson.M
+		usuario Usuario
+		ventas  []string
+	}{
+		{"ventas del cliente", alcanceVentas, cliente, []string{"compra del cliente en Y"}},
+		{"ventas del organizador", alcanceVentas, organizadorX, []string{"compra del organizador X en Y", "venta de X"}},
+		{"ventas del organizador sin organizador", alcanceVentas, sinOrganizador, []string{"compra del organizador X en Y"}},
+		{"ventas del cliente con organizador", alcanceVentas, clienteConOrganizador, []string{"compra del cliente en Y"}},
+		{"ventas del administrador", alcanceVentas, admin, todas},
+		{"ventas con permiso suelto", alcanceVentas, auditor, todas},
+		{"portería de X", alcancePorteria, porteriaX, []string{"venta de X"}},
+		{"portería sin organizador", alcancePorteria, porteriaSinOrganizador, nil},
+		{"portería del administrador", alcancePorteria, admin, todas},
+	}
+	for _, caso := range casos {
+		if got := ventasAlAlcance(caso.alcance(caso.usuario), ventas); !slices.Equal(got, caso.ventas) {
+			t.Errorf("%s: %q, se esperaba %q", caso.nombre, got, caso.ventas)
+		}
+	}
+}
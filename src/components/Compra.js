@@ -2,6 +2,7 @@ import React, { useState, useEffect } from "react";
 import { useLocation, useNavigate } from "react-router-dom";
 import { PDFDownloadLink } from '@react-pdf/renderer';
 import EntradaPDF from './EntradaPDF';
+import { encabezadoSesion } from '../config/sesion';
 
 export default function Compra() {
   const location = useLocation();
@@ -185,7 +186,8 @@ export default function Compra() {
             const response = await fetch('http://localhost:8080/ventas', {
               method: 'POST',
               headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                ...encabezadoSesion()
               },
               body: JSON.stringify(ventaData)
             });
@@ -194,6 +196,7 @@ export default function Compra() {
               const responseData = await response.json();
               const ventaData = {
                 ...responseData,
+                id: responseData.data.id,
                 nombre: formData.nombre,
                 cedula: formData.cedula,
                 telefono: formData.telefono,
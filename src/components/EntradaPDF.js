@@ -40,7 +40,8 @@ const EntradaPDF = ({ ventaData }) => {
     const generarQRs = async () => {
       const codesPromises = Array(ventaData.cantidad).fill().map((_, index) => {
         const qrData = JSON.stringify({
-          id: `${ventaData.cedula}-${index + 1}`,
+          venta: ventaData.id,
+          boleta: index + 1,
           zona: ventaData.zona,
           fecha: ventaData.fecha,
         });
@@ -1,7 +1,8 @@
 import React, { useState, useRef, useEffect } from "react";
 import { useNavigate } from "react-router-dom";
 import { auth, googleProvider } from '../config/googleAuth';
-import { signInWithPopup } from 'firebase/auth';
+import { signInWithPopup, GoogleAuthProvider } from 'firebase/auth';
+import { guardarSesion } from '../config/sesion';
 import '../styles/login.css';
 
 const Loginr = ({ setIsAuthenticated }) => {
@@ -9,6 +10,7 @@ const Loginr = ({ setIsAuthenticated }) => {
   const [cedula, setCedula] = useState("");
   const [contrasena, setContrasena] = useState("");
   const [foto, setFoto] = useState("");
+  const [codigo, setCodigo] = useState("");
   const [error, setError] = useState("");
   const videoRef = useRef(null);
   const canvasRef = useRef(null);
@@ -47,59 +49,109 @@ const Loginr = ({ setIsAuthenticated }) => {
   const iniciarSesionConGoogle = async () => {
     try {
       const result = await signInWithPopup(auth, googleProvider);
-      const email = result.user.email;
-      
-      // Verificar si el correo existe en la base de datos y obtener la cédula
-      const responseEmail = await fetch("http://localhost:8080/verificar-correo", {
+      // El backend verifica el ID token de Google, no el de Firebase
+      const credencialGoogle = GoogleAuthProvider.credentialFromResult(result);
+      if (!credencialGoogle || !credencialGoogle.idToken) {
+        setError("Error al iniciar sesión con Google.");
+        return;
+      }
+
+      const response = await fetch("http://localhost:8080/api/v1/auth/google", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ email }),
+        body: JSON.stringify({ token: credencialGoogle.idToken }),
       });
-      
-      const dataEmail = await responseEmail.json();
-      if (!dataEmail.success) {
-        setError("El correo no está registrado en el sistema.");
+
+      const data = await response.json();
+      if (!data.ok) {
+        setError(data.mensaje || "Error al iniciar sesión con Google.");
         return;
       }
-      
-      // Si no hay foto capturada, mostrar error
-      if (!foto) {
-        setError("Por favor, capture una foto para la verificación facial.");
+
+      guardarSesion(data.data);
+      setIsAuthenticated(true);
+      if (data.data.perfil_incompleto) {
+        alert(data.mensaje);
+      }
+      navigate("/");
+    } catch (error) {
+      console.error("Error:", error);
+      setError("Error al iniciar sesión con Google.");
+    }
+  };
+
+  // Conversión entre base64url (lo que usa la API) y ArrayBuffer (lo que usa WebAuthn)
+  const aBuffer = (texto) => {
+    const base64 = texto.replace(/-/g, "+").replace(/_/g, "/");
+    return Uint8Array.from(atob(base64), (c) => c.charCodeAt(0)).buffer;
+  };
+  const aBase64url = (buffer) =>
+    btoa(String.fromCharCode(...new Uint8Array(buffer)))
+      .replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+
+  const iniciarSesionConPasskey = async () => {
+    if (!window.PublicKeyCredential) {
+      setError("Este navegador no admite llaves de acceso.");
+      return;
+    }
+
+    try {
+      const respuestaDesafio = await fetch("http://localhost:8080/api/v1/sesiones/passkey/ceremonias", {
+        method: "POST",
+      });
+      const desafio = await respuestaDesafio.json();
+      if (!desafio.ok) {
+        setError(desafio.mensaje || "No se pudo iniciar sesión con la llave de acceso.");
         return;
       }
-      
-      // Verificar el rostro con la cédula obtenida
-      const response = await fetch("http://localhost:8080/verificar-rostro", {
+
+      const opciones = desafio.data.opciones.publicKey;
+      const credencial = await navigator.credentials.get({
+        publicKey: {
+          ...opciones,
+          challenge: aBuffer(opciones.challenge),
+        },
+      });
+
+      const response = await fetch("http://localhost:8080/api/v1/sesiones/passkey", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ 
-          cedula: dataEmail.cedula,
-          foto: foto
+        body: JSON.stringify({
+          ceremonia: desafio.data.ceremonia,
+          credencial: {
+            id: credencial.id,
+            rawId: aBase64url(credencial.rawId),
+            type: credencial.type,
+            response: {
+              clientDataJSON: aBase64url(credencial.response.clientDataJSON),
+              authenticatorData: aBase64url(credencial.response.authenticatorData),
+              signature: aBase64url(credencial.response.signature),
+              userHandle: credencial.response.userHandle
+                ? aBase64url(credencial.response.userHandle)
+                : null,
+            },
+            clientExtensionResults: credencial.getClientExtensionResults(),
+          },
         }),
       });
-      
+
       const data = await response.json();
-      if (data.success) {
+      if (data.ok) {
+        guardarSesion(data.data);
         setIsAuthenticated(true);
-        const fechaHoraActual = new Date().toISOString();
-        await fetch("http://localhost:8080/actualizar-ultima-sesion", {
-          method: "PUT",
-          headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({ cedula: dataEmail.cedula, ultimaSesion: fechaHoraActual }),
-        });
         navigate("/");
       } else {
-        setError("La verificación facial ha fallado.");
+        setError(data.mensaje || "La llave de acceso no es válida.");
       }
     } catch (error) {
       console.error("Error:", error);
-      setError("Error al iniciar sesión con Google.");
+      setError("No se pudo iniciar sesión con la llave de acceso.");
     }
   };
 
   const iniciarSesion = async () => {
-    if (!cedula || !contrasena || !foto) {
-      setError("Por favor, completa todos los campos y captura una foto.");
+    if (!cedula || !contrasena || (!foto && !codigo)) {
+      setError("Por favor, completa todos los campos y captura una foto o ingresa el código.");
       return;
     }
 
@@ -107,22 +159,14 @@ const Loginr = ({ setIsAuthenticated }) => {
       const response = await fetch("http://localhost:8080/login", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ cedula, contrasena, foto }),
+        body: JSON.stringify({ cedula, contrasena, foto, codigo }),
       });
 
       const data = await response.json();
       if (data.success) {
+        guardarSesion(data.data);
         setIsAuthenticated(true);
         alert("Inicio de sesión exitoso");
-
-        // Registrar la hora y fecha de inicio de sesión
-        const fechaHoraActual = new Date().toISOString();
-        await fetch("http://localhost:8080/actualizar-ultima-sesion", {
-          method: "PUT",
-          headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({ cedula, ultimaSesion: fechaHoraActual }),
-        });
-
         navigate("/");
       } else {
         alert(data.error || "Error al iniciar sesión");
@@ -169,6 +213,19 @@ const Loginr = ({ setIsAuthenticated }) => {
             />
           </div>
 
+          <div className="login-input-group">
+            <label className="login-label">Código de autenticación (opcional)</label>
+            <input
+              type="text"
+              inputMode="numeric"
+              autoComplete="one-time-code"
+              placeholder="Solo si usa una aplicación de autenticación"
+              value={codigo}
+              onChange={(e) => setCodigo(e.target.value)}
+              className="login-input"
+            />
+          </div>
+
           <div className="login-camera-section">
             <label className="login-label">Verificación Facial</label>
             <video 
@@ -223,6 +280,14 @@ const Loginr = ({ setIsAuthenticated }) => {
               </svg>
               Iniciar con Google
             </button>
+
+            <button 
+              type="button"
+              onClick={iniciarSesionConPasskey} 
+              className="login-btn login-btn-google"
+            >
+              Iniciar con llave de acceso
+            </button>
           </div>
         </form>
       </div>
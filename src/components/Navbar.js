@@ -1,5 +1,6 @@
 import React from 'react';
 import { Link, useNavigate, useLocation } from 'react-router-dom';
+import { borrarSesion } from '../config/sesion';
 
 export default function Navbar({ isAuthenticated, setIsAuthenticated }) {
   const navigate = useNavigate();
@@ -10,6 +11,7 @@ export default function Navbar({ isAuthenticated, setIsAuthenticated }) {
   };
 
   const cerrarSesion = () => {
+    borrarSesion();
     setIsAuthenticated(false);
     navigate("/");
   };
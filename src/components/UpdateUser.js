@@ -1,4 +1,5 @@
 import React, { useState } from 'react';
+import { encabezadoSesion } from '../config/sesion';
 
 const UpdateUser = () => {
   const [userData, setUserData] = useState({
@@ -22,7 +23,7 @@ const UpdateUser = () => {
   const handleSubmit = async (action) => {
     try {
       if (!userData.cedula) {
-        alert('Por favor, ingrese una cédula');
+        alert('Por favor, ingrese su cédula');
         return;
       }
 
@@ -56,7 +57,8 @@ const UpdateUser = () => {
       const response = await fetch(url, {
         method,
         headers: {
-          'Content-Type': 'application/json'
+          'Content-Type': 'application/json',
+          ...encabezadoSesion()
         },
         body
       });
@@ -65,7 +67,8 @@ const UpdateUser = () => {
       if (response.ok) {
         if (action === 'buscar') {
           if (data.data) {
-            setUserData(data.data);
+            // La respuesta no trae la contraseña; se conserva la escrita
+            setUserData(prev => ({ ...prev, ...data.data }));
             alert('Datos del usuario obtenidos exitosamente');
           } else {
             alert('No se encontraron datos para esta cédula');
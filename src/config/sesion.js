@@ -0,0 +1,16 @@
+// El token de sesión que devuelve el backend al iniciar sesión. Es la única
+// credencial que aceptan las rutas autenticadas; se guarda solo mientras
+// dura la pestaña.
+const CLAVE = "sesion";
+
+export const guardarSesion = (datos) => {
+  if (datos && datos.sesion) {
+    sessionStorage.setItem(CLAVE, datos.sesion);
+  }
+};
+
+export const borrarSesion = () => sessionStorage.removeItem(CLAVE);
+
+export const encabezadoSesion = () => ({
+  Authorization: "Bearer " + (sessionStorage.getItem(CLAVE) || ""),
+});